@@ -0,0 +1,90 @@
+package main
+
+import "time"
+
+// BatchOptions define when `Batch` sends the collected items downstream, zero value disables the limit.
+// The batch is also sent when the input is closed.
+type BatchOptions struct {
+	// MaxItems is the maximum number of items in a batch.
+	MaxItems int
+	// MaxBytes is the maximum total size of items in a batch, an item larger than it is sent alone.
+	MaxBytes int
+	// MaxDelay is the maximum time the first item of a batch waits for the others, it is measured by `SignerClock`.
+	MaxDelay time.Duration
+	// Size returns the size of an item in bytes, by default it's the length of `string` and `[]byte` and 0 otherwise.
+	Size func(val interface{}) int
+}
+
+// Batch returns the job grouping input items into `[]interface{}` slices according to the options.
+// Items keep their order inside and across the batches.
+func Batch(opts BatchOptions) job {
+	if opts.MaxItems < 0 || opts.MaxBytes < 0 || opts.MaxDelay < 0 {
+		panic("batch limits must be >= 0")
+	}
+	if opts.Size == nil {
+		opts.Size = byteSize
+	}
+	return func(in, out chan interface{}) {
+		var (
+			batch []interface{}
+			bytes int
+			timer Timer
+			timeC <-chan time.Time
+		)
+		flush := func() {
+			if timer != nil {
+				timer.Stop()
+				timer, timeC = nil, nil
+			}
+			if len(batch) > 0 {
+				out <- batch
+			}
+			batch, bytes = nil, 0
+		}
+		for {
+			select {
+			case val, ok := <-in:
+				if !ok {
+					flush()
+					return
+				}
+				size := opts.Size(val)
+				if opts.MaxBytes > 0 && len(batch) > 0 && bytes+size > opts.MaxBytes {
+					flush()
+				}
+				if len(batch) == 0 && opts.MaxDelay > 0 {
+					timer = SignerClock.NewTimer(opts.MaxDelay)
+					timeC = timer.C()
+				}
+				batch, bytes = append(batch, val), bytes+size
+				if (opts.MaxItems > 0 && len(batch) >= opts.MaxItems) || (opts.MaxBytes > 0 && bytes >= opts.MaxBytes) {
+					flush()
+				}
+			case <-timeC:
+				timer, timeC = nil, nil
+				flush()
+			}
+		}
+	}
+}
+
+// Unbatch splits `[]interface{}` batches back into separate items.
+func Unbatch(in, out chan interface{}) {
+	for val := range in {
+		for _, item := range val.([]interface{}) {
+			out <- item
+		}
+	}
+}
+
+// byteSize is the default size of a batched item.
+func byteSize(val interface{}) int {
+	switch val := val.(type) {
+	case string:
+		return len(val)
+	case []byte:
+		return len(val)
+	default:
+		return 0
+	}
+}
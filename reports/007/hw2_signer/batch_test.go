@@ -0,0 +1,155 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+)
+
+// batchSizes runs the source through `Batch` and returns the batches.
+func batchSizes(source job, opts BatchOptions) string {
+	var res []string
+	ExecutePipeline(source, Batch(opts), func(in, out chan interface{}) {
+		for val := range in {
+			res = append(res, fmt.Sprint(val))
+		}
+	})
+	return strings.Join(res, " ")
+}
+
+func TestBatch(t *testing.T) {
+	defer checkLeaks(t)()
+	cases := []struct {
+		Name     string
+		Source   job
+		Options  BatchOptions
+		Expected string
+	}{
+		{
+			Name:     "by count",
+			Source:   emit(1, 2, 3, 4, 5),
+			Options:  BatchOptions{MaxItems: 2},
+			Expected: "[1 2] [3 4] [5]",
+		},
+		{
+			Name:     "by bytes",
+			Source:   emit("aa", "bbb", "c", "dddddd", "e", "f"),
+			Options:  BatchOptions{MaxBytes: 5},
+			Expected: "[aa bbb] [c] [dddddd] [e f]",
+		},
+		{
+			Name:   "by custom size",
+			Source: emit(1, 2, 3, 4),
+			Options: BatchOptions{MaxBytes: 5, Size: func(val interface{}) int {
+				return val.(int)
+			}},
+			Expected: "[1 2] [3] [4]",
+		},
+		{
+			Name:     "no limits",
+			Source:   emit(1, 2, 3),
+			Options:  BatchOptions{},
+			Expected: "[1 2 3]",
+		},
+		{
+			Name:     "empty",
+			Source:   emit(),
+			Options:  BatchOptions{MaxItems: 2},
+			Expected: "",
+		},
+		{
+			Name: "by time window",
+			Source: func(in, out chan interface{}) {
+				out <- 1
+				out <- 2
+				time.Sleep(100 * time.Millisecond)
+				out <- 3
+			},
+			Options:  BatchOptions{MaxItems: 10, MaxDelay: 20 * time.Millisecond},
+			Expected: "[1 2] [3]",
+		},
+	}
+	for _, tc := range cases {
+		t.Run(tc.Name, func(t *testing.T) {
+			if got := batchSizes(tc.Source, tc.Options); got != tc.Expected {
+				t.Errorf("Got: %s\nExpected: %s", got, tc.Expected)
+			}
+		})
+	}
+}
+
+func TestBatchFakeClock(t *testing.T) {
+	clock, restore := useFakeClock(t)
+	defer restore()
+	// the input is not buffered, so the items are taken by `Batch` before the source sleeps
+	in, out := make(chan interface{}), make(chan interface{}, MaxInputDataLen)
+	go func() {
+		defer close(in)
+		in <- 1
+		in <- 2
+		SignerClock.Sleep(time.Hour)
+		in <- 3
+	}()
+	go func() {
+		defer close(out)
+		Batch(BatchOptions{MaxItems: 10, MaxDelay: 20 * time.Minute})(in, out)
+	}()
+
+	start := time.Now()
+	// the timer of the first batch and the source sleeping for an hour
+	for clock.Sleepers() != 2 {
+		time.Sleep(time.Millisecond)
+	}
+	clock.Advance(20 * time.Minute)
+	if got := fmt.Sprint(<-out); got != "[1 2]" {
+		t.Errorf("Got: %s\nExpected: %s", got, "[1 2]")
+	}
+	clock.Advance(40 * time.Minute)
+	if got := fmt.Sprint(<-out); got != "[3]" {
+		t.Errorf("Got: %s\nExpected: %s", got, "[3]")
+	}
+	if val, ok := <-out; ok {
+		t.Errorf("unexpected batch %v", val)
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("virtual delay took %s of wall time", elapsed)
+	}
+}
+
+func TestBatchUnbatch(t *testing.T) {
+	defer checkLeaks(t)()
+	calls := 0
+	res := &collector{}
+	ExecutePipeline(
+		emit("a", "b", "c", "d", "e"),
+		Batch(BatchOptions{MaxItems: 2}),
+		func(in, out chan interface{}) {
+			for val := range in {
+				calls++
+				batch := val.([]interface{})
+				for i, item := range batch {
+					batch[i] = strings.ToUpper(item.(string))
+				}
+				out <- batch
+			}
+		},
+		Unbatch,
+		res.sink("res"),
+	)
+	if got := strings.Join(res.items["res"], ","); got != "A,B,C,D,E" {
+		t.Errorf("Got: %s\nExpected: %s", got, "A,B,C,D,E")
+	}
+	if calls != 3 {
+		t.Errorf("backend calls\nGot: %d\nExpected: %d", calls, 3)
+	}
+}
+
+func TestBatchInvalid(t *testing.T) {
+	defer func() {
+		if recover() == nil {
+			t.Errorf("negative limit accepted")
+		}
+	}()
+	Batch(BatchOptions{MaxItems: -1})
+}
@@ -0,0 +1,49 @@
+package main
+
+import "time"
+
+// Clock tells the time, sleeps and starts timers, data signers, the overheat governor
+// and the pipeline stages waiting for time use it instead of `time` package.
+type Clock interface {
+	Now() time.Time
+	Sleep(d time.Duration)
+	NewTimer(d time.Duration) Timer
+}
+
+// Timer sends the time to `C` once it expires, like `time.Timer` does.
+type Timer interface {
+	C() <-chan time.Time
+	// Stop prevents the timer from firing, it returns false if the timer has already expired or been stopped.
+	Stop() bool
+}
+
+// SignerClock is the clock used by data signers, `OverheatLock`/`OverheatUnlock` and `Batch`.
+var SignerClock Clock = realClock{}
+
+// realClock is the wall clock.
+type realClock struct{}
+
+// Now implements `Clock` interface.
+func (realClock) Now() time.Time {
+	return time.Now()
+}
+
+// Sleep implements `Clock` interface.
+func (realClock) Sleep(d time.Duration) {
+	time.Sleep(d)
+}
+
+// NewTimer implements `Clock` interface.
+func (realClock) NewTimer(d time.Duration) Timer {
+	return realTimer{time.NewTimer(d)}
+}
+
+// realTimer is the wall clock timer.
+type realTimer struct {
+	*time.Timer
+}
+
+// C implements `Timer` interface.
+func (t realTimer) C() <-chan time.Time {
+	return t.Timer.C
+}
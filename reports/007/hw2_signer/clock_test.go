@@ -0,0 +1,315 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+	"testing"
+	"time"
+)
+
+// sleeper is a goroutine or a timer waiting for the virtual time to reach `until`.
+// Goroutines are woken by closing `wake`, timers get the time in `fire`.
+type sleeper struct {
+	until time.Time
+	wake  chan struct{}
+	fire  chan time.Time
+}
+
+// FakeClock is the virtual clock which time moves only when it is advanced.
+// It is advanced explicitly by `Advance` or advances itself to the nearest wake up time
+// once the expected number of sleepers wait for it, see `Expect`.
+type FakeClock struct {
+	mu       sync.Mutex
+	now      time.Time
+	sleepers []*sleeper
+	expected []int
+}
+
+// NewFakeClock creates the virtual clock starting at `start`.
+func NewFakeClock(start time.Time) *FakeClock {
+	return &FakeClock{now: start}
+}
+
+// Expect makes the clock advance itself to the nearest wake up time each time the number of sleepers,
+// goroutines in `Sleep` and pending timers, reaches the next of the counts. Each count is used for one advance,
+// so the counts are the schedule of the work on the clock: it must be known in advance, but the clock
+// never moves while some goroutine is about to sleep.
+func (c *FakeClock) Expect(counts ...int) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.expected = append(c.expected, counts...)
+	c.advanceExpected()
+}
+
+// Pending returns the counts passed to `Expect` which have not been reached yet.
+func (c *FakeClock) Pending() []int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return append([]int(nil), c.expected...)
+}
+
+// Now implements `Clock` interface.
+func (c *FakeClock) Now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.now
+}
+
+// Sleep implements `Clock` interface, it blocks until the virtual time is advanced by `d`.
+func (c *FakeClock) Sleep(d time.Duration) {
+	if d <= 0 {
+		return
+	}
+	s := &sleeper{wake: make(chan struct{})}
+	c.mu.Lock()
+	s.until = c.now.Add(d)
+	c.sleepers = append(c.sleepers, s)
+	c.advanceExpected()
+	c.mu.Unlock()
+	<-s.wake
+}
+
+// NewTimer implements `Clock` interface, the timer fires when the virtual time is advanced by `d`.
+func (c *FakeClock) NewTimer(d time.Duration) Timer {
+	t := &fakeTimer{clock: c, s: &sleeper{fire: make(chan time.Time, 1)}}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	t.s.until = c.now.Add(d)
+	c.sleepers = append(c.sleepers, t.s)
+	c.advanceTo(c.now)
+	c.advanceExpected()
+	return t
+}
+
+// fakeTimer is the timer of the virtual clock.
+type fakeTimer struct {
+	clock *FakeClock
+	s     *sleeper
+}
+
+// C implements `Timer` interface.
+func (t *fakeTimer) C() <-chan time.Time {
+	return t.s.fire
+}
+
+// Stop implements `Timer` interface.
+func (t *fakeTimer) Stop() bool {
+	c := t.clock
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for i, s := range c.sleepers {
+		if s == t.s {
+			c.sleepers = append(c.sleepers[:i], c.sleepers[i+1:]...)
+			return true
+		}
+	}
+	return false
+}
+
+// Sleepers returns the number of goroutines blocked in `Sleep` and pending timers.
+func (c *FakeClock) Sleepers() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return len(c.sleepers)
+}
+
+// Advance moves the virtual time forward and wakes up all the goroutines which sleep is over.
+// Goroutines going to sleep again after the wake up start counting from the new time.
+func (c *FakeClock) Advance(d time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.advanceTo(c.now.Add(d))
+}
+
+// advanceExpected moves the clock to the nearest wake up time while the next expected number of sleepers is reached.
+// It is assumed that `c.mu` is locked.
+func (c *FakeClock) advanceExpected() {
+	for len(c.expected) > 0 && len(c.sleepers) > 0 && len(c.sleepers) >= c.expected[0] {
+		c.expected = c.expected[1:]
+		next := c.sleepers[0].until
+		for _, s := range c.sleepers[1:] {
+			if s.until.Before(next) {
+				next = s.until
+			}
+		}
+		c.advanceTo(next)
+	}
+}
+
+// advanceTo sets the virtual time and wakes up all the sleepers which time has come.
+// It is assumed that `c.mu` is locked.
+func (c *FakeClock) advanceTo(t time.Time) {
+	if t.After(c.now) {
+		c.now = t
+	}
+	sort.SliceStable(c.sleepers, func(i, j int) bool {
+		return c.sleepers[i].until.Before(c.sleepers[j].until)
+	})
+	i := 0
+	for ; i < len(c.sleepers) && !c.sleepers[i].until.After(c.now); i++ {
+		if s := c.sleepers[i]; s.fire != nil {
+			s.fire <- c.now
+		} else {
+			close(s.wake)
+		}
+	}
+	c.sleepers = append(c.sleepers[:0], c.sleepers[i:]...)
+}
+
+// useFakeClock makes data signers run on the virtual clock advancing itself by the schedule of `Expect`,
+// the returned function restores the clock and checks that the schedule is over.
+func useFakeClock(t *testing.T, counts ...int) (*FakeClock, func()) {
+	clock := NewFakeClock(time.Unix(0, 0))
+	clock.Expect(counts...)
+	prev := SignerClock
+	SignerClock = clock
+	return clock, func() {
+		SignerClock = prev
+		if pending := clock.Pending(); len(pending) > 0 {
+			t.Errorf("virtual clock did not reach sleepers %v", pending)
+		}
+	}
+}
+
+// signerSchedule returns the numbers of sleepers of `SingleHash` over n values followed by `MultiHash` if `multi` is set,
+// see `Expect`. Both use `DefaultRecipe` and one second crc32 with 10ms md5.
+func signerSchedule(n int, multi bool) []int {
+	var counts []int
+	// crc32 of all values sleeps from the start while md5 of them is calculated one at a time,
+	// each md5 is followed by crc32 of it
+	for k := 1; k <= n; k++ {
+		counts = append(counts, n+k)
+	}
+	counts = append(counts, 2*n)
+	if !multi {
+		// crc32 of md5 of the values finish 10ms apart
+		for k := 0; k < n; k++ {
+			counts = append(counts, n-k)
+		}
+		return counts
+	}
+	// crc32 of md5 of the values finish 10ms apart and each one starts 6 crc32 of `MultiHash`
+	for k := 0; k <= n; k++ {
+		counts = append(counts, n+5*k)
+	}
+	// `MultiHash` of the values finish 10ms apart too
+	for k := 1; k < n; k++ {
+		counts = append(counts, 6*(n-k))
+	}
+	return counts
+}
+
+func TestFakeClockAdvance(t *testing.T) {
+	clock := NewFakeClock(time.Unix(0, 0))
+	woken := make(chan time.Duration, 3)
+	for _, d := range []time.Duration{time.Second, 2 * time.Second, 3 * time.Second} {
+		go func(d time.Duration) {
+			clock.Sleep(d)
+			woken <- d
+		}(d)
+	}
+	for clock.Sleepers() != 3 {
+		time.Sleep(time.Millisecond)
+	}
+	// zero sleep returns immediately
+	clock.Sleep(0)
+
+	clock.Advance(1500 * time.Millisecond)
+	if d := <-woken; d != time.Second {
+		t.Errorf("Got: %s\nExpected: %s", d, time.Second)
+	}
+	if n := clock.Sleepers(); n != 2 {
+		t.Errorf("sleepers left\nGot: %d\nExpected: %d", n, 2)
+	}
+	clock.Advance(1500 * time.Millisecond)
+	got := map[time.Duration]bool{<-woken: true, <-woken: true}
+	if !got[2*time.Second] || !got[3*time.Second] {
+		t.Errorf("not all sleepers woken: %v", got)
+	}
+	if now := clock.Now(); !now.Equal(time.Unix(3, 0)) {
+		t.Errorf("Got: %s\nExpected: %s", now, time.Unix(3, 0))
+	}
+}
+
+func TestFakeClockExpect(t *testing.T) {
+	clock := NewFakeClock(time.Unix(0, 0))
+	// 1h, 2h and 3h sleepers wake up at 1h and 2h, 2h, 3h and 4h, 6h
+	clock.Expect(3, 3, 2, 2, 1)
+	mu := &sync.Mutex{}
+	var wakes []time.Duration
+	wg := &sync.WaitGroup{}
+	for i := 1; i <= 3; i++ {
+		wg.Add(1)
+		go func(d time.Duration) {
+			defer wg.Done()
+			clock.Sleep(d)
+			// the time is read before the next sleep which the next advance waits for
+			mu.Lock()
+			wakes = append(wakes, clock.Now().Sub(time.Unix(0, 0)))
+			mu.Unlock()
+			clock.Sleep(d)
+		}(time.Duration(i) * time.Hour)
+	}
+	start := time.Now()
+	wg.Wait()
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("virtual sleep took %s of wall time", elapsed)
+	}
+	expected := "[1h0m0s 2h0m0s 3h0m0s]"
+	if got := fmt.Sprint(wakes); got != expected {
+		t.Errorf("Got: %s\nExpected: %s", got, expected)
+	}
+	if now := clock.Now(); !now.Equal(time.Unix(0, 0).Add(6 * time.Hour)) {
+		t.Errorf("Got: %s\nExpected: %s", now, time.Unix(0, 0).Add(6*time.Hour))
+	}
+	if pending := clock.Pending(); len(pending) != 0 {
+		t.Errorf("schedule is not over: %v", pending)
+	}
+
+	// timers are counted as sleepers too, the timer fires at 7h and the sleeper is woken at 8h
+	clock.Expect(2, 1)
+	timer := clock.NewTimer(time.Hour)
+	clock.Sleep(2 * time.Hour)
+	if len(timer.C()) != 1 || !clock.Now().Equal(time.Unix(0, 0).Add(8*time.Hour)) {
+		t.Errorf("Got: %s\nExpected: %s", clock.Now(), time.Unix(0, 0).Add(8*time.Hour))
+	}
+}
+
+func TestFakeClockTimer(t *testing.T) {
+	clock := NewFakeClock(time.Unix(0, 0))
+	first, second := clock.NewTimer(time.Second), clock.NewTimer(2*time.Second)
+	if n := clock.Sleepers(); n != 2 {
+		t.Errorf("Got: %d sleepers\nExpected: %d", n, 2)
+	}
+	clock.Advance(time.Second)
+	select {
+	case now := <-first.C():
+		if !now.Equal(time.Unix(1, 0)) {
+			t.Errorf("Got: %s\nExpected: %s", now, time.Unix(1, 0))
+		}
+	default:
+		t.Errorf("timer did not fire")
+	}
+	if first.Stop() {
+		t.Errorf("fired timer stopped")
+	}
+	if !second.Stop() || second.Stop() {
+		t.Errorf("timer is not stopped exactly once")
+	}
+	clock.Advance(time.Second)
+	select {
+	case <-second.C():
+		t.Errorf("stopped timer fired")
+	default:
+	}
+	if expired := clock.NewTimer(0); len(expired.C()) != 1 {
+		t.Errorf("zero timer did not fire")
+	}
+
+	real := realClock{}.NewTimer(time.Millisecond)
+	<-real.C()
+	if real.Stop() {
+		t.Errorf("fired timer stopped")
+	}
+}
@@ -1,3 +1,3 @@
 module github.com/vadimpiven/vpn-from-scratch/reports/007/hw2_signer
 
-go 1.12
+go 1.13
@@ -0,0 +1,410 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+)
+
+// FanOut defines how items of a stage with several downstream stages are distributed.
+type FanOut int
+
+const (
+	// Broadcast sends every item to all downstream stages.
+	Broadcast FanOut = iota
+	// RoundRobin sends every item to exactly one downstream stage, taking them in turn.
+	RoundRobin
+)
+
+// Input ports of the graph nodes.
+// Source, Stage and Sink nodes have the only `PortIn` port, Join nodes have `PortLeft` and `PortRight` ports.
+const (
+	PortIn    = "in"
+	PortLeft  = "left"
+	PortRight = "right"
+)
+
+// KeyFunc extracts the join key from an item. The key must be comparable.
+type KeyFunc func(val interface{}) interface{}
+
+// JoinFunc combines two items with equal keys into one.
+type JoinFunc func(left, right interface{}) interface{}
+
+var (
+	errGraphCycle       = errors.New("graph contains a cycle")
+	errGraphEmpty       = errors.New("graph has no nodes")
+	errGraphNameInvalid = errors.New("node name is empty")
+)
+
+type nodeKind int
+
+const (
+	kindSource nodeKind = iota
+	kindStage
+	kindSink
+	kindJoin
+)
+
+// edge connects the output of one node with the named input port of another.
+type edge struct {
+	from, to, port string
+}
+
+// node is a single vertex of the graph.
+type node struct {
+	name    string
+	kind    nodeKind
+	job     job
+	key     [2]KeyFunc
+	combine JoinFunc
+	fanOut  FanOut
+}
+
+// ports returns input ports of the node.
+func (n *node) ports() []string {
+	switch n.kind {
+	case kindSource:
+		return nil
+	case kindJoin:
+		return []string{PortLeft, PortRight}
+	default:
+		return []string{PortIn}
+	}
+}
+
+// hasOutput reports whether the node produces items for downstream stages.
+func (n *node) hasOutput() bool {
+	return n.kind != kindSink
+}
+
+// Graph describes a directed acyclic graph of jobs.
+// Unlike `ExecutePipeline` it allows a stage to feed several downstream stages,
+// several stages to be merged into one and two branches to be joined by key.
+// Builder methods are chainable, the first error is kept and reported by `Validate` and `Run`.
+type Graph struct {
+	nodes map[string]*node
+	order []string
+	edges []edge
+	err   error
+}
+
+// NewGraph creates an empty graph.
+func NewGraph() *Graph {
+	return &Graph{nodes: make(map[string]*node)}
+}
+
+// Source adds a node which only produces items, its `in` channel is nil.
+func (g *Graph) Source(name string, j job) *Graph {
+	return g.add(&node{name: name, kind: kindSource, job: j})
+}
+
+// Stage adds a node which reads items from its input and writes results to its output.
+func (g *Graph) Stage(name string, j job) *Graph {
+	return g.add(&node{name: name, kind: kindStage, job: j})
+}
+
+// Sink adds a node which only consumes items, anything it writes to `out` is discarded.
+func (g *Graph) Sink(name string, j job) *Graph {
+	return g.add(&node{name: name, kind: kindSink, job: j})
+}
+
+// Join adds a node with `left` and `right` input ports.
+// Every pair of items from different ports with equal keys is combined and sent to the output.
+// All items are kept in memory until both inputs are closed.
+func (g *Graph) Join(name string, left, right KeyFunc, combine JoinFunc) *Graph {
+	return g.add(&node{name: name, kind: kindJoin, key: [2]KeyFunc{left, right}, combine: combine})
+}
+
+// SetFanOut changes the way items of the named node are distributed between its downstream stages.
+// The default is `Broadcast`.
+func (g *Graph) SetFanOut(name string, mode FanOut) *Graph {
+	if g.err != nil {
+		return g
+	}
+	n, ok := g.nodes[name]
+	if !ok {
+		g.err = fmt.Errorf("unknown node %q", name)
+		return g
+	}
+	if mode != Broadcast && mode != RoundRobin {
+		g.err = fmt.Errorf("unknown fan-out mode %d for node %q", mode, name)
+		return g
+	}
+	n.fanOut = mode
+	return g
+}
+
+// Connect connects the output of `from` node with the `in` port of `to` node.
+func (g *Graph) Connect(from, to string) *Graph {
+	return g.ConnectPort(from, to, PortIn)
+}
+
+// ConnectPort connects the output of `from` node with the named input port of `to` node.
+func (g *Graph) ConnectPort(from, to, port string) *Graph {
+	if g.err != nil {
+		return g
+	}
+	src, ok := g.nodes[from]
+	if !ok {
+		g.err = fmt.Errorf("unknown node %q", from)
+		return g
+	}
+	dst, ok := g.nodes[to]
+	if !ok {
+		g.err = fmt.Errorf("unknown node %q", to)
+		return g
+	}
+	if !src.hasOutput() {
+		g.err = fmt.Errorf("node %q has no output", from)
+		return g
+	}
+	if !contains(dst.ports(), port) {
+		g.err = fmt.Errorf("node %q has no input port %q", to, port)
+		return g
+	}
+	for _, e := range g.edges {
+		if e.from == from && e.to == to && e.port == port {
+			g.err = fmt.Errorf("nodes %q and %q.%s are already connected", from, to, port)
+			return g
+		}
+	}
+	g.edges = append(g.edges, edge{from: from, to: to, port: port})
+	return g
+}
+
+// add registers new node in the graph.
+func (g *Graph) add(n *node) *Graph {
+	if g.err != nil {
+		return g
+	}
+	if n.name == "" {
+		g.err = errGraphNameInvalid
+		return g
+	}
+	if _, ok := g.nodes[n.name]; ok {
+		g.err = fmt.Errorf("duplicate node %q", n.name)
+		return g
+	}
+	// otherwise nil functions panic only when the graph runs, inside a goroutine
+	switch {
+	case n.kind != kindJoin && n.job == nil:
+		g.err = fmt.Errorf("node %q has no job", n.name)
+	case n.kind == kindJoin && n.key[0] == nil:
+		g.err = fmt.Errorf("join %q has no left key function", n.name)
+	case n.kind == kindJoin && n.key[1] == nil:
+		g.err = fmt.Errorf("join %q has no right key function", n.name)
+	case n.kind == kindJoin && n.combine == nil:
+		g.err = fmt.Errorf("join %q has no join function", n.name)
+	}
+	if g.err != nil {
+		return g
+	}
+	g.nodes[n.name] = n
+	g.order = append(g.order, n.name)
+	return g
+}
+
+// Validate checks that the graph is acyclic and that every input and output port is connected.
+func (g *Graph) Validate() error {
+	if g.err != nil {
+		return g.err
+	}
+	if len(g.nodes) == 0 {
+		return errGraphEmpty
+	}
+	hasOut := make(map[string]bool, len(g.nodes))
+	hasIn := make(map[string]bool, len(g.nodes))
+	for _, e := range g.edges {
+		hasOut[e.from] = true
+		hasIn[e.to+"."+e.port] = true
+	}
+	for _, name := range g.order {
+		n := g.nodes[name]
+		for _, port := range n.ports() {
+			if !hasIn[name+"."+port] {
+				return fmt.Errorf("input port %q of node %q is not connected", port, name)
+			}
+		}
+		if n.hasOutput() && !hasOut[name] {
+			return fmt.Errorf("output of node %q is not connected", name)
+		}
+	}
+	if _, err := g.sort(); err != nil {
+		return err
+	}
+	return nil
+}
+
+// sort returns node names in topological order or an error if the graph contains a cycle.
+func (g *Graph) sort() ([]string, error) {
+	degree := make(map[string]int, len(g.nodes))
+	for _, e := range g.edges {
+		degree[e.to]++
+	}
+	queue := make([]string, 0, len(g.nodes))
+	for _, name := range g.order {
+		if degree[name] == 0 {
+			queue = append(queue, name)
+		}
+	}
+	for i := 0; i < len(queue); i++ {
+		for _, e := range g.edges {
+			if e.from != queue[i] {
+				continue
+			}
+			if degree[e.to]--; degree[e.to] == 0 {
+				queue = append(queue, e.to)
+			}
+		}
+	}
+	if len(queue) != len(g.nodes) {
+		return nil, errGraphCycle
+	}
+	return queue, nil
+}
+
+// Run validates the graph, starts every node in its own goroutine and waits for all of them to finish.
+// Channels are buffered the same way as in `ExecutePipeline`.
+func (g *Graph) Run() error {
+	if err := g.Validate(); err != nil {
+		return err
+	}
+	wg := &sync.WaitGroup{}
+	inputs := make(map[string][]chan interface{}, len(g.edges))
+	outputs := make(map[string][]chan interface{}, len(g.nodes))
+	for _, e := range g.edges {
+		ch := make(chan interface{}, MaxInputDataLen)
+		inputs[e.to+"."+e.port] = append(inputs[e.to+"."+e.port], ch)
+		outputs[e.from] = append(outputs[e.from], ch)
+	}
+	for _, name := range g.order {
+		n := g.nodes[name]
+		var in [2]chan interface{}
+		for i, port := range n.ports() {
+			in[i] = merge(wg, inputs[name+"."+port])
+		}
+		out := make(chan interface{}, MaxInputDataLen)
+		if n.hasOutput() {
+			distribute(wg, out, outputs[name], n.fanOut)
+		} else {
+			discard(wg, out)
+		}
+		wg.Add(1)
+		go func(n *node, in [2]chan interface{}, out chan interface{}) {
+			defer wg.Done()
+			defer close(out)
+			if n.kind == kindJoin {
+				join(in[0], in[1], out, n.key, n.combine)
+				return
+			}
+			n.job(in[0], out)
+		}(n, in, out)
+	}
+	wg.Wait()
+	return nil
+}
+
+// merge returns the channel with items from all given channels, it is closed after all of them are closed.
+func merge(wg *sync.WaitGroup, chans []chan interface{}) chan interface{} {
+	if len(chans) == 1 {
+		return chans[0]
+	}
+	merged := make(chan interface{}, MaxInputDataLen)
+	wgm := &sync.WaitGroup{}
+	wgm.Add(len(chans))
+	for _, ch := range chans {
+		go func(ch chan interface{}) {
+			defer wgm.Done()
+			for val := range ch {
+				merged <- val
+			}
+		}(ch)
+	}
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		wgm.Wait()
+		close(merged)
+	}()
+	return merged
+}
+
+// distribute passes items from `out` to downstream channels and closes them when `out` is closed.
+func distribute(wg *sync.WaitGroup, out chan interface{}, chans []chan interface{}, mode FanOut) {
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		defer func() {
+			for _, ch := range chans {
+				close(ch)
+			}
+		}()
+		next := 0
+		for val := range out {
+			if mode == RoundRobin {
+				chans[next] <- val
+				next = (next + 1) % len(chans)
+				continue
+			}
+			for _, ch := range chans {
+				ch <- val
+			}
+		}
+	}()
+}
+
+// discard drains the output of a sink node.
+func discard(wg *sync.WaitGroup, out chan interface{}) {
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for range out {
+		}
+	}()
+}
+
+// join performs symmetric hash join of two input channels.
+// Every new item is matched against all items with the same key received so far from the other side.
+func join(left, right, out chan interface{}, key [2]KeyFunc, combine JoinFunc) {
+	seen := [2]map[interface{}][]interface{}{
+		make(map[interface{}][]interface{}),
+		make(map[interface{}][]interface{}),
+	}
+	in := [2]chan interface{}{left, right}
+	for in[0] != nil || in[1] != nil {
+		var (
+			val  interface{}
+			ok   bool
+			side int
+		)
+		select {
+		case val, ok = <-in[0]:
+			side = 0
+		case val, ok = <-in[1]:
+			side = 1
+		}
+		if !ok {
+			in[side] = nil
+			continue
+		}
+		k := key[side](val)
+		seen[side][k] = append(seen[side][k], val)
+		for _, other := range seen[1-side][k] {
+			if side == 0 {
+				out <- combine(val, other)
+			} else {
+				out <- combine(other, val)
+			}
+		}
+	}
+}
+
+// contains reports whether the string is present in the slice.
+func contains(list []string, str string) bool {
+	for _, item := range list {
+		if item == str {
+			return true
+		}
+	}
+	return false
+}
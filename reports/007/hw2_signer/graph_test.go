@@ -0,0 +1,257 @@
+package main
+
+import (
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// emit returns the job sending given values.
+func emit(vals ...interface{}) job {
+	return func(in, out chan interface{}) {
+		for _, val := range vals {
+			out <- val
+		}
+	}
+}
+
+// collector gathers items received by the sink nodes.
+type collector struct {
+	mu    sync.Mutex
+	items map[string][]string
+}
+
+// sink returns the job storing all received values under the given name.
+func (c *collector) sink(name string) job {
+	return func(in, out chan interface{}) {
+		for val := range in {
+			c.mu.Lock()
+			if c.items == nil {
+				c.items = make(map[string][]string)
+			}
+			c.items[name] = append(c.items[name], val.(string))
+			c.mu.Unlock()
+		}
+	}
+}
+
+// sorted returns sorted items received by the named sink.
+func (c *collector) sorted(name string) string {
+	res := append([]string(nil), c.items[name]...)
+	sort.Strings(res)
+	return strings.Join(res, ",")
+}
+
+func TestGraphBroadcast(t *testing.T) {
+	c := &collector{}
+	err := NewGraph().
+		Source("src", emit(1, 2, 3)).
+		Stage("str", func(in, out chan interface{}) {
+			for val := range in {
+				out <- strconv.Itoa(val.(int))
+			}
+		}).
+		Sink("a", c.sink("a")).
+		Sink("b", c.sink("b")).
+		Connect("src", "str").
+		Connect("str", "a").
+		Connect("str", "b").
+		Run()
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	for _, name := range []string{"a", "b"} {
+		if got := c.sorted(name); got != "1,2,3" {
+			t.Errorf("sink %s\nGot: %s\nExpected: %s", name, got, "1,2,3")
+		}
+	}
+}
+
+func TestGraphRoundRobin(t *testing.T) {
+	c := &collector{}
+	err := NewGraph().
+		Source("src", emit("1", "2", "3", "4")).
+		Sink("a", c.sink("a")).
+		Sink("b", c.sink("b")).
+		Connect("src", "a").
+		Connect("src", "b").
+		SetFanOut("src", RoundRobin).
+		Run()
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if got := c.sorted("a"); got != "1,3" {
+		t.Errorf("sink a\nGot: %s\nExpected: %s", got, "1,3")
+	}
+	if got := c.sorted("b"); got != "2,4" {
+		t.Errorf("sink b\nGot: %s\nExpected: %s", got, "2,4")
+	}
+}
+
+func TestGraphMerge(t *testing.T) {
+	c := &collector{}
+	err := NewGraph().
+		Source("a", emit("1", "2")).
+		Source("b", emit("3")).
+		Sink("all", c.sink("all")).
+		Connect("a", "all").
+		Connect("b", "all").
+		Run()
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if got := c.sorted("all"); got != "1,2,3" {
+		t.Errorf("Got: %s\nExpected: %s", got, "1,2,3")
+	}
+}
+
+func TestGraphJoin(t *testing.T) {
+	defer checkLeaks(t)()
+	c := &collector{}
+	type pair struct {
+		id  int
+		val string
+	}
+	key := func(val interface{}) interface{} { return val.(pair).id }
+	err := NewGraph().
+		Source("names", emit(pair{1, "one"}, pair{2, "two"}, pair{3, "three"})).
+		Source("digits", emit(pair{3, "3"}, pair{1, "1"}, pair{4, "4"}, pair{1, "I"})).
+		Join("join", key, key, func(left, right interface{}) interface{} {
+			return left.(pair).val + "=" + right.(pair).val
+		}).
+		Sink("res", c.sink("res")).
+		ConnectPort("names", "join", PortLeft).
+		ConnectPort("digits", "join", PortRight).
+		Connect("join", "res").
+		Run()
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if got, expected := c.sorted("res"), "one=1,one=I,three=3"; got != expected {
+		t.Errorf("Got: %s\nExpected: %s", got, expected)
+	}
+}
+
+func TestGraphSigner(t *testing.T) {
+	defer checkLeaks(t)()
+	clock, restore := useFakeClock(t, signerSchedule(2, true)...)
+	defer restore()
+	c := &collector{}
+	err := NewGraph().
+		Source("src", emit(0, 1)).
+		Stage("single", SingleHash).
+		Stage("multi", MultiHash).
+		Stage("combine", CombineResults).
+		Sink("res", c.sink("res")).
+		Connect("src", "single").
+		Connect("single", "multi").
+		Connect("multi", "combine").
+		Connect("combine", "res").
+		Run()
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	expected := "29568666068035183841425683795340791879727309630931025356555_4958044192186797981418233587017209679042592862002427381542"
+	if got := c.sorted("res"); got != expected {
+		t.Errorf("Got: %s\nExpected: %s", got, expected)
+	}
+	if end, expectedTime := clock.Now().Sub(time.Unix(0, 0)), 2020*time.Millisecond; end != expectedTime {
+		t.Errorf("execution time on virtual clock not match\nGot: %s\nExpected: %s", end, expectedTime)
+	}
+}
+
+func TestGraphValidate(t *testing.T) {
+	nop := func(in, out chan interface{}) {}
+	key := func(val interface{}) interface{} { return val }
+	combine := func(left, right interface{}) interface{} { return left }
+	cases := []struct {
+		Name  string
+		Graph *Graph
+		Error string
+	}{
+		{
+			Name:  "nil job",
+			Graph: NewGraph().Source("a", nil),
+			Error: `node "a" has no job`,
+		},
+		{
+			Name:  "nil left key",
+			Graph: NewGraph().Join("j", nil, key, combine),
+			Error: `join "j" has no left key function`,
+		},
+		{
+			Name:  "nil right key",
+			Graph: NewGraph().Join("j", key, nil, combine),
+			Error: `join "j" has no right key function`,
+		},
+		{
+			Name:  "nil join function",
+			Graph: NewGraph().Join("j", key, key, nil),
+			Error: `join "j" has no join function`,
+		},
+		{
+			Name:  "empty",
+			Graph: NewGraph(),
+			Error: "graph has no nodes",
+		},
+		{
+			Name:  "empty name",
+			Graph: NewGraph().Source("", nop),
+			Error: "node name is empty",
+		},
+		{
+			Name:  "duplicate",
+			Graph: NewGraph().Source("a", nop).Sink("a", nop),
+			Error: `duplicate node "a"`,
+		},
+		{
+			Name:  "unknown node",
+			Graph: NewGraph().Source("a", nop).Connect("a", "b"),
+			Error: `unknown node "b"`,
+		},
+		{
+			Name:  "unknown port",
+			Graph: NewGraph().Source("a", nop).Sink("b", nop).ConnectPort("a", "b", PortLeft),
+			Error: `node "b" has no input port "left"`,
+		},
+		{
+			Name:  "sink output",
+			Graph: NewGraph().Sink("a", nop).Sink("b", nop).Connect("a", "b"),
+			Error: `node "a" has no output`,
+		},
+		{
+			Name:  "unconnected output",
+			Graph: NewGraph().Source("a", nop).Stage("b", nop).Connect("a", "b"),
+			Error: `output of node "b" is not connected`,
+		},
+		{
+			Name: "unconnected join port",
+			Graph: NewGraph().Source("a", nop).Join("j", key, key, combine).Sink("s", nop).
+				ConnectPort("a", "j", PortLeft).Connect("j", "s"),
+			Error: `input port "right" of node "j" is not connected`,
+		},
+		{
+			Name: "cycle",
+			Graph: NewGraph().Source("a", nop).Stage("b", nop).Stage("c", nop).Sink("d", nop).
+				Connect("a", "b").Connect("b", "c").Connect("c", "b").Connect("c", "d"),
+			Error: "graph contains a cycle",
+		},
+	}
+	for _, tc := range cases {
+		t.Run(tc.Name, func(t *testing.T) {
+			err := tc.Graph.Validate()
+			if err == nil {
+				t.Fatalf("Error expected but not occured")
+			}
+			if err.Error() != tc.Error {
+				t.Errorf("Got: %s\nExpected: %s", err, tc.Error)
+			}
+			if err = tc.Graph.Run(); err == nil {
+				t.Errorf("Run started invalid graph")
+			}
+		})
+	}
+}
@@ -0,0 +1,195 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"sync"
+)
+
+// Step is a named per-item stage of the journaled pipeline.
+type Step struct {
+	Name string
+	Fn   func(data string) string
+}
+
+// SignerSteps are the per-item stages of the signer pipeline, `CombineResults` aggregates their output.
+var SignerSteps = DefaultRecipe.Steps()
+
+// journalEntry is a single line of the journal file.
+type journalEntry struct {
+	Item  int    `json:"item"`
+	Stage string `json:"stage"`
+	Value string `json:"value"`
+}
+
+// journalKey identifies the stage completion of an item.
+type journalKey struct {
+	item  int
+	stage string
+}
+
+// Journal is an append-only log recording per-item stage completion.
+// Every line of the file is a JSON object with the item index, stage name and stage result.
+type Journal struct {
+	mu   sync.Mutex
+	f    *os.File
+	done map[journalKey]string
+}
+
+// OpenJournal opens the journal file creating it if necessary.
+// In resume mode completed stages are loaded from the file and a torn last line left by a crash is cut off,
+// otherwise the file is truncated.
+func OpenJournal(path string, resume bool) (*Journal, error) {
+	flags := os.O_RDWR | os.O_CREATE
+	if !resume {
+		flags |= os.O_TRUNC
+	}
+	f, err := os.OpenFile(path, flags, 0644)
+	if err != nil {
+		return nil, err
+	}
+	j := &Journal{f: f, done: make(map[journalKey]string)}
+	if resume {
+		if err = j.load(); err != nil {
+			f.Close()
+			return nil, err
+		}
+	}
+	return j, nil
+}
+
+// load reads completed stages from the journal and positions the file at the end of the last complete line.
+func (j *Journal) load() error {
+	r := bufio.NewReader(j.f)
+	var offset int64
+	for line := 1; ; line++ {
+		data, err := r.ReadBytes('\n')
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return err
+		}
+		entry := journalEntry{}
+		if err = json.Unmarshal(bytes.TrimSpace(data), &entry); err != nil {
+			return fmt.Errorf("journal line %d: %s", line, err)
+		}
+		j.done[journalKey{entry.Item, entry.Stage}] = entry.Value
+		offset += int64(len(data))
+	}
+	if err := j.f.Truncate(offset); err != nil {
+		return err
+	}
+	_, err := j.f.Seek(offset, io.SeekStart)
+	return err
+}
+
+// Close closes the journal file.
+func (j *Journal) Close() error {
+	return j.f.Close()
+}
+
+// Lookup returns the recorded result of the item stage.
+func (j *Journal) Lookup(item int, stage string) (string, bool) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	value, ok := j.done[journalKey{item, stage}]
+	return value, ok
+}
+
+// Record appends the result of the item stage to the journal and flushes it to disk.
+func (j *Journal) Record(item int, stage, value string) error {
+	data, err := json.Marshal(journalEntry{Item: item, Stage: stage, Value: value})
+	if err != nil {
+		return err
+	}
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	if _, err = j.f.Write(append(data, '\n')); err != nil {
+		return err
+	}
+	if err = j.f.Sync(); err != nil {
+		return err
+	}
+	j.done[journalKey{item, stage}] = value
+	return nil
+}
+
+// journaledItem travels through the journaled pipeline, `Done` is the number of completed steps.
+type journaledItem struct {
+	Item  int
+	Done  int
+	Value string
+}
+
+// ExecuteJournaled runs the steps over input values recording every completed step in the journal,
+// results of the last step are passed to the `tail` jobs (e.g. `CombineResults`).
+// Items with steps already present in the journal skip them and continue from the recorded result,
+// so the journal must be resumed with the same input and steps.
+// The first journal error is returned after the pipeline finishes, items which failed to record are dropped.
+func ExecuteJournaled(j *Journal, input []string, steps []Step, tail ...job) error {
+	var (
+		errMu    sync.Mutex
+		firstErr error
+	)
+	fail := func(err error) {
+		errMu.Lock()
+		if firstErr == nil {
+			firstErr = err
+		}
+		errMu.Unlock()
+	}
+	jobs := make([]job, 0, len(steps)+len(tail)+2)
+	jobs = append(jobs, func(in, out chan interface{}) {
+		for i, val := range input {
+			item := journaledItem{Item: i, Value: val}
+			for k := len(steps) - 1; k >= 0; k-- {
+				if value, ok := j.Lookup(i, steps[k].Name); ok {
+					item.Done, item.Value = k+1, value
+					break
+				}
+			}
+			out <- item
+		}
+	})
+	for k, s := range steps {
+		jobs = append(jobs, journaledStep(j, k, s, fail))
+	}
+	jobs = append(jobs, func(in, out chan interface{}) {
+		for val := range in {
+			out <- val.(journaledItem).Value
+		}
+	})
+	jobs = append(jobs, tail...)
+	ExecutePipeline(jobs...)
+	return firstErr
+}
+
+// journaledStep wraps the step into a job which skips items that already passed it.
+func journaledStep(j *Journal, k int, s Step, fail func(error)) job {
+	return func(in, out chan interface{}) {
+		wg := &sync.WaitGroup{}
+		for val := range in {
+			item := val.(journaledItem)
+			if item.Done > k {
+				out <- item
+				continue
+			}
+			wg.Add(1)
+			go func(item journaledItem) {
+				defer wg.Done()
+				item.Value, item.Done = s.Fn(item.Value), k+1
+				if err := j.Record(item.Item, s.Name, item.Value); err != nil {
+					fail(err)
+					return
+				}
+				out <- item
+			}(item)
+		}
+		wg.Wait()
+	}
+}
@@ -0,0 +1,185 @@
+package main
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+const (
+	journalEnv      = "SIGNER_JOURNAL"
+	journalExpected = "1173136728138862632818075107442090076184424490584241521304_1696913515191343735512658979631549563179965036907783101867_27225454331033649287118297354036464389062965355426795162684_29568666068035183841425683795340791879727309630931025356555_3994492081516972096677631278379039212655368881548151736_4958044192186797981418233587017209679042592862002427381542_4958044192186797981418233587017209679042592862002427381542"
+)
+
+var journalInput = []string{"0", "1", "1", "2", "3", "5", "8"}
+
+// countSigners wraps the data signers with call counters, the returned function restores them.
+func countSigners(md5Calls, crc32Calls *uint32) func() {
+	md5, crc32 := DataSignerMd5, DataSignerCrc32
+	DataSignerMd5 = func(data string) string {
+		atomic.AddUint32(md5Calls, 1)
+		return md5(data)
+	}
+	DataSignerCrc32 = func(data string) string {
+		atomic.AddUint32(crc32Calls, 1)
+		return crc32(data)
+	}
+	return func() {
+		DataSignerMd5, DataSignerCrc32 = md5, crc32
+	}
+}
+
+// runJournaled executes the signer pipeline over `journalInput` and returns combined result.
+func runJournaled(t *testing.T, path string, resume bool) string {
+	j, err := OpenJournal(path, resume)
+	if err != nil {
+		t.Fatalf("cant open journal: %s", err)
+	}
+	defer j.Close()
+	result := "NOT_SET"
+	err = ExecuteJournaled(j, journalInput, SignerSteps, CombineResults, func(in, out chan interface{}) {
+		result = (<-in).(string)
+	})
+	if err != nil {
+		t.Fatalf("pipeline failed: %s", err)
+	}
+	return result
+}
+
+// TestJournalHelperProcess is not a real test, it runs the journaled pipeline in a child process
+// which is killed midway by TestJournalCrashRecovery.
+func TestJournalHelperProcess(t *testing.T) {
+	path := os.Getenv(journalEnv)
+	if path == "" {
+		return
+	}
+	runJournaled(t, path, false)
+}
+
+func TestJournalCrashRecovery(t *testing.T) {
+	dir, err := ioutil.TempDir("", "journal")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "signer.journal")
+
+	cmd := exec.Command(os.Args[0], "-test.run=^TestJournalHelperProcess$")
+	cmd.Env = append(os.Environ(), journalEnv+"="+path)
+	if err = cmd.Start(); err != nil {
+		t.Fatal(err)
+	}
+	// all SingleHash results are recorded after ~1s, MultiHash ones need one more second
+	deadline := time.Now().Add(10 * time.Second)
+	for {
+		data, _ := ioutil.ReadFile(path)
+		if bytes.Count(data, []byte("\n")) >= len(journalInput) {
+			break
+		}
+		if time.Now().After(deadline) {
+			cmd.Process.Kill()
+			t.Fatalf("journal was not written in time")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	if err = cmd.Process.Kill(); err != nil {
+		t.Fatal(err)
+	}
+	cmd.Wait()
+
+	// only MultiHash of all items is left
+	clock, restore := useFakeClock(t, 6*len(journalInput))
+	defer restore()
+	var md5Calls, crc32Calls uint32
+	defer countSigners(&md5Calls, &crc32Calls)()
+	start := clock.Now()
+	result := runJournaled(t, path, true)
+	end := clock.Now().Sub(start)
+
+	if result != journalExpected {
+		t.Errorf("results not match\nGot: %v\nExpected: %v", result, journalExpected)
+	}
+	if md5Calls != 0 {
+		t.Errorf("SingleHash was repeated after resume, md5 calls: %d", md5Calls)
+	}
+	if int(crc32Calls) > len(journalInput)*6 {
+		t.Errorf("too many crc32 calls after resume\nGot: %d\nExpected: <=%d", crc32Calls, len(journalInput)*6)
+	}
+	// only MultiHash of all items is left
+	if expectedTime := time.Second; end != expectedTime {
+		t.Errorf("resume time on virtual clock not match\nGot: %s\nExpected: %s", end, expectedTime)
+	}
+}
+
+func TestJournalResumeCompleted(t *testing.T) {
+	dir, err := ioutil.TempDir("", "journal")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "signer.journal")
+
+	_, restore := useFakeClock(t, signerSchedule(len(journalInput), true)...)
+	defer restore()
+	if result := runJournaled(t, path, false); result != journalExpected {
+		t.Fatalf("results not match\nGot: %v\nExpected: %v", result, journalExpected)
+	}
+
+	// torn line left by a crash in the middle of a write is cut off
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	f.WriteString(`{"item":0,"stage":"Mul`)
+	f.Close()
+
+	var md5Calls, crc32Calls uint32
+	defer countSigners(&md5Calls, &crc32Calls)()
+	if result := runJournaled(t, path, true); result != journalExpected {
+		t.Errorf("results not match\nGot: %v\nExpected: %v", result, journalExpected)
+	}
+	if md5Calls != 0 || crc32Calls != 0 {
+		t.Errorf("completed items were recalculated, md5 calls: %d, crc32 calls: %d", md5Calls, crc32Calls)
+	}
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if lines := bytes.Count(data, []byte("\n")); lines != len(journalInput)*len(SignerSteps) || !bytes.HasSuffix(data, []byte("\n")) {
+		t.Errorf("torn line was not removed, journal:\n%s", data)
+	}
+}
+
+func TestJournalCorrupted(t *testing.T) {
+	dir, err := ioutil.TempDir("", "journal")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "signer.journal")
+	if err = ioutil.WriteFile(path, []byte("{}\nnot json\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = OpenJournal(path, true); err == nil || err.Error() != "journal line 2: invalid character 'o' in literal null (expecting 'u')" {
+		t.Errorf("unexpected error: %v", err)
+	}
+	j, err := OpenJournal(path, false)
+	if err != nil {
+		t.Fatalf("cant truncate journal: %s", err)
+	}
+	defer j.Close()
+	if _, ok := j.Lookup(0, ""); ok {
+		t.Errorf("truncated journal has entries")
+	}
+	if err = j.Record(1, "SingleHash", "42"); err != nil {
+		t.Fatal(err)
+	}
+	if value, ok := j.Lookup(1, "SingleHash"); !ok || value != "42" {
+		t.Errorf("Got: %q\nExpected: %q", value, "42")
+	}
+}
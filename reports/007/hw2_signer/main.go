@@ -0,0 +1,94 @@
+package main
+
+import (
+	"bufio"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"time"
+)
+
+// run signs every non-empty line of `stdin` with the configured recipe and prints the combined signature.
+func run(args []string, stdin io.Reader, stdout io.Writer) error {
+	fs := flag.NewFlagSet("signer", flag.ContinueOnError)
+	var (
+		single = fs.String("single", "crc32~crc32(md5)", "`~` separated SingleHash chains, e.g. crc32(md5)")
+		multi  = fs.String("multi", "crc32", "MultiHash chain")
+		rounds = fs.Int("rounds", 6, "number of MultiHash rounds")
+		salt   = fs.String("salt", "", "salt appended to data (key for hmac-sha256)")
+		list   = fs.Bool("list", false, "list registered signers and exit")
+		coord  = fs.String("coordinator", "", "listen on the address and offload MultiHash to remote workers")
+		wait   = fs.Duration("patience", time.Minute, "how long the coordinator waits for a worker while none is connected")
+		worker = fs.String("worker", "", "serve as a remote worker of the coordinator at the address")
+		slots  = fs.Int("capacity", MaxInputDataLen, "number of tasks the remote worker calculates concurrently")
+		budget = fs.Int("goroutines", 0, "goroutine budget of the hash scheduler, 0 means the default one")
+	)
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if *list {
+		_, err := fmt.Fprintln(stdout, strings.Join(SignerNames(), "\n"))
+		return err
+	}
+	r, err := ParseRecipe(*single, *multi, *rounds)
+	if err != nil {
+		return err
+	}
+	r = r.WithSalt(*salt)
+	if *budget > 0 {
+		r.Scheduler = NewScheduler(*budget)
+	}
+	if *worker != "" {
+		return ServeWorker(*worker, r.Steps(), *slots)
+	}
+	multiHash := r.MultiHash
+	var remoteErr func() error
+	if *coord != "" {
+		c, err := NewCoordinator(*coord, "MultiHash")
+		if err != nil {
+			return err
+		}
+		defer c.Close()
+		c.Patience = *wait
+		multiHash, remoteErr = c.Job, c.Err
+	}
+
+	var readErr, writeErr error
+	ExecutePipeline(
+		func(in, out chan interface{}) {
+			s := bufio.NewScanner(stdin)
+			for s.Scan() {
+				if line := strings.TrimSpace(s.Text()); line != "" {
+					out <- line
+				}
+			}
+			readErr = s.Err()
+		},
+		r.SingleHash,
+		multiHash,
+		CombineResults,
+		func(in, out chan interface{}) {
+			_, writeErr = fmt.Fprintln(stdout, <-in)
+		},
+	)
+	if readErr != nil {
+		return readErr
+	}
+	if remoteErr != nil {
+		if err := remoteErr(); err != nil {
+			return err
+		}
+	}
+	return writeErr
+}
+
+func main() {
+	if err := run(os.Args[1:], os.Stdin, os.Stdout); err != nil {
+		if err != flag.ErrHelp {
+			fmt.Fprintln(os.Stderr, err)
+		}
+		os.Exit(2)
+	}
+}
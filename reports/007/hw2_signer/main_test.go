@@ -46,6 +46,7 @@ func TestPipeline(t *testing.T) {
 }
 
 func TestSigner(t *testing.T) {
+	defer checkLeaks(t)()
 
 	testExpected := "1173136728138862632818075107442090076184424490584241521304_1696913515191343735512658979631549563179965036907783101867_27225454331033649287118297354036464389062965355426795162684_29568666068035183841425683795340791879727309630931025356555_3994492081516972096677631278379039212655368881548151736_4958044192186797981418233587017209679042592862002427381542_4958044192186797981418233587017209679042592862002427381542"
 	testResult := "NOT_SET"
@@ -65,7 +66,7 @@ func TestSigner(t *testing.T) {
 		for {
 			if swapped := atomic.CompareAndSwapUint32(&dataSignerOverheat, 0, 1); !swapped {
 				fmt.Println("OverheatLock happend")
-				time.Sleep(time.Second)
+				SignerClock.Sleep(time.Second)
 			} else {
 				break
 			}
@@ -76,7 +77,7 @@ func TestSigner(t *testing.T) {
 		for {
 			if swapped := atomic.CompareAndSwapUint32(&dataSignerOverheat, 1, 0); !swapped {
 				fmt.Println("OverheatUnlock happend")
-				time.Sleep(time.Second)
+				SignerClock.Sleep(time.Second)
 			} else {
 				break
 			}
@@ -88,7 +89,7 @@ func TestSigner(t *testing.T) {
 		defer OverheatUnlock()
 		data += DataSignerSalt
 		dataHash := fmt.Sprintf("%x", md5.Sum([]byte(data)))
-		time.Sleep(10 * time.Millisecond)
+		SignerClock.Sleep(10 * time.Millisecond)
 		return dataHash
 	}
 	DataSignerCrc32 = func(data string) string {
@@ -96,13 +97,19 @@ func TestSigner(t *testing.T) {
 		data += DataSignerSalt
 		crcH := crc32.ChecksumIEEE([]byte(data))
 		dataHash := strconv.FormatUint(uint64(crcH), 10)
-		time.Sleep(time.Second)
+		SignerClock.Sleep(time.Second)
 		return dataHash
 	}
 
 	inputData := []int{0, 1, 1, 2, 3, 5, 8}
 	// inputData := []int{0,1}
 
+	// расчеты идут на виртуальном времени, оно сдвигается когда ожидаемое число вычислений ждет часов
+	clock, restoreClock := useFakeClock(t, signerSchedule(len(inputData), true)...)
+	defer restoreClock()
+
+	start := clock.Now()
+	singleDone := make([]time.Duration, 0, len(inputData))
 	hashSignJobs := []job{
 		job(func(in, out chan interface{}) {
 			for _, fibNum := range inputData {
@@ -110,6 +117,12 @@ func TestSigner(t *testing.T) {
 			}
 		}),
 		job(SingleHash),
+		job(func(in, out chan interface{}) {
+			for val := range in {
+				singleDone = append(singleDone, clock.Now().Sub(start))
+				out <- val
+			}
+		}),
 		job(MultiHash),
 		job(CombineResults),
 		job(func(in, out chan interface{}) {
@@ -122,20 +135,27 @@ func TestSigner(t *testing.T) {
 		}),
 	}
 
-	start := time.Now()
-
 	ExecutePipeline(hashSignJobs...)
 
-	end := time.Since(start)
+	end := clock.Now().Sub(start)
 
-	expectedTime := 3 * time.Second
+	// md5 считается по очереди по 10 мс, после него crc32 еще 1 сек, MultiHash - еще 1 сек
+	expectedTime := 2*time.Second + time.Duration(len(inputData))*10*time.Millisecond
+	expectedSingle := make([]time.Duration, len(inputData))
+	for i := range expectedSingle {
+		expectedSingle[i] = time.Second + time.Duration(i+1)*10*time.Millisecond
+	}
 
 	if testExpected != testResult {
 		t.Errorf("results not match\nGot: %v\nExpected: %v", testResult, testExpected)
 	}
 
-	if end > expectedTime {
-		t.Errorf("execition too long\nGot: %s\nExpected: <%s", end, time.Second*3)
+	if end != expectedTime {
+		t.Errorf("execution time on virtual clock not match\nGot: %s\nExpected: %s", end, expectedTime)
+	}
+
+	if fmt.Sprint(singleDone) != fmt.Sprint(expectedSingle) {
+		t.Errorf("SingleHash schedule not match\nGot: %v\nExpected: %v", singleDone, expectedSingle)
 	}
 
 	// 8 потому что 2 в SingleHash и 6 в MultiHash
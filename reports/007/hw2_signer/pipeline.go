@@ -0,0 +1,249 @@
+package main
+
+import (
+	"sync"
+	"time"
+)
+
+// Unfinished is an item which did not pass the whole pipeline because it was stopped.
+// `Stage` is the index of the job the item was going to, `Value` is the item as it was produced by the previous job.
+// If `Consumed` is set, the job took the item but had not emitted a result for it when `Stop` returned.
+type Unfinished struct {
+	Stage    int
+	Value    interface{}
+	Consumed bool
+}
+
+// Pipeline is a handle of the running chain of jobs created by `Start`.
+type Pipeline struct {
+	stop      chan interface{}
+	drain     chan struct{}
+	abort     chan struct{}
+	done      chan struct{}
+	drainOnce sync.Once
+	abortOnce sync.Once
+
+	mu         sync.Mutex
+	unfinished []Unfinished
+	loads      []stageLoad
+}
+
+// stageLoad tracks the items a job took but has not emitted results for.
+// As the job may reorder or transform items, they can't be matched with the results,
+// so `items` holds everything taken since the job last emitted as many items as it took.
+type stageLoad struct {
+	taken, emitted int
+	items          []interface{}
+	returned       bool
+}
+
+// Start runs the chain of jobs the same way as `ExecutePipeline` does but returns immediately.
+// Jobs are connected through relays which allow to stop the flow of items:
+// the first relay stops accepting items produced by the first job on `Drain`,
+// all of them stop forwarding items on abort by `Stop`.
+// The first job is not waited for, so it may be infinite. Its `in` channel is closed on `Drain`
+// and the job should return then, otherwise it blocks as soon as its output buffer is full.
+func Start(jobs ...job) *Pipeline {
+	p := &Pipeline{
+		stop:  make(chan interface{}),
+		drain: make(chan struct{}),
+		abort: make(chan struct{}),
+		done:  make(chan struct{}),
+		loads: make([]stageLoad, len(jobs)),
+	}
+	wg := &sync.WaitGroup{}
+	prev := p.stop
+	for i, j := range jobs {
+		in := prev
+		if i > 0 {
+			in = make(chan interface{})
+			if i == 1 {
+				go p.gate(prev, in, len(jobs))
+			} else {
+				wg.Add(1)
+				go p.relay(wg, i, len(jobs), prev, in)
+			}
+		}
+		out := make(chan interface{}, MaxInputDataLen)
+		if i > 0 || len(jobs) == 1 {
+			wg.Add(1)
+		}
+		go func(i int, in, out chan interface{}, j job) {
+			if i > 0 || len(jobs) == 1 {
+				defer wg.Done()
+			}
+			defer close(out)
+			defer p.returned(i)
+			j(in, out)
+		}(i, in, out, j)
+		prev = out
+	}
+	go func() {
+		wg.Wait()
+		close(p.done)
+	}()
+	return p
+}
+
+// Drain stops accepting new items from the first job, signals it to return by closing its input
+// and lets the others finish the items in flight.
+// Items which the first job produces after that are discarded and not reported.
+func (p *Pipeline) Drain() {
+	p.drainOnce.Do(func() {
+		close(p.drain)
+		close(p.stop)
+	})
+}
+
+// Stop drains the pipeline and waits for it to finish until the deadline measured by `SignerClock`.
+// If it is not finished by then, relays stop forwarding items and Stop returns at once with the items
+// recorded so far and the items consumed by the jobs which are still running, see `Unfinished`.
+// Items reaching relays later are recorded as well and are reported by `Wait`.
+func (p *Pipeline) Stop(timeout time.Duration) []Unfinished {
+	p.Drain()
+	timer := SignerClock.NewTimer(timeout)
+	defer timer.Stop()
+	select {
+	case <-p.done:
+		return p.Wait()
+	case <-timer.C():
+	}
+	p.abortOnce.Do(func() {
+		close(p.abort)
+	})
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	unfinished := append([]Unfinished(nil), p.unfinished...)
+	for stage, load := range p.loads {
+		if load.returned {
+			continue
+		}
+		for _, val := range load.items {
+			unfinished = append(unfinished, Unfinished{Stage: stage, Value: val, Consumed: true})
+		}
+	}
+	return unfinished
+}
+
+// Wait blocks until all jobs except the first one return and reports the items which were not completed.
+func (p *Pipeline) Wait() []Unfinished {
+	<-p.done
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.unfinished
+}
+
+// gate passes items from the first job to the second one until the pipeline is drained.
+// The item which is taken from the first job but not accepted by the second one yet is reported as unfinished.
+func (p *Pipeline) gate(from, to chan interface{}, jobs int) {
+	defer close(to)
+	for {
+		select {
+		case <-p.drain:
+			return
+		case val, ok := <-from:
+			if !ok {
+				return
+			}
+			p.took(1, jobs, val)
+			select {
+			case to <- val:
+			case <-p.drain:
+				p.untook(1, jobs)
+				p.record(1, val)
+				return
+			}
+		}
+	}
+}
+
+// relay passes items to the job with the given index until the pipeline is aborted.
+// After that it closes the input of the job and records all the rest items as unfinished.
+func (p *Pipeline) relay(wg *sync.WaitGroup, stage, jobs int, from, to chan interface{}) {
+	defer wg.Done()
+	for {
+		select {
+		case <-p.abort:
+		case val, ok := <-from:
+			if !ok {
+				close(to)
+				return
+			}
+			p.emitted(stage - 1)
+			select {
+			case <-p.abort:
+			default:
+				p.took(stage, jobs, val)
+				select {
+				case to <- val:
+					continue
+				case <-p.abort:
+					p.untook(stage, jobs)
+				}
+			}
+			p.record(stage, val)
+		}
+		break
+	}
+	close(to)
+	for val := range from {
+		p.emitted(stage - 1)
+		p.record(stage, val)
+	}
+}
+
+// record adds the item to the list of unfinished ones.
+func (p *Pipeline) record(stage int, val interface{}) {
+	p.mu.Lock()
+	p.unfinished = append(p.unfinished, Unfinished{Stage: stage, Value: val})
+	p.mu.Unlock()
+}
+
+// took accounts the item passed to the job, it is called before the item is sent so that the result can't outrun it.
+// The last job is a sink which emits nothing, so it is not tracked.
+func (p *Pipeline) took(stage, jobs int, val interface{}) {
+	if stage == jobs-1 {
+		return
+	}
+	p.mu.Lock()
+	load := &p.loads[stage]
+	load.taken++
+	if load.emitted < load.taken {
+		load.items = append(load.items, val)
+	}
+	p.mu.Unlock()
+}
+
+// untook reverts `took` for the item which was not sent, it is the last one taken as every job has a single feeder.
+func (p *Pipeline) untook(stage, jobs int) {
+	if stage == jobs-1 {
+		return
+	}
+	p.mu.Lock()
+	load := &p.loads[stage]
+	load.taken--
+	if len(load.items) > 0 {
+		load.items = load.items[:len(load.items)-1]
+	}
+	p.mu.Unlock()
+}
+
+// emitted accounts the item produced by the job.
+func (p *Pipeline) emitted(stage int) {
+	p.mu.Lock()
+	load := &p.loads[stage]
+	load.emitted++
+	if load.emitted >= load.taken {
+		load.items = nil
+	}
+	p.mu.Unlock()
+}
+
+// returned marks the job as finished, all the items it took are accounted by then.
+func (p *Pipeline) returned(stage int) {
+	p.mu.Lock()
+	p.loads[stage].returned = true
+	p.loads[stage].items = nil
+	p.mu.Unlock()
+}
@@ -0,0 +1,226 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// counter returns infinite source of increasing numbers which stops when its input is closed.
+func counter(in, out chan interface{}) {
+	for i := 0; ; i++ {
+		select {
+		case out <- i:
+		case <-in:
+			return
+		}
+	}
+}
+
+// formatUnfinished formats the items as sorted "stage:value", consumed ones are marked with "*".
+func formatUnfinished(unfinished []Unfinished) string {
+	got := make([]string, 0, len(unfinished))
+	for _, u := range unfinished {
+		item := fmt.Sprintf("%d:%v", u.Stage, u.Value)
+		if u.Consumed {
+			item += "*"
+		}
+		got = append(got, item)
+	}
+	sort.Strings(got)
+	return fmt.Sprint(got)
+}
+
+func TestStartWait(t *testing.T) {
+	defer checkLeaks(t)()
+	res := &collector{}
+	p := Start(
+		emit(1, 2, 3),
+		func(in, out chan interface{}) {
+			for val := range in {
+				out <- fmt.Sprint(val.(int) * 3)
+			}
+		},
+		res.sink("res"),
+	)
+	if unfinished := p.Wait(); unfinished != nil {
+		t.Errorf("unexpected unfinished items: %v", unfinished)
+	}
+	if got := res.sorted("res"); got != "3,6,9" {
+		t.Errorf("Got: %s\nExpected: %s", got, "3,6,9")
+	}
+}
+
+func TestPipelineDrain(t *testing.T) {
+	defer checkLeaks(t)()
+	var received []int
+	p := Start(
+		counter,
+		func(in, out chan interface{}) {
+			for val := range in {
+				time.Sleep(time.Millisecond)
+				out <- val
+			}
+		},
+		func(in, out chan interface{}) {
+			for val := range in {
+				received = append(received, val.(int))
+			}
+		},
+	)
+	time.Sleep(50 * time.Millisecond)
+	p.Drain()
+	unfinished := p.Wait()
+	if len(unfinished) > 1 || (len(unfinished) == 1 && unfinished[0].Stage != 1) {
+		t.Errorf("only the item held by the gate may be unfinished, got: %v", unfinished)
+	}
+	if len(received) == 0 {
+		t.Fatalf("no items completed before drain")
+	}
+	for i, val := range received {
+		if val != i {
+			t.Fatalf("accepted item %d was not completed, got %d instead", i, val)
+		}
+	}
+}
+
+func TestPipelineStop(t *testing.T) {
+	defer checkLeaks(t)()
+	var (
+		mu       sync.Mutex
+		received []string
+	)
+	p := Start(
+		emit(0, 1, 2, 3, 4),
+		func(in, out chan interface{}) {
+			wg := &sync.WaitGroup{}
+			for val := range in {
+				wg.Add(1)
+				go func(val int) {
+					defer wg.Done()
+					if val%2 == 1 {
+						time.Sleep(200 * time.Millisecond)
+					}
+					out <- fmt.Sprint(val)
+				}(val.(int))
+			}
+			wg.Wait()
+		},
+		func(in, out chan interface{}) {
+			for val := range in {
+				out <- val.(string) + "!"
+			}
+		},
+		func(in, out chan interface{}) {
+			for val := range in {
+				mu.Lock()
+				received = append(received, val.(string))
+				mu.Unlock()
+			}
+		},
+	)
+	time.Sleep(50 * time.Millisecond)
+	start := time.Now()
+	unfinished := p.Stop(50 * time.Millisecond)
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("stop took too long: %s", elapsed)
+	}
+
+	mu.Lock()
+	sort.Strings(received)
+	if got := fmt.Sprint(received); got != "[0! 2! 4!]" {
+		t.Errorf("completed items\nGot: %s\nExpected: %s", got, "[0! 2! 4!]")
+	}
+	mu.Unlock()
+	// odd items are still processed by the first stage, and which of them it has finished is unknown
+	consumed := map[interface{}]bool{}
+	for _, u := range unfinished {
+		if u.Stage != 1 || !u.Consumed {
+			t.Errorf("unexpected unfinished item at stop: %+v", u)
+		}
+		consumed[u.Value] = true
+	}
+	if !consumed[1] || !consumed[3] {
+		t.Errorf("consumed items\nGot: %s\nExpected: 1 and 3 among them", formatUnfinished(unfinished))
+	}
+	// results received after the stop are not passed downstream
+	if got := formatUnfinished(p.Wait()); got != "[2:1 2:3]" {
+		t.Errorf("unfinished items\nGot: %v\nExpected: %s", got, "[2:1 2:3]")
+	}
+}
+
+func TestPipelineStopStuck(t *testing.T) {
+	defer checkLeaks(t)()
+	stuck := make(chan struct{})
+	p := Start(
+		emit(1, 2, 3),
+		func(in, out chan interface{}) {
+			for val := range in {
+				<-stuck
+				out <- val
+			}
+		},
+		func(in, out chan interface{}) {
+			for range in {
+			}
+		},
+	)
+	time.Sleep(20 * time.Millisecond)
+	clock, restore := useFakeClock(t)
+	defer restore()
+	stopped := make(chan []Unfinished)
+	go func() {
+		stopped <- p.Stop(time.Minute)
+	}()
+	// the deadline timer of Stop
+	for clock.Sleepers() != 1 {
+		time.Sleep(time.Millisecond)
+	}
+	select {
+	case <-stopped:
+		t.Fatalf("stop returned before the deadline")
+	case <-time.After(10 * time.Millisecond):
+	}
+	clock.Advance(time.Minute)
+	unfinished := <-stopped
+	if got := formatUnfinished(unfinished); got != "[1:1* 1:2]" {
+		t.Errorf("unfinished items\nGot: %s\nExpected: %s", got, "[1:1* 1:2]")
+	}
+	close(stuck)
+	if got := formatUnfinished(p.Wait()); got != "[1:2 2:1]" {
+		t.Errorf("unfinished items after the job is unstuck\nGot: %s\nExpected: %s", got, "[1:2 2:1]")
+	}
+}
+
+func TestPipelineStopInTime(t *testing.T) {
+	defer checkLeaks(t)()
+	res := &collector{}
+	p := Start(emit("a", "b"), res.sink("res"))
+	unfinished := p.Stop(time.Second)
+	// an item taken by the first relay before the stop is not lost
+	items := res.items["res"]
+	for _, u := range unfinished {
+		if u.Stage != 1 {
+			t.Errorf("item reported at stage %d after graceful stop", u.Stage)
+		}
+		items = append(items, u.Value.(string))
+	}
+	if got := strings.Join(items, ","); got != "a,b" && got != "a" && got != "" {
+		t.Errorf("items lost or reordered: %s", got)
+	}
+}
+
+func TestPipelineSingleJob(t *testing.T) {
+	done := false
+	p := Start(func(in, out chan interface{}) {
+		time.Sleep(10 * time.Millisecond)
+		done = true
+	})
+	p.Wait()
+	if !done {
+		t.Errorf("the only job was not waited for")
+	}
+}
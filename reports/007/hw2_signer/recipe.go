@@ -0,0 +1,251 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+)
+
+// Chain applies signers one after another, the result of each signer is the input of the next one.
+type Chain []Signer
+
+// Sign calculates the signature of data by the whole chain.
+func (c Chain) Sign(data string) string {
+	for _, s := range c {
+		data = s.Sign(data)
+	}
+	return data
+}
+
+// WithSalt returns the copy of the chain with the salt bound to every `SaltedSigner`.
+func (c Chain) WithSalt(salt string) Chain {
+	res := make(Chain, len(c))
+	for i, s := range c {
+		res[i] = bindSalt(s, salt)
+	}
+	return res
+}
+
+// String returns the chain in the same notation as accepted by `ParseChain`.
+func (c Chain) String() string {
+	res := ""
+	for i, s := range c {
+		if i == 0 {
+			res = s.Name()
+		} else {
+			res = s.Name() + "(" + res + ")"
+		}
+	}
+	return res
+}
+
+// ParseChain parses the chain written as nested calls of registered signers, e.g. `crc32(md5)`.
+// The innermost signer is applied first.
+func ParseChain(spec string) (Chain, error) {
+	spec = strings.TrimSpace(spec)
+	i := strings.IndexByte(spec, '(')
+	if i < 0 {
+		s, err := LookupSigner(spec)
+		if err != nil {
+			return nil, err
+		}
+		return Chain{s}, nil
+	}
+	if !strings.HasSuffix(spec, ")") {
+		return nil, fmt.Errorf("unbalanced parentheses in %q", spec)
+	}
+	inner, err := ParseChain(spec[i+1 : len(spec)-1])
+	if err != nil {
+		return nil, err
+	}
+	s, err := LookupSigner(strings.TrimSpace(spec[:i]))
+	if err != nil {
+		return nil, err
+	}
+	return append(inner, s), nil
+}
+
+// Recipe describes how `SingleHash` and `MultiHash` compose the signers.
+// `SingleHash` joins the results of all `Single` chains with `~`,
+// `MultiHash` concatenates `Multi` chain results for `"0"+data` ... `strconv.Itoa(Rounds-1)+data`.
+// Every chain call is a separate task of the `Scheduler` (`DefaultScheduler` if nil),
+// so the number of goroutines is bounded by its budget whatever the input size is.
+type Recipe struct {
+	Single    []Chain
+	Multi     Chain
+	Rounds    int
+	Scheduler *Scheduler
+}
+
+// DefaultRecipe calculates signatures described in the task.
+var DefaultRecipe = MustParseRecipe("crc32~crc32(md5)", "crc32", 6)
+
+// ParseRecipe creates the recipe from `~` separated single chains, multi chain and the number of multi rounds.
+func ParseRecipe(single, multi string, rounds int) (*Recipe, error) {
+	if rounds <= 0 {
+		return nil, fmt.Errorf("rounds must be > 0")
+	}
+	r := &Recipe{Rounds: rounds}
+	for _, spec := range strings.Split(single, "~") {
+		c, err := ParseChain(spec)
+		if err != nil {
+			return nil, err
+		}
+		r.Single = append(r.Single, c)
+	}
+	c, err := ParseChain(multi)
+	if err != nil {
+		return nil, err
+	}
+	r.Multi = c
+	return r, nil
+}
+
+// MustParseRecipe is like `ParseRecipe` but panics if the recipe cannot be parsed.
+func MustParseRecipe(single, multi string, rounds int) *Recipe {
+	r, err := ParseRecipe(single, multi, rounds)
+	if err != nil {
+		panic(err)
+	}
+	return r
+}
+
+// WithSalt returns the copy of the recipe with the salt bound to every chain, see `Chain.WithSalt`.
+// The recipe without the bound salt uses `DataSignerSalt`.
+func (r *Recipe) WithSalt(salt string) *Recipe {
+	res := *r
+	res.Single = make([]Chain, len(r.Single))
+	for i, c := range r.Single {
+		res.Single[i] = c.WithSalt(salt)
+	}
+	res.Multi = r.Multi.WithSalt(salt)
+	return &res
+}
+
+// SingleSign calculates `SingleHash` signature of one value.
+// It must not be called from a task of the recipe scheduler.
+func (r *Recipe) SingleSign(data string) string {
+	return r.sign(data, r.single())
+}
+
+// MultiSign calculates `MultiHash` signature of one value.
+// It must not be called from a task of the recipe scheduler.
+func (r *Recipe) MultiSign(data string) string {
+	return r.sign(data, r.multi())
+}
+
+// SingleHash is the job calculating `SingleSign` of every input value.
+// It is assumed that data has type `int` or `string`.
+func (r *Recipe) SingleHash(in, out chan interface{}) {
+	r.each(in, out, r.single())
+}
+
+// MultiHash is the job calculating `MultiSign` of every input value.
+// It is assumed that data has type `string`.
+func (r *Recipe) MultiHash(in, out chan interface{}) {
+	r.each(in, out, r.multi())
+}
+
+// Steps returns per-item stages of the recipe for `ExecuteJournaled`.
+func (r *Recipe) Steps() []Step {
+	return []Step{
+		{Name: "SingleHash", Fn: r.SingleSign},
+		{Name: "MultiHash", Fn: r.MultiSign},
+	}
+}
+
+// split describes a signature calculated as `parts` independent tasks joined with `sep`.
+type split struct {
+	parts int
+	sep   string
+	part  func(data string, i int) string
+}
+
+// single returns the split of `SingleHash` signature.
+func (r *Recipe) single() split {
+	return split{parts: len(r.Single), sep: "~", part: func(data string, i int) string {
+		return r.Single[i].Sign(data)
+	}}
+}
+
+// multi returns the split of `MultiHash` signature.
+func (r *Recipe) multi() split {
+	return split{parts: r.Rounds, part: func(data string, i int) string {
+		return r.Multi.Sign(strconv.Itoa(i) + data)
+	}}
+}
+
+// scheduler returns the scheduler of the recipe.
+func (r *Recipe) scheduler() *Scheduler {
+	if r.Scheduler == nil {
+		return DefaultScheduler
+	}
+	return r.Scheduler
+}
+
+// sign schedules all parts of the signature and waits for them.
+func (r *Recipe) sign(data string, sp split) string {
+	res := make([]string, sp.parts)
+	wg := &sync.WaitGroup{}
+	wg.Add(sp.parts)
+	for i := range res {
+		i := i
+		r.scheduler().Go(func() {
+			defer wg.Done()
+			res[i] = sp.part(data, i)
+		})
+	}
+	wg.Wait()
+	return strings.Join(res, sp.sep)
+}
+
+// each schedules parts of the signature of every input value, the task finishing the last part
+// passes the result to the emitter goroutine which sends it to the output.
+// Tasks never block on the output: the number of values in flight is limited by `MaxInputDataLen`
+// and the emitter queue can hold all of them.
+func (r *Recipe) each(in, out chan interface{}, sp split) {
+	s := r.scheduler()
+	slots := make(chan struct{}, MaxInputDataLen)
+	done := make(chan string, MaxInputDataLen)
+	emitted := make(chan struct{})
+	go func() {
+		defer close(emitted)
+		for res := range done {
+			out <- res
+			<-slots
+		}
+	}()
+	wg := &sync.WaitGroup{}
+	for val := range in {
+		slots <- struct{}{}
+		wg.Add(1)
+		data, res, left := toString(val), make([]string, sp.parts), int32(sp.parts)
+		for i := range res {
+			i := i
+			s.Go(func() {
+				res[i] = sp.part(data, i)
+				if atomic.AddInt32(&left, -1) == 0 {
+					done <- strings.Join(res, sp.sep)
+					wg.Done()
+				}
+			})
+		}
+	}
+	wg.Wait()
+	close(done)
+	<-emitted
+}
+
+// toString converts pipeline value to string.
+func toString(val interface{}) string {
+	switch val := val.(type) {
+	case string:
+		return val
+	case int:
+		return strconv.Itoa(val)
+	default:
+		return fmt.Sprint(val)
+	}
+}
@@ -0,0 +1,340 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"sync"
+	"time"
+)
+
+// Kinds of the coordinator-worker protocol messages.
+const (
+	msgHello  = "hello"
+	msgTask   = "task"
+	msgResult = "result"
+	msgError  = "error"
+)
+
+// message is a unit of the coordinator-worker protocol, messages are sent as JSON objects one per line.
+// Worker starts with `hello` listing its steps and the number of tasks it can run concurrently,
+// then coordinator sends `task` messages and worker answers each with `result`.
+// Coordinator sends `error` and closes connection if it can't use the worker.
+type message struct {
+	Kind     string   `json:"kind"`
+	ID       uint64   `json:"id,omitempty"`
+	Step     string   `json:"step,omitempty"`
+	Steps    []string `json:"steps,omitempty"`
+	Capacity int      `json:"capacity,omitempty"`
+	Data     string   `json:"data,omitempty"`
+	Error    string   `json:"error,omitempty"`
+}
+
+// remoteTask is an item waiting to be calculated by one of the workers.
+// The worker which took the task answers to `reply` or signals `lost` if it disconnects.
+type remoteTask struct {
+	id    uint64
+	data  string
+	reply chan message
+	lost  chan struct{}
+}
+
+// Coordinator offloads one step of the pipeline to remote workers connected over TCP.
+// Items are sent to any worker having a free slot, items in flight of a disconnected worker are re-dispatched.
+// Items which can't be calculated are dropped by `Job` and reported by `Err`.
+type Coordinator struct {
+	// Patience is how long items wait for a worker while none is registered, zero means until `Close`.
+	Patience time.Duration
+
+	step      string
+	ln        net.Listener
+	queue     chan *remoteTask
+	closed    chan struct{}
+	closeOnce sync.Once
+	closeErr  error
+
+	mu      sync.Mutex
+	nextID  uint64
+	workers map[net.Conn]struct{}
+	failed  []string
+	wg      sync.WaitGroup
+}
+
+// NewCoordinator starts listening for workers on the address, they must implement the named step.
+func NewCoordinator(addr, step string) (*Coordinator, error) {
+	ln, err := net.Listen("tcp", addr)
+	if err != nil {
+		return nil, err
+	}
+	c := &Coordinator{
+		step:    step,
+		ln:      ln,
+		queue:   make(chan *remoteTask),
+		closed:  make(chan struct{}),
+		workers: make(map[net.Conn]struct{}),
+	}
+	c.wg.Add(1)
+	go c.accept()
+	return c, nil
+}
+
+// Addr returns the address workers should connect to.
+func (c *Coordinator) Addr() net.Addr {
+	return c.ln.Addr()
+}
+
+// Workers returns the number of registered workers.
+func (c *Coordinator) Workers() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return len(c.workers)
+}
+
+// Close stops accepting workers and disconnects registered ones, it may be called more than once.
+// Items which are not calculated yet are dropped by `Job`.
+func (c *Coordinator) Close() error {
+	c.closeOnce.Do(func() {
+		c.mu.Lock()
+		close(c.closed)
+		for conn := range c.workers {
+			conn.Close()
+		}
+		c.mu.Unlock()
+		c.closeErr = c.ln.Close()
+		c.wg.Wait()
+	})
+	return c.closeErr
+}
+
+// Err reports the items `Job` dropped because the coordinator was closed, no worker came in time
+// or the worker failed to calculate them.
+func (c *Coordinator) Err() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if len(c.failed) == 0 {
+		return nil
+	}
+	return fmt.Errorf("%d items were not calculated remotely, first: %s", len(c.failed), c.failed[0])
+}
+
+// Job sends every input value to the workers and passes results to the output.
+// It is assumed that data has type `string`.
+func (c *Coordinator) Job(in, out chan interface{}) {
+	wg := &sync.WaitGroup{}
+	for val := range in {
+		c.mu.Lock()
+		c.nextID++
+		t := &remoteTask{id: c.nextID, data: val.(string), reply: make(chan message, 1), lost: make(chan struct{}, 1)}
+		c.mu.Unlock()
+		wg.Add(1)
+		go func(t *remoteTask) {
+			defer wg.Done()
+			res, err := c.calculate(t)
+			if err != nil {
+				c.mu.Lock()
+				c.failed = append(c.failed, fmt.Sprintf("%q: %s", t.data, err))
+				c.mu.Unlock()
+				return
+			}
+			out <- res
+		}(t)
+	}
+	wg.Wait()
+}
+
+// calculate dispatches the task until some worker answers it.
+func (c *Coordinator) calculate(t *remoteTask) (string, error) {
+	for {
+		if err := c.dispatch(t); err != nil {
+			return "", err
+		}
+		select {
+		case res := <-t.reply:
+			if res.Kind != msgResult {
+				return "", fmt.Errorf("worker answered %s %s", res.Kind, res.Error)
+			}
+			return res.Data, nil
+		case <-t.lost:
+		case <-c.closed:
+			return "", errCoordinatorClosed
+		}
+	}
+}
+
+// Errors of the items which were not dispatched.
+var (
+	errCoordinatorClosed = errors.New("coordinator is closed")
+	errNoWorkers         = errors.New("no workers")
+)
+
+// dispatch passes the task to any worker which has a free slot.
+func (c *Coordinator) dispatch(t *remoteTask) error {
+	var expire <-chan time.Time
+	if c.Patience > 0 {
+		timer := time.NewTimer(c.Patience)
+		defer timer.Stop()
+		expire = timer.C
+	}
+	for {
+		select {
+		case c.queue <- t:
+			return nil
+		case <-c.closed:
+			return errCoordinatorClosed
+		case <-expire:
+			if c.Workers() == 0 {
+				return errNoWorkers
+			}
+			// the workers are just busy
+			expire = time.After(c.Patience)
+		}
+	}
+}
+
+// accept registers incoming workers.
+func (c *Coordinator) accept() {
+	defer c.wg.Done()
+	for {
+		conn, err := c.ln.Accept()
+		if err != nil {
+			return
+		}
+		c.wg.Add(1)
+		go func() {
+			defer c.wg.Done()
+			c.serve(conn)
+		}()
+	}
+}
+
+// serve dispatches tasks to the connected worker until it disconnects.
+func (c *Coordinator) serve(conn net.Conn) {
+	defer conn.Close()
+	dec := json.NewDecoder(bufio.NewReader(conn))
+	enc := json.NewEncoder(conn)
+	hello := message{}
+	if err := dec.Decode(&hello); err != nil || hello.Kind != msgHello {
+		return
+	}
+	if !contains(hello.Steps, c.step) || hello.Capacity <= 0 {
+		enc.Encode(message{Kind: msgError, Error: fmt.Sprintf("worker must implement step %q with positive capacity", c.step)})
+		return
+	}
+	c.mu.Lock()
+	select {
+	case <-c.closed:
+		c.mu.Unlock()
+		return
+	default:
+	}
+	c.workers[conn] = struct{}{}
+	c.mu.Unlock()
+
+	var (
+		mu       sync.Mutex
+		inFlight = make(map[uint64]*remoteTask, hello.Capacity)
+		slots    = make(chan struct{}, hello.Capacity)
+		gone     = make(chan struct{})
+	)
+	go func() {
+		defer close(gone)
+		for {
+			res := message{}
+			if err := dec.Decode(&res); err != nil {
+				return
+			}
+			mu.Lock()
+			t, ok := inFlight[res.ID]
+			delete(inFlight, res.ID)
+			mu.Unlock()
+			if ok {
+				t.reply <- res
+				<-slots
+			}
+		}
+	}()
+
+dispatch:
+	for {
+		select {
+		case slots <- struct{}{}:
+		case <-gone:
+			break dispatch
+		}
+		var t *remoteTask
+		select {
+		case t = <-c.queue:
+		case <-gone:
+			break dispatch
+		}
+		mu.Lock()
+		inFlight[t.id] = t
+		mu.Unlock()
+		if err := enc.Encode(message{Kind: msgTask, ID: t.id, Step: c.step, Data: t.data}); err != nil {
+			break
+		}
+	}
+
+	conn.Close()
+	<-gone
+	c.mu.Lock()
+	delete(c.workers, conn)
+	c.mu.Unlock()
+	// tasks are re-dispatched by their items, each task is in flight of one worker at most
+	mu.Lock()
+	for _, t := range inFlight {
+		t.lost <- struct{}{}
+	}
+	mu.Unlock()
+}
+
+// ServeWorker connects to the coordinator and calculates up to `capacity` tasks concurrently
+// using the given steps until the coordinator closes the connection.
+func ServeWorker(addr string, steps []Step, capacity int) error {
+	conn, err := net.Dial("tcp", addr)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	fns := make(map[string]func(data string) string, len(steps))
+	hello := message{Kind: msgHello, Capacity: capacity}
+	for _, s := range steps {
+		fns[s.Name] = s.Fn
+		hello.Steps = append(hello.Steps, s.Name)
+	}
+	enc := json.NewEncoder(conn)
+	if err = enc.Encode(hello); err != nil {
+		return err
+	}
+
+	encMu := &sync.Mutex{}
+	wg := &sync.WaitGroup{}
+	defer wg.Wait()
+	dec := json.NewDecoder(bufio.NewReader(conn))
+	for {
+		task := message{}
+		if err = dec.Decode(&task); err == io.EOF {
+			return nil
+		} else if err != nil {
+			return err
+		}
+		if task.Kind == msgError {
+			return fmt.Errorf("worker rejected: %s", task.Error)
+		}
+		fn, ok := fns[task.Step]
+		if task.Kind != msgTask || !ok {
+			return fmt.Errorf("unexpected %s message for step %q", task.Kind, task.Step)
+		}
+		wg.Add(1)
+		go func(task message) {
+			defer wg.Done()
+			res := message{Kind: msgResult, ID: task.ID, Data: fn(task.Data)}
+			encMu.Lock()
+			enc.Encode(res)
+			encMu.Unlock()
+		}(task)
+	}
+}
@@ -0,0 +1,246 @@
+package main
+
+import (
+	"encoding/json"
+	"net"
+	"os"
+	"os/exec"
+	"strings"
+	"testing"
+	"time"
+)
+
+const workerEnv = "SIGNER_WORKER"
+
+// TestRemoteWorkerProcess is not a real test, it serves as a remote worker in a child process.
+func TestRemoteWorkerProcess(t *testing.T) {
+	addr := os.Getenv(workerEnv)
+	if addr == "" {
+		return
+	}
+	if err := ServeWorker(addr, DefaultRecipe.Steps(), MaxInputDataLen); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// startWorker runs the worker process connected to the coordinator.
+func startWorker(t *testing.T, c *Coordinator) *exec.Cmd {
+	cmd := exec.Command(os.Args[0], "-test.run=^TestRemoteWorkerProcess$")
+	cmd.Env = append(os.Environ(), workerEnv+"="+c.Addr().String())
+	if err := cmd.Start(); err != nil {
+		t.Fatal(err)
+	}
+	return cmd
+}
+
+// waitWorkers waits until the given number of workers is registered by the coordinator.
+func waitWorkers(t *testing.T, c *Coordinator, n int) {
+	deadline := time.Now().Add(10 * time.Second)
+	for c.Workers() != n {
+		if time.Now().After(deadline) {
+			t.Fatalf("workers not registered\nGot: %d\nExpected: %d", c.Workers(), n)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+// runRemote executes the signer pipeline offloading MultiHash to the coordinator.
+func runRemote(c *Coordinator, input []string) string {
+	result := "NOT_SET"
+	ExecutePipeline(
+		func(in, out chan interface{}) {
+			for _, val := range input {
+				out <- val
+			}
+		},
+		SingleHash,
+		c.Job,
+		CombineResults,
+		func(in, out chan interface{}) {
+			result = (<-in).(string)
+		},
+	)
+	return result
+}
+
+func TestRemoteWorkers(t *testing.T) {
+	// MultiHash runs in the workers on the wall clock
+	_, restore := useFakeClock(t, signerSchedule(len(journalInput), false)...)
+	defer restore()
+	c, err := NewCoordinator("127.0.0.1:0", "MultiHash")
+	if err != nil {
+		t.Fatal(err)
+	}
+	workers := []*exec.Cmd{startWorker(t, c), startWorker(t, c), startWorker(t, c)}
+	waitWorkers(t, c, len(workers))
+
+	if result := runRemote(c, journalInput); result != journalExpected {
+		t.Errorf("results not match\nGot: %v\nExpected: %v", result, journalExpected)
+	}
+
+	c.Close()
+	for _, cmd := range workers {
+		if err = cmd.Wait(); err != nil {
+			t.Errorf("worker failed: %s", err)
+		}
+	}
+}
+
+func TestRemoteWorkerDisconnect(t *testing.T) {
+	// MultiHash runs in the workers on the wall clock
+	_, restore := useFakeClock(t, signerSchedule(len(journalInput), false)...)
+	defer restore()
+	c, err := NewCoordinator("127.0.0.1:0", "MultiHash")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+	first := startWorker(t, c)
+	waitWorkers(t, c, 1)
+
+	done := make(chan string)
+	go func() {
+		done <- runRemote(c, journalInput)
+	}()
+	// MultiHash takes a second of wall time in the worker, so all items are in flight when it's killed
+	time.Sleep(300 * time.Millisecond)
+	first.Process.Kill()
+	first.Wait()
+	waitWorkers(t, c, 0)
+	second := startWorker(t, c)
+	defer second.Process.Kill()
+
+	select {
+	case result := <-done:
+		if result != journalExpected {
+			t.Errorf("results not match\nGot: %v\nExpected: %v", result, journalExpected)
+		}
+	case <-time.After(10 * time.Second):
+		t.Fatalf("in-flight items were not re-dispatched")
+	}
+}
+
+func TestRemoteWorkerRejected(t *testing.T) {
+	c, err := NewCoordinator("127.0.0.1:0", "MultiHash")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+	steps := []Step{{Name: "SingleHash", Fn: strings.ToUpper}}
+	err = ServeWorker(c.Addr().String(), steps, 1)
+	expected := `worker rejected: worker must implement step "MultiHash" with positive capacity`
+	if err == nil || err.Error() != expected {
+		t.Errorf("Got: %v\nExpected: %s", err, expected)
+	}
+	if n := c.Workers(); n != 0 {
+		t.Errorf("rejected worker registered")
+	}
+}
+
+func TestRemoteInProcess(t *testing.T) {
+	defer checkLeaks(t)()
+	c, err := NewCoordinator("127.0.0.1:0", "upper")
+	if err != nil {
+		t.Fatal(err)
+	}
+	steps := []Step{{Name: "upper", Fn: strings.ToUpper}}
+	errs := make(chan error, 2)
+	for i := 0; i < cap(errs); i++ {
+		go func() {
+			errs <- ServeWorker(c.Addr().String(), steps, 1)
+		}()
+	}
+	waitWorkers(t, c, cap(errs))
+
+	res := &collector{}
+	ExecutePipeline(emit("a", "b", "c", "d"), c.Job, res.sink("res"))
+	if got := res.sorted("res"); got != "A,B,C,D" {
+		t.Errorf("Got: %s\nExpected: %s", got, "A,B,C,D")
+	}
+
+	c.Close()
+	for i := 0; i < cap(errs); i++ {
+		if err = <-errs; err != nil {
+			t.Errorf("worker failed: %s", err)
+		}
+	}
+}
+
+func TestRemoteNoWorkers(t *testing.T) {
+	defer checkLeaks(t)()
+	c, err := NewCoordinator("127.0.0.1:0", "upper")
+	if err != nil {
+		t.Fatal(err)
+	}
+	c.Patience = 50 * time.Millisecond
+	res := &collector{}
+	ExecutePipeline(emit("a", "b"), c.Job, res.sink("res"))
+	if got := res.sorted("res"); got != "" {
+		t.Errorf("Got: %s\nExpected nothing", got)
+	}
+	expected := `2 items were not calculated remotely, first: "`
+	if err = c.Err(); err == nil || !strings.HasPrefix(err.Error(), expected) || !strings.HasSuffix(err.Error(), errNoWorkers.Error()) {
+		t.Errorf("Got: %v\nExpected: %s...: %s", err, expected, errNoWorkers)
+	}
+
+	// without the patience limit items wait until the coordinator is closed
+	c.Patience = 0
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		ExecutePipeline(emit("c"), c.Job, res.sink("res"))
+	}()
+	time.Sleep(50 * time.Millisecond)
+	c.Close()
+	c.Close()
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatalf("items are not dropped on close")
+	}
+	if err = c.Err(); err == nil || !strings.HasPrefix(err.Error(), "3 items") {
+		t.Errorf("Got: %v\nExpected: 3 items ...", err)
+	}
+}
+
+func TestRemoteWorkerError(t *testing.T) {
+	defer checkLeaks(t)()
+	c, err := NewCoordinator("127.0.0.1:0", "upper")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+	conn, err := net.Dial("tcp", c.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	enc, dec := json.NewEncoder(conn), json.NewDecoder(conn)
+	if err = enc.Encode(message{Kind: msgHello, Steps: []string{"upper"}, Capacity: 1}); err != nil {
+		t.Fatal(err)
+	}
+	// worker of capacity 1 fails the first task and calculates the second one
+	go func() {
+		for i := 0; ; i++ {
+			task := message{}
+			if dec.Decode(&task) != nil {
+				return
+			}
+			res := message{Kind: msgResult, ID: task.ID, Data: strings.ToUpper(task.Data)}
+			if i == 0 {
+				res = message{Kind: msgError, ID: task.ID, Error: "broken"}
+			}
+			enc.Encode(res)
+		}
+	}()
+	waitWorkers(t, c, 1)
+
+	res := &collector{}
+	ExecutePipeline(emit("a", "b"), c.Job, res.sink("res"))
+	if got := res.sorted("res"); got != "A" && got != "B" {
+		t.Errorf("Got: %s\nExpected: one of A, B", got)
+	}
+	if err = c.Err(); err == nil || !strings.HasSuffix(err.Error(), "worker answered error broken") {
+		t.Errorf("Got: %v\nExpected: ...worker answered error broken", err)
+	}
+}
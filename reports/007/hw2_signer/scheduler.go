@@ -0,0 +1,58 @@
+package main
+
+// Scheduler runs tasks on a pool of at most `budget` goroutines.
+// Workers are started on demand, take queued tasks while there are any and exit when there are none,
+// so an idle scheduler holds no goroutines.
+// Tasks must not wait for other tasks of the same scheduler, otherwise the pool may run out of workers.
+type Scheduler struct {
+	tokens chan struct{}
+	tasks  chan func()
+}
+
+// DefaultScheduler is shared by all the recipes which have no own scheduler.
+// Its budget is enough for all `MultiHash` rounds of `MaxInputDataLen` values in flight of `DefaultRecipe`,
+// `SingleHash` tasks take the workers as they are released.
+//
+// The budget trades throughput for goroutines, see `BenchmarkSigner*`: on 10000 values it keeps the peak
+// below the legacy implementation which spawns goroutines per value without a limit and is faster,
+// `8 * MaxInputDataLen` running both stages at once gains about 15% of throughput with more goroutines than legacy,
+// while the budget of `MaxInputDataLen` is about 3 times slower.
+var DefaultScheduler = NewScheduler(6 * MaxInputDataLen)
+
+// NewScheduler creates the scheduler with the given goroutine budget.
+func NewScheduler(budget int) *Scheduler {
+	if budget <= 0 {
+		panic("scheduler budget must be > 0")
+	}
+	return &Scheduler{
+		tokens: make(chan struct{}, budget),
+		tasks:  make(chan func()),
+	}
+}
+
+// Go runs the task on one of the workers, it blocks while all the budget is in use.
+func (s *Scheduler) Go(task func()) {
+	select {
+	case s.tasks <- task:
+	case s.tokens <- struct{}{}:
+		go s.work(task)
+	}
+}
+
+// Running returns the number of worker goroutines.
+func (s *Scheduler) Running() int {
+	return len(s.tokens)
+}
+
+// work runs the task and then the queued ones until there are no more.
+func (s *Scheduler) work(task func()) {
+	for {
+		task()
+		select {
+		case task = <-s.tasks:
+		default:
+			<-s.tokens
+			return
+		}
+	}
+}
@@ -0,0 +1,229 @@
+package main
+
+import (
+	"crypto/md5"
+	"fmt"
+	"hash/crc32"
+	"runtime"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// checkLeaks fails the test if goroutines started during it are still running after it finishes.
+func checkLeaks(t testing.TB) func() {
+	before := runtime.NumGoroutine()
+	return func() {
+		deadline := time.Now().Add(time.Second)
+		for runtime.NumGoroutine() > before {
+			if time.Now().After(deadline) {
+				buf := make([]byte, 1<<20)
+				t.Errorf("goroutines leaked\nGot: %d\nExpected: <=%d\n%s",
+					runtime.NumGoroutine(), before, buf[:runtime.Stack(buf, true)])
+				return
+			}
+			time.Sleep(10 * time.Millisecond)
+		}
+	}
+}
+
+// quickSigners replaces data signers with ones that calculate the same hashes,
+// crc32 sleeps for `delay` on the wall clock, the returned function restores them.
+func quickSigners(delay time.Duration) func() {
+	md5Signer, crc32Signer := DataSignerMd5, DataSignerCrc32
+	DataSignerMd5 = func(data string) string {
+		return fmt.Sprintf("%x", md5.Sum([]byte(data+DataSignerSalt)))
+	}
+	DataSignerCrc32 = func(data string) string {
+		time.Sleep(delay)
+		return strconv.FormatUint(uint64(crc32.ChecksumIEEE([]byte(data+DataSignerSalt))), 10)
+	}
+	return func() {
+		DataSignerMd5, DataSignerCrc32 = md5Signer, crc32Signer
+	}
+}
+
+func TestSchedulerBudget(t *testing.T) {
+	defer checkLeaks(t)()
+	s := NewScheduler(3)
+	var running, peak int32
+	wg := &sync.WaitGroup{}
+	for i := 0; i < 50; i++ {
+		wg.Add(1)
+		s.Go(func() {
+			defer wg.Done()
+			n := atomic.AddInt32(&running, 1)
+			for p := atomic.LoadInt32(&peak); n > p && !atomic.CompareAndSwapInt32(&peak, p, n); {
+				p = atomic.LoadInt32(&peak)
+			}
+			time.Sleep(time.Millisecond)
+			atomic.AddInt32(&running, -1)
+		})
+		if n := s.Running(); n > 3 {
+			t.Errorf("budget exceeded: %d workers", n)
+		}
+	}
+	wg.Wait()
+	if peak != 3 {
+		t.Errorf("tasks running concurrently\nGot: %d\nExpected: %d", peak, 3)
+	}
+}
+
+func TestSchedulerSmallBudget(t *testing.T) {
+	defer checkLeaks(t)()
+	// 2 goroutines are always busy with one second crc32 or 10ms md5 till the last task
+	schedule := []int{1}
+	for i := 0; i < 17; i++ {
+		schedule = append([]int{2}, schedule...)
+	}
+	clock, restore := useFakeClock(t, schedule...)
+	defer restore()
+	r := MustParseRecipe("crc32~crc32(md5)", "crc32", 6)
+	r.Scheduler = NewScheduler(2)
+	input := []int{0, 1}
+	result := "NOT_SET"
+	ExecutePipeline(
+		func(in, out chan interface{}) {
+			for _, val := range input {
+				out <- val
+			}
+		},
+		r.SingleHash,
+		r.MultiHash,
+		CombineResults,
+		func(in, out chan interface{}) {
+			result = (<-in).(string)
+		},
+	)
+	expected := "29568666068035183841425683795340791879727309630931025356555_4958044192186797981418233587017209679042592862002427381542"
+	if result != expected {
+		t.Errorf("results not match\nGot: %v\nExpected: %v", result, expected)
+	}
+	// 4 SingleHash chains and 12 MultiHash rounds of 1s each on 2 goroutines
+	if end, min := clock.Now().Sub(time.Unix(0, 0)), 8*time.Second; end < min {
+		t.Errorf("budget was not respected, execution on virtual clock\nGot: %s\nExpected: >=%s", end, min)
+	}
+}
+
+// legacySingleHash is the former implementation of `SingleHash` spawning 3 goroutines per value.
+func legacySingleHash(in, out chan interface{}) {
+	wge := &sync.WaitGroup{}
+	q := make(chan struct{}, 1)
+	for val := range in {
+		wge.Add(1)
+		go func(val string) {
+			defer wge.Done()
+			var crc1, crc2 string
+			wgi := &sync.WaitGroup{}
+			wgi.Add(2)
+			go func(val string) {
+				defer wgi.Done()
+				crc1 = DataSignerCrc32(val)
+			}(val)
+			go func(val string) {
+				defer wgi.Done()
+				q <- struct{}{}
+				val = DataSignerMd5(val)
+				<-q
+				crc2 = DataSignerCrc32(val)
+			}(val)
+			wgi.Wait()
+			out <- crc1 + "~" + crc2
+		}(strconv.Itoa(val.(int)))
+		runtime.Gosched()
+	}
+	wge.Wait()
+}
+
+// legacyMultiHash is the former implementation of `MultiHash` spawning 7 goroutines per value.
+func legacyMultiHash(in, out chan interface{}) {
+	var num = [6]string{"0", "1", "2", "3", "4", "5"}
+	wge := &sync.WaitGroup{}
+	for val := range in {
+		wge.Add(1)
+		go func(val string) {
+			defer wge.Done()
+			var res [6]string
+			wgi := &sync.WaitGroup{}
+			wgi.Add(6)
+			for i, th := range num {
+				go func(i int, val string) {
+					defer wgi.Done()
+					res[i] = DataSignerCrc32(val)
+				}(i, th+val)
+			}
+			wgi.Wait()
+			out <- res[0] + res[1] + res[2] + res[3] + res[4] + res[5]
+		}(val.(string))
+		runtime.Gosched()
+	}
+	wge.Wait()
+}
+
+// benchmarkSigner runs signer pipeline over 10000 values with every crc32 call taking 1ms
+// and reports the throughput and the peak number of goroutines.
+func benchmarkSigner(b *testing.B, single, multi job) {
+	defer quickSigners(time.Millisecond)()
+	const n = 10000
+	var peak int
+	stop := make(chan struct{})
+	sampled := make(chan struct{})
+	go func() {
+		defer close(sampled)
+		ticker := time.NewTicker(100 * time.Microsecond)
+		defer ticker.Stop()
+		for {
+			if g := runtime.NumGoroutine(); g > peak {
+				peak = g
+			}
+			select {
+			case <-stop:
+				return
+			case <-ticker.C:
+			}
+		}
+	}()
+	b.ReportAllocs()
+	b.ResetTimer()
+	start := time.Now()
+	for i := 0; i < b.N; i++ {
+		ExecutePipeline(
+			func(in, out chan interface{}) {
+				for val := 0; val < n; val++ {
+					out <- val
+				}
+			},
+			single,
+			multi,
+			CombineResults,
+			func(in, out chan interface{}) {
+				<-in
+			},
+		)
+	}
+	elapsed := time.Since(start)
+	b.StopTimer()
+	close(stop)
+	<-sampled
+	b.ReportMetric(float64(n*b.N)/elapsed.Seconds(), "items/s")
+	b.ReportMetric(float64(peak), "peak-goroutines")
+}
+
+// -----
+// go test -bench Signer -benchmem
+
+func BenchmarkSignerLegacy(b *testing.B) {
+	benchmarkSigner(b, legacySingleHash, legacyMultiHash)
+}
+
+func BenchmarkSignerScheduled(b *testing.B) {
+	benchmarkSigner(b, SingleHash, MultiHash)
+}
+
+func BenchmarkSignerScheduledBudget100(b *testing.B) {
+	r := MustParseRecipe("crc32~crc32(md5)", "crc32", 6)
+	r.Scheduler = NewScheduler(100)
+	benchmarkSigner(b, r.SingleHash, r.MultiHash)
+}
@@ -1,9 +1,7 @@
 package main
 
 import (
-	"runtime"
 	"sort"
-	"strconv"
 	"strings"
 	"sync"
 )
@@ -27,61 +25,16 @@ func ExecutePipeline(jobs ...job) {
 	wg.Wait()
 }
 
-// SingleHash calculates `crc32(data) + "~" + crc32(md5(data))`.
+// SingleHash calculates `crc32(data) + "~" + crc32(md5(data))` using `DefaultRecipe`.
 // It is assumed that data has type `int`.
 func SingleHash(in, out chan interface{}) {
-	wge := &sync.WaitGroup{}
-	q := make(chan struct{}, 1)
-	for val := range in {
-		wge.Add(1)
-		go func(val string) {
-			defer wge.Done()
-			var crc1, crc2 string
-			wgi := &sync.WaitGroup{}
-			wgi.Add(2)
-			go func(val string) {
-				defer wgi.Done()
-				crc1 = DataSignerCrc32(val)
-			}(val)
-			go func(val string) {
-				defer wgi.Done()
-				q <- struct{}{}
-				val = DataSignerMd5(val)
-				<-q
-				crc2 = DataSignerCrc32(val)
-			}(val)
-			wgi.Wait()
-			out <- crc1 + "~" + crc2
-		}(strconv.Itoa(val.(int)))
-		runtime.Gosched()
-	}
-	wge.Wait()
+	DefaultRecipe.SingleHash(in, out)
 }
 
-// MultiHash calculates `crc32("0"+data) + ... + crc32("5"+data)`.
+// MultiHash calculates `crc32("0"+data) + ... + crc32("5"+data)` using `DefaultRecipe`.
 // It is assumed that data has type `string`.
 func MultiHash(in, out chan interface{}) {
-	var num = [6]string{"0", "1", "2", "3", "4", "5"}
-	wge := &sync.WaitGroup{}
-	for val := range in {
-		wge.Add(1)
-		go func(val string) {
-			defer wge.Done()
-			var res [6]string
-			wgi := &sync.WaitGroup{}
-			wgi.Add(6)
-			for i, th := range num {
-				go func(i int, val string) {
-					defer wgi.Done()
-					res[i] = DataSignerCrc32(val)
-				}(i, th+val)
-			}
-			wgi.Wait()
-			out <- res[0] + res[1] + res[2] + res[3] + res[4] + res[5]
-		}(val.(string))
-		runtime.Gosched()
-	}
-	wge.Wait()
+	DefaultRecipe.MultiHash(in, out)
 }
 
 // CombineResults collects all input data, sorts it and joins with `_` separator.
@@ -91,7 +44,6 @@ func CombineResults(in, out chan interface{}) {
 	all := make([]string, 0, MaxInputDataLen)
 	for val := range in {
 		all = append(all, val.(string))
-		runtime.Gosched()
 	}
 	sort.Strings(all)
 	out <- strings.Join(all, "_")
@@ -0,0 +1,172 @@
+package main
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"sort"
+	"sync"
+)
+
+// Signer calculates the signature of data.
+type Signer interface {
+	Name() string
+	Sign(data string) string
+}
+
+// signerFunc adapts an ordinary function to the `Signer` interface.
+type signerFunc struct {
+	name string
+	fn   func(data string) string
+}
+
+// NewSigner creates the signer with the given name calling `fn`.
+func NewSigner(name string, fn func(data string) string) Signer {
+	return &signerFunc{name: name, fn: fn}
+}
+
+// Name implements `Signer` interface.
+func (s *signerFunc) Name() string {
+	return s.name
+}
+
+// Sign implements `Signer` interface.
+func (s *signerFunc) Sign(data string) string {
+	return s.fn(data)
+}
+
+// SaltedSigner is the signer depending on the salt, `WithSalt` returns its copy bound to the given salt.
+type SaltedSigner interface {
+	Signer
+	WithSalt(salt string) Signer
+}
+
+// saltedSigner calls `fn` with the salt returned by `salt`.
+type saltedSigner struct {
+	name string
+	fn   func(data, salt string) string
+	salt func() string
+}
+
+// NewSaltedSigner creates the signer with the given name calling `fn` with `DataSignerSalt` until it is bound.
+func NewSaltedSigner(name string, fn func(data, salt string) string) SaltedSigner {
+	return &saltedSigner{name: name, fn: fn, salt: legacySalt}
+}
+
+// legacySalt returns `DataSignerSalt` at the moment of signing.
+func legacySalt() string {
+	return DataSignerSalt
+}
+
+// Name implements `Signer` interface.
+func (s *saltedSigner) Name() string {
+	return s.name
+}
+
+// Sign implements `Signer` interface.
+func (s *saltedSigner) Sign(data string) string {
+	return s.fn(data, s.salt())
+}
+
+// WithSalt implements `SaltedSigner` interface.
+func (s *saltedSigner) WithSalt(salt string) Signer {
+	return &saltedSigner{name: s.name, fn: s.fn, salt: func() string { return salt }}
+}
+
+// bindSalt binds the salt to the signer if it depends on one.
+func bindSalt(s Signer, salt string) Signer {
+	if salted, ok := s.(SaltedSigner); ok {
+		return salted.WithSalt(salt)
+	}
+	return s
+}
+
+// exclusiveSigner allows only one concurrent call of the wrapped signer.
+// The mutex is shared with the copies bound to other salts.
+type exclusiveSigner struct {
+	Signer
+	mu *sync.Mutex
+}
+
+// Exclusive wraps the signer so that it is never called concurrently (e.g. `DataSignerMd5` overheats).
+func Exclusive(s Signer) Signer {
+	return &exclusiveSigner{Signer: s, mu: &sync.Mutex{}}
+}
+
+// Sign implements `Signer` interface.
+func (s *exclusiveSigner) Sign(data string) string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.Signer.Sign(data)
+}
+
+// WithSalt implements `SaltedSigner` interface.
+func (s *exclusiveSigner) WithSalt(salt string) Signer {
+	return &exclusiveSigner{Signer: bindSalt(s.Signer, salt), mu: s.mu}
+}
+
+// Built-in signers are looked up by these names, all of them are `SaltedSigner`.
+// `crc32` and `md5` call `DataSignerCrc32` and `DataSignerMd5` at the moment of signing,
+// they always append `DataSignerSalt` to data, the bound salt is appended before it.
+// `sha256` hashes data with the salt appended and `hmac-sha256` uses the salt as the key,
+// until they are bound the salt is `DataSignerSalt`.
+var (
+	signersMu sync.RWMutex
+	signers   = map[string]Signer{
+		"crc32": &saltedSigner{name: "crc32", salt: noSalt, fn: func(data, salt string) string {
+			return DataSignerCrc32(data + salt)
+		}},
+		"md5": Exclusive(&saltedSigner{name: "md5", salt: noSalt, fn: func(data, salt string) string {
+			return DataSignerMd5(data + salt)
+		}}),
+		"sha256": NewSaltedSigner("sha256", func(data, salt string) string {
+			sum := sha256.Sum256([]byte(data + salt))
+			return hex.EncodeToString(sum[:])
+		}),
+		"hmac-sha256": NewSaltedSigner("hmac-sha256", func(data, salt string) string {
+			mac := hmac.New(sha256.New, []byte(salt))
+			mac.Write([]byte(data))
+			return hex.EncodeToString(mac.Sum(nil))
+		}),
+	}
+)
+
+// noSalt is the default salt of the signers which append `DataSignerSalt` by themselves.
+func noSalt() string {
+	return ""
+}
+
+// RegisterSigner makes the signer available by its name, names must be unique.
+func RegisterSigner(s Signer) error {
+	signersMu.Lock()
+	defer signersMu.Unlock()
+	if _, ok := signers[s.Name()]; ok {
+		return fmt.Errorf("signer %q is already registered", s.Name())
+	}
+	signers[s.Name()] = s
+	return nil
+}
+
+// LookupSigner returns the registered signer by its name.
+func LookupSigner(name string) (Signer, error) {
+	signersMu.RLock()
+	defer signersMu.RUnlock()
+	s, ok := signers[name]
+	if !ok {
+		return nil, fmt.Errorf("unknown signer %q", name)
+	}
+	return s, nil
+}
+
+// SignerNames returns sorted names of all registered signers.
+func SignerNames() []string {
+	signersMu.RLock()
+	defer signersMu.RUnlock()
+	names := make([]string, 0, len(signers))
+	for name := range signers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
@@ -0,0 +1,137 @@
+package main
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+// withSalt sets `DataSignerSalt` for the duration of the test.
+func withSalt(salt string) func() {
+	prev := DataSignerSalt
+	DataSignerSalt = salt
+	return func() {
+		DataSignerSalt = prev
+	}
+}
+
+func TestSignerRegistry(t *testing.T) {
+	defer withSalt("s")()
+	cases := []struct {
+		Name     string
+		Data     string
+		Expected string
+	}{
+		{"sha256", "1", "64c83df872d808a1820aab72aa20bf2cf33b96fff4933e691e30f7646dfcc1be"},
+		{"hmac-sha256", "1", "0d42ca66c4d28025bd8c84c764b4bff33c8c7b66efad33b1edbee042baee2989"},
+	}
+	for _, tc := range cases {
+		s, err := LookupSigner(tc.Name)
+		if err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+		if got := s.Sign(tc.Data); got != tc.Expected {
+			t.Errorf("%s(%s)\nGot: %s\nExpected: %s", tc.Name, tc.Data, got, tc.Expected)
+		}
+	}
+
+	if _, err := LookupSigner("sha1"); err == nil || err.Error() != `unknown signer "sha1"` {
+		t.Errorf("unexpected error: %v", err)
+	}
+	if err := RegisterSigner(NewSigner("md5", nil)); err == nil || err.Error() != `signer "md5" is already registered` {
+		t.Errorf("unexpected error: %v", err)
+	}
+	if err := RegisterSigner(NewSigner("upper", strings.ToUpper)); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	defer func() {
+		signersMu.Lock()
+		delete(signers, "upper")
+		signersMu.Unlock()
+	}()
+	expected := "crc32,hmac-sha256,md5,sha256,upper"
+	if got := strings.Join(SignerNames(), ","); got != expected {
+		t.Errorf("Got: %s\nExpected: %s", got, expected)
+	}
+}
+
+func TestParseChain(t *testing.T) {
+	defer withSalt("s")()
+	c, err := ParseChain(" sha256 ( hmac-sha256 ) ")
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if got := c.String(); got != "sha256(hmac-sha256)" {
+		t.Errorf("Got: %s\nExpected: %s", got, "sha256(hmac-sha256)")
+	}
+	expected := "386b55624c5a865e8b248ce4508eae0552f424b7c98c49f66e95f71da456f604"
+	if got := c.Sign("x"); got != expected {
+		t.Errorf("Got: %s\nExpected: %s", got, expected)
+	}
+	// the bound salt does not depend on `DataSignerSalt`
+	bound := c.WithSalt("s")
+	DataSignerSalt = "other"
+	if got := bound.Sign("x"); got != expected {
+		t.Errorf("bound\nGot: %s\nExpected: %s", got, expected)
+	}
+	if got := c.Sign("x"); got == expected {
+		t.Errorf("unbound chain ignores DataSignerSalt")
+	}
+	DataSignerSalt = ""
+	md5, _ := LookupSigner("md5")
+	if got, expected := bindSalt(md5, "s").Sign("x"), md5.Sign("xs"); got != expected {
+		t.Errorf("md5\nGot: %s\nExpected: %s", got, expected)
+	}
+
+	for spec, msg := range map[string]string{
+		"crc32(md5":    `unbalanced parentheses in "crc32(md5"`,
+		"crc32(sha1)":  `unknown signer "sha1"`,
+		"sha1(crc32)":  `unknown signer "sha1"`,
+		"crc32~md5":    `unknown signer "crc32~md5"`,
+		"crc32()":      `unknown signer ""`,
+		"(crc32)(md5)": `unbalanced parentheses in "crc32)(md5"`,
+	} {
+		if _, err := ParseChain(spec); err == nil || err.Error() != msg {
+			t.Errorf("%s\nGot: %v\nExpected: %s", spec, err, msg)
+		}
+	}
+	if _, err := ParseRecipe("crc32", "crc32", 0); err == nil {
+		t.Errorf("zero rounds accepted")
+	}
+	if _, err := ParseRecipe("crc32~sha1", "crc32", 6); err == nil {
+		t.Errorf("unknown single signer accepted")
+	}
+	if _, err := ParseRecipe("crc32", "sha1", 6); err == nil {
+		t.Errorf("unknown multi signer accepted")
+	}
+}
+
+func TestSignerCLI(t *testing.T) {
+	defer withSalt("")()
+	stdin := strings.NewReader("1\n\n 2 \n")
+	stdout := new(bytes.Buffer)
+	args := []string{"-single", "sha256~hmac-sha256", "-multi", "sha256", "-rounds", "2", "-salt", "s"}
+	if err := run(args, stdin, stdout); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if DataSignerSalt != "" {
+		t.Errorf("DataSignerSalt is changed to %q", DataSignerSalt)
+	}
+	expected := "82bfe5097c82783e793ed3ba46447961ecbbb627b3d8ff7d66b7b05053e01b995be41f0f52cb4a4eeb8fb517c8c3cc66bd28e2ee0c2c38f6d431ed29420fa6bb_" +
+		"c667b80574f2cfd3adf451e5c6378b97ed174a2d7ba4497be5e0dce917af67a469e96dca7fb341a29a6d51cb96d18b8c337bfdca345687699498326a748b852d\n"
+	if got := stdout.String(); got != expected {
+		t.Errorf("Got: %s\nExpected: %s", got, expected)
+	}
+
+	stdout.Reset()
+	if err := run([]string{"-list"}, nil, stdout); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if got := stdout.String(); got != "crc32\nhmac-sha256\nmd5\nsha256\n" {
+		t.Errorf("Got: %s\nExpected: %s", got, "crc32\nhmac-sha256\nmd5\nsha256\n")
+	}
+
+	if err := run([]string{"-single", "sha1"}, nil, stdout); err == nil {
+		t.Errorf("unknown signer accepted")
+	}
+}
@@ -0,0 +1,592 @@
+package main
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"go/ast"
+	"go/format"
+	"go/parser"
+	"go/token"
+	"io/ioutil"
+	"log"
+	"os"
+	"reflect"
+	"strconv"
+	"strings"
+	"text/template"
+)
+
+// Usage: go run ./decoder_gen [-lexer=false] in.go out.go
+//
+// Generates `DecodeJSON(data []byte) error` methods for the structs of `in.go` marked with the `// jsongen:decode`
+// comment. Fields may be strings, byte slices, booleans, integers, floats and slices of them, JSON keys are taken
+// from the `json` tags like in `encoding/json`, but unlike it they are matched case-sensitively. The decoders share
+// one lexer written into the output too, so `-lexer=false` must be given for all but one output file of the package.
+
+const Template = `// Code generated by decoder_gen, DO NOT EDIT.
+
+package {{.Package}}
+{{if .Lexer}}
+import (
+	"fmt"
+	"strconv"
+	"unicode/utf16"
+	"unicode/utf8"
+)
+
+// intBits is the size of int in bits.
+const intBits = 32 << (^uint(0) >> 63)
+
+// jsonLexer reads JSON from the buffer, strings without escapes are returned as slices of the buffer.
+type jsonLexer struct {
+	data []byte
+	pos  int
+	err  error
+}
+
+// fail remembers the first error.
+func (l *jsonLexer) fail(msg string) {
+	if l.err == nil {
+		l.err = fmt.Errorf("%s at offset %d", msg, l.pos)
+	}
+}
+
+// unexpected fails on the current byte.
+func (l *jsonLexer) unexpected() {
+	if l.pos >= len(l.data) {
+		l.fail("unexpected end of JSON")
+	} else {
+		l.fail(fmt.Sprintf("unexpected %q", l.data[l.pos]))
+	}
+}
+
+// peek skips whitespace and returns the next byte, 0 at the end of data or after an error.
+func (l *jsonLexer) peek() byte {
+	if l.err != nil {
+		return 0
+	}
+	for ; l.pos < len(l.data); l.pos++ {
+		switch c := l.data[l.pos]; c {
+		case ' ', '\t', '\n', '\r':
+		default:
+			return c
+		}
+	}
+	return 0
+}
+
+// end checks that nothing but whitespace is left and returns the first error.
+func (l *jsonLexer) end() error {
+	if l.peek() != 0 {
+		l.unexpected()
+	}
+	return l.err
+}
+
+// delim consumes the delimiter.
+func (l *jsonLexer) delim(c byte) {
+	if l.peek() != c {
+		l.unexpected()
+		return
+	}
+	l.pos++
+}
+
+// next reports whether the object or the array has one more item, consuming the comma before it
+// or the closing delimiter after the last one.
+func (l *jsonLexer) next(end byte, first bool) bool {
+	if l.peek() == end {
+		l.pos++
+		return false
+	}
+	if !first {
+		l.delim(',')
+	}
+	return l.err == nil
+}
+
+// literal consumes the literal like true.
+func (l *jsonLexer) literal(lit string) {
+	l.peek()
+	if len(l.data)-l.pos < len(lit) || string(l.data[l.pos:l.pos+len(lit)]) != lit {
+		l.unexpected()
+		return
+	}
+	l.pos += len(lit)
+}
+
+// null consumes null if it goes next.
+func (l *jsonLexer) null() bool {
+	if l.peek() != 'n' {
+		return false
+	}
+	l.literal("null")
+	return true
+}
+
+// str returns the contents of the string sharing memory with data unless the string has escapes.
+func (l *jsonLexer) str() []byte {
+	l.delim('"')
+	if l.err != nil {
+		return nil
+	}
+	// the position is kept in a local variable so that the loop does not go through the lexer in memory
+	data, start := l.data, l.pos
+	for i := start; i < len(data); i++ {
+		if c := data[i]; c == '"' {
+			l.pos = i + 1
+			return data[start:i]
+		} else if c == '\\' {
+			l.pos = i
+			return l.unescape(start)
+		} else if c < ' ' {
+			l.pos = i
+			l.fail("control character in string")
+			return nil
+		}
+	}
+	l.pos = len(data)
+	l.unexpected()
+	return nil
+}
+
+// unescape continues reading the string from the first escape copying it to the new buffer.
+func (l *jsonLexer) unescape(start int) []byte {
+	buf := make([]byte, l.pos-start, 2*(l.pos-start)+16)
+	copy(buf, l.data[start:l.pos])
+	for l.err == nil && l.pos < len(l.data) {
+		c := l.data[l.pos]
+		switch {
+		case c == '"':
+			l.pos++
+			return buf
+		case c < ' ':
+			l.fail("control character in string")
+			continue
+		case c != '\\':
+			buf = append(buf, c)
+			l.pos++
+			continue
+		}
+		if l.pos++; l.pos == len(l.data) {
+			break
+		}
+		switch c = l.data[l.pos]; c {
+		case '"', '\\', '/':
+			buf = append(buf, c)
+		case 'b':
+			buf = append(buf, '\b')
+		case 'f':
+			buf = append(buf, '\f')
+		case 'n':
+			buf = append(buf, '\n')
+		case 'r':
+			buf = append(buf, '\r')
+		case 't':
+			buf = append(buf, '\t')
+		case 'u':
+			r := l.hex()
+			if utf16.IsSurrogate(r) {
+				r = utf8.RuneError
+				if pos := l.pos; l.pos+1 < len(l.data) && l.data[l.pos] == '\\' && l.data[l.pos+1] == 'u' {
+					l.pos++
+					if r = utf16.DecodeRune(r, l.hex()); r == utf8.RuneError {
+						// unpaired surrogate, the following escape is read on its own
+						l.pos = pos
+					}
+				}
+			}
+			var enc [utf8.UTFMax]byte
+			buf = append(buf, enc[:utf8.EncodeRune(enc[:], r)]...)
+			continue
+		default:
+			l.fail("invalid escape in string")
+		}
+		l.pos++
+	}
+	l.unexpected()
+	return nil
+}
+
+// hex reads the \u escape with the position at u and moves past it.
+func (l *jsonLexer) hex() rune {
+	if len(l.data)-l.pos < 5 {
+		l.pos = len(l.data)
+		l.unexpected()
+		return utf8.RuneError
+	}
+	var r rune
+	for _, c := range l.data[l.pos+1 : l.pos+5] {
+		switch {
+		case '0' <= c && c <= '9':
+			r = r<<4 | rune(c-'0')
+		case 'a' <= c && c <= 'f':
+			r = r<<4 | rune(c-'a'+10)
+		case 'A' <= c && c <= 'F':
+			r = r<<4 | rune(c-'A'+10)
+		default:
+			l.fail("invalid escape in string")
+			return utf8.RuneError
+		}
+	}
+	l.pos += 5
+	return r
+}
+
+// skipStr skips the string without unescaping it.
+func (l *jsonLexer) skipStr() {
+	l.delim('"')
+	if l.err != nil {
+		return
+	}
+	data := l.data
+	for i := l.pos; i < len(data); i++ {
+		if c := data[i]; c == '"' {
+			l.pos = i + 1
+			return
+		} else if c == '\\' {
+			i++
+		} else if c < ' ' {
+			l.pos = i
+			l.fail("control character in string")
+			return
+		}
+	}
+	l.pos = len(data)
+	l.unexpected()
+}
+
+// skip skips the value of any type.
+func (l *jsonLexer) skip() {
+	switch l.peek() {
+	case '"':
+		l.skipStr()
+	case '{':
+		l.pos++
+		for first := true; l.next('}', first); first = false {
+			l.skipStr()
+			l.delim(':')
+			l.skip()
+		}
+	case '[':
+		l.pos++
+		for first := true; l.next(']', first); first = false {
+			l.skip()
+		}
+	case 't':
+		l.literal("true")
+	case 'f':
+		l.literal("false")
+	case 'n':
+		l.literal("null")
+	default:
+		l.number()
+	}
+}
+
+// number returns the number.
+func (l *jsonLexer) number() []byte {
+	l.peek()
+	start := l.pos
+	if l.pos < len(l.data) && l.data[l.pos] == '-' {
+		l.pos++
+	}
+	ok := l.digits()
+	if ok && l.pos < len(l.data) && l.data[l.pos] == '.' {
+		l.pos++
+		ok = l.digits()
+	}
+	if ok && l.pos < len(l.data) && (l.data[l.pos] == 'e' || l.data[l.pos] == 'E') {
+		if l.pos++; l.pos < len(l.data) && (l.data[l.pos] == '+' || l.data[l.pos] == '-') {
+			l.pos++
+		}
+		ok = l.digits()
+	}
+	if !ok {
+		l.unexpected()
+		return nil
+	}
+	return l.data[start:l.pos]
+}
+
+// digits consumes decimal digits and reports whether there was any.
+func (l *jsonLexer) digits() bool {
+	start := l.pos
+	for l.pos < len(l.data) && '0' <= l.data[l.pos] && l.data[l.pos] <= '9' {
+		l.pos++
+	}
+	return l.pos > start
+}
+
+// int reads the integer fitting into the given number of bits.
+func (l *jsonLexer) int(bits uint) int64 {
+	num := l.number()
+	neg := len(num) > 0 && num[0] == '-'
+	if neg {
+		num = num[1:]
+	}
+	limit := uint64(1)<<(bits-1) - 1
+	if neg {
+		limit++
+	}
+	n := l.digitsValue(num, limit)
+	if neg {
+		return -int64(n)
+	}
+	return int64(n)
+}
+
+// uint reads the unsigned integer fitting into the given number of bits.
+func (l *jsonLexer) uint(bits uint) uint64 {
+	return l.digitsValue(l.number(), ^uint64(0)>>(64-bits))
+}
+
+// digitsValue returns the value of the decimal digits not greater than the limit.
+func (l *jsonLexer) digitsValue(num []byte, limit uint64) uint64 {
+	var n uint64
+	for _, c := range num {
+		if c < '0' || c > '9' {
+			l.fail("expected integer")
+			return 0
+		}
+		d := uint64(c - '0')
+		if n > limit/10 || n*10 > limit-d {
+			l.fail("integer overflow")
+			return 0
+		}
+		n = n*10 + d
+	}
+	return n
+}
+
+// float reads the floating point number of the given size in bits.
+func (l *jsonLexer) float(bits int) float64 {
+	num := l.number()
+	if l.err != nil {
+		return 0
+	}
+	f, err := strconv.ParseFloat(string(num), bits)
+	if err != nil {
+		l.fail(err.Error())
+	}
+	return f
+}
+
+// bool reads true or false.
+func (l *jsonLexer) bool() bool {
+	if l.peek() == 't' {
+		l.literal("true")
+		return true
+	}
+	l.literal("false")
+	return false
+}
+{{end}}
+{{- range .Records}}
+// DecodeJSON decodes the JSON object into ` + "`{{.Name}}`" + `, keys are matched case-sensitively, unknown fields are skipped
+// and nulls leave fields empty.
+// Byte slices share memory with the data unless they contain escapes.
+func (out *{{.Name}}) DecodeJSON(data []byte) error {
+	*out = {{.Name}}{ {{- range .Fields}}{{if .Reuse}}{{.Name}}: out.{{.Name}}[:0], {{end}}{{end -}} }
+	l := jsonLexer{data: data}
+	if !l.null() {
+		l.delim('{')
+		for first := true; l.next('}', first); first = false {
+			key := l.str()
+			l.delim(':')
+			if l.null() {
+				continue
+			}
+			switch string(key) {
+			{{- range .Fields}}
+			case {{printf "%q" .Key}}:
+				{{.Decode}}
+			{{- end}}
+			default:
+				l.skip()
+			}
+		}
+	}
+	return l.end()
+}
+{{end}}`
+
+// Field is a decoded field of the record.
+type Field struct {
+	Name   string
+	Key    string
+	Decode string
+	// Reuse tells that the slice keeps its memory between calls.
+	Reuse bool
+}
+
+// Record is a struct to generate the decoder for.
+type Record struct {
+	Name   string
+	Fields []Field
+}
+
+// TemplateArgs are passed to the template.
+type TemplateArgs struct {
+	Package string
+	Lexer   bool
+	Records []Record
+}
+
+// intTypes maps integer types to their size in bits.
+var intTypes = map[string]string{
+	"int": "intBits", "int8": "8", "int16": "16", "int32": "32", "int64": "64",
+	"uint": "intBits", "uint8": "8", "byte": "8", "uint16": "16", "uint32": "32", "uint64": "64", "uintptr": "intBits",
+}
+
+// scalar returns the expression decoding the value of the type or an empty string if the type isn't supported.
+func scalar(typ ast.Expr) string {
+	switch t := typ.(type) {
+	case *ast.Ident:
+		switch name := t.Name; {
+		case name == "string":
+			return "string(l.str())"
+		case name == "bool":
+			return "l.bool()"
+		case name == "float32" || name == "float64":
+			return fmt.Sprintf("%s(l.float(%s))", name, strings.TrimPrefix(name, "float"))
+		case strings.HasPrefix(name, "u") || name == "byte":
+			if bits, ok := intTypes[name]; ok {
+				return fmt.Sprintf("%s(l.uint(%s))", name, bits)
+			}
+		default:
+			if bits, ok := intTypes[name]; ok {
+				return fmt.Sprintf("%s(l.int(%s))", name, bits)
+			}
+		}
+	case *ast.ArrayType:
+		if elt, ok := t.Elt.(*ast.Ident); ok && t.Len == nil && (elt.Name == "byte" || elt.Name == "uint8") {
+			return "l.str()"
+		}
+	}
+	return ""
+}
+
+// decode returns the statements decoding the field and tells whether the field is a reused slice.
+func decode(name string, typ ast.Expr) (string, bool, error) {
+	if expr := scalar(typ); expr != "" {
+		return fmt.Sprintf("out.%s = %s", name, expr), false, nil
+	}
+	if slice, ok := typ.(*ast.ArrayType); ok && slice.Len == nil {
+		if expr := scalar(slice.Elt); expr != "" {
+			return fmt.Sprintf(`out.%[1]s = out.%[1]s[:0]
+				l.delim('[')
+				for first := true; l.next(']', first); first = false {
+					out.%[1]s = append(out.%[1]s, %[2]s)
+				}`, name, expr), true, nil
+		}
+	}
+	return "", false, fmt.Errorf("field %s has unsupported type", name)
+}
+
+// parseRecord collects the fields of the struct.
+func parseRecord(name string, st *ast.StructType) (Record, error) {
+	rec := Record{Name: name}
+	for _, field := range st.Fields.List {
+		if len(field.Names) == 0 {
+			return rec, fmt.Errorf("%s: embedded fields are not supported", name)
+		}
+		var tag reflect.StructTag
+		if field.Tag != nil {
+			tagVal, err := strconv.Unquote(field.Tag.Value)
+			if err != nil {
+				return rec, err
+			}
+			tag = reflect.StructTag(tagVal)
+		}
+		for _, ident := range field.Names {
+			key := strings.Split(tag.Get("json"), ",")[0]
+			if !ident.IsExported() || key == "-" {
+				log.Printf("SKIP %s field of structure %s\n", ident.Name, name)
+				continue
+			}
+			if key == "" {
+				key = ident.Name
+			}
+			code, reuse, err := decode(ident.Name, field.Type)
+			if err != nil {
+				return rec, fmt.Errorf("%s: %s", name, err)
+			}
+			log.Printf("FOUND %s field of structure %s with key %q\n", ident.Name, name, key)
+			rec.Fields = append(rec.Fields, Field{Name: ident.Name, Key: key, Decode: code, Reuse: reuse})
+		}
+	}
+	return rec, nil
+}
+
+// marked reports whether the comments have the generator mark.
+func marked(doc *ast.CommentGroup) bool {
+	if doc == nil {
+		return false
+	}
+	for _, comment := range doc.List {
+		if strings.TrimSpace(comment.Text) == "// jsongen:decode" {
+			return true
+		}
+	}
+	return false
+}
+
+// check function checks for an error and exits if any occurs.
+func check(e error) {
+	if e != nil {
+		fmt.Fprintln(os.Stderr, e)
+		os.Exit(1)
+	}
+}
+
+func main() {
+	var debug = flag.Bool("debug", false, "print debug output")
+	var lexer = flag.Bool("lexer", true, "write the lexer shared by the decoders of the package")
+	if flag.Parse(); *debug {
+		log.SetOutput(os.Stdout)
+	} else {
+		log.SetOutput(ioutil.Discard)
+	}
+	if flag.NArg() != 2 {
+		check(fmt.Errorf("usage: %s [-debug] [-lexer=false] in.go out.go", os.Args[0]))
+	}
+
+	src, err := parser.ParseFile(token.NewFileSet(), flag.Arg(0), nil, parser.ParseComments)
+	check(err)
+	args := TemplateArgs{Package: src.Name.Name, Lexer: *lexer}
+
+	log.Printf("SEARCH for structures to decode\n")
+	for _, decl := range src.Decls {
+		gen, ok := decl.(*ast.GenDecl)
+		if !ok || gen.Tok != token.TYPE {
+			continue
+		}
+		for _, spec := range gen.Specs {
+			currType := spec.(*ast.TypeSpec)
+			currStruct, ok := currType.Type.(*ast.StructType)
+			if !ok {
+				log.Printf("SKIP %s is not a structure\n", currType.Name.Name)
+				continue
+			}
+			// the mark is either above type or above the structure inside a type (...) group
+			if !marked(currType.Doc) && !(len(gen.Specs) == 1 && marked(gen.Doc)) {
+				log.Printf("SKIP structure %s doesnt have jsongen mark\n", currType.Name.Name)
+				continue
+			}
+			log.Printf("FOUND structure %s\n", currType.Name.Name)
+			rec, err := parseRecord(currType.Name.Name, currStruct)
+			check(err)
+			args.Records = append(args.Records, rec)
+		}
+	}
+
+	tmpl, err := template.New("generated file template").Parse(Template)
+	check(err)
+	buf := new(bytes.Buffer)
+	check(tmpl.Execute(buf, args))
+	code, err := format.Source(buf.Bytes())
+	check(err)
+	check(ioutil.WriteFile(flag.Arg(1), code, 0644))
+}
@@ -0,0 +1,142 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"reflect"
+	"testing"
+)
+
+//go:generate go run ./decoder_gen -lexer=false decoder_test.go record_decoder_test.go
+
+// testRecord has fields of every type supported by the decoder generator.
+// jsongen:decode
+type testRecord struct {
+	ID      int      `json:"id"`
+	Small   int8     `json:"small"`
+	Big     uint64   `json:"big"`
+	Title   string   `json:"title"`
+	Tags    []string `json:"tags"`
+	Raw     []byte   `json:"raw"`
+	Lists   [][]byte `json:"lists"`
+	Scores  []int    `json:"scores,omitempty"`
+	Active  bool     `json:"active"`
+	Rating  float64  `json:"rating"`
+	Default string
+	Skipped string `json:"-"`
+	private string
+}
+
+func TestDecodeRecord(t *testing.T) {
+	cases := []struct {
+		JSON     string
+		Expected string
+	}{
+		{`{}`, `{ID:0 Small:0 Big:0 Title: Tags:[] Raw:[] Lists:[] Scores:[] Active:false Rating:0 Default: Skipped: private:}`},
+		{`null`, `{ID:0 Small:0 Big:0 Title: Tags:[] Raw:[] Lists:[] Scores:[] Active:false Rating:0 Default: Skipped: private:}`},
+		{
+			` { "id" : -42, "small": 127, "big": 18446744073709551615, "title": "a\"b\\c\/é😀\n",
+			"tags": ["x", "y"], "raw": "raw", "lists": [], "scores": [1, 2, 3], "active": true, "rating": 4.5e-1,
+			"Default": "d", "Skipped": "s", "private": "p" } `,
+			`{ID:-42 Small:127 Big:18446744073709551615 Title:a"b\c/é😀` + "\n" + ` Tags:[x y] Raw:[114 97 119] Lists:[] Scores:[1 2 3] Active:true Rating:0.45 Default:d Skipped: private:}`,
+		},
+		{
+			`{"unknown": {"a": [1, "2", {"b": null}, true, false, "\"}"]}, "title": null, "tags": null, "id": 1}`,
+			`{ID:1 Small:0 Big:0 Title: Tags:[] Raw:[] Lists:[] Scores:[] Active:false Rating:0 Default: Skipped: private:}`,
+		},
+		// keys are matched case-sensitively, unlike `encoding/json`
+		{`{"ID": 1, "Title": "t", "default": "d"}`, `{ID:0 Small:0 Big:0 Title: Tags:[] Raw:[] Lists:[] Scores:[] Active:false Rating:0 Default: Skipped: private:}`},
+		// a repeated field replaces the slice instead of appending to it
+		{`{"tags": ["a"], "tags": ["b"], "title": "\ud83d"}`, `{ID:0 Small:0 Big:0 Title:` + "�" + ` Tags:[b] Raw:[] Lists:[] Scores:[] Active:false Rating:0 Default: Skipped: private:}`},
+	}
+	for _, tc := range cases {
+		rec := &testRecord{Skipped: "old", Tags: []string{"old"}}
+		if err := rec.DecodeJSON([]byte(tc.JSON)); err != nil {
+			t.Errorf("%s: %s", tc.JSON, err)
+			continue
+		}
+		if got := fmt.Sprintf("%+v", *rec); got != tc.Expected {
+			t.Errorf("%s\nGot: %s\nExpected: %s", tc.JSON, got, tc.Expected)
+		}
+	}
+}
+
+func TestDecodeErrors(t *testing.T) {
+	cases := []struct {
+		JSON     string
+		Expected string
+	}{
+		{``, `unexpected end of JSON at offset 0`},
+		{`[]`, `unexpected '[' at offset 0`},
+		{`{"id": 1`, `unexpected end of JSON at offset 8`},
+		{`{"id": 1,}`, `unexpected '}' at offset 9`},
+		{`{"id" 1}`, `unexpected '1' at offset 6`},
+		{`{"id": 1.5}`, `expected integer at offset 10`},
+		{`{"small": 128}`, `integer overflow at offset 13`},
+		{`{"small": -129}`, `integer overflow at offset 14`},
+		{`{"big": -1}`, `expected integer at offset 10`},
+		{`{"id": "1"}`, `unexpected '"' at offset 7`},
+		{`{"title": "a` + "\n" + `"}`, `control character in string at offset 12`},
+		{`{"title": "\x"}`, `invalid escape in string at offset 12`},
+		{`{"title": "\u12"}`, `invalid escape in string at offset 12`},
+		{`{"title": "a`, `unexpected end of JSON at offset 12`},
+		{`{"unknown": "a\"`, `unexpected end of JSON at offset 16`},
+		{`{"unknown": "` + "\t" + `"}`, `control character in string at offset 13`},
+		{`{"active": yes}`, `unexpected 'y' at offset 11`},
+		{`{"unknown": [1 2]}`, `unexpected '2' at offset 15`},
+		{`{"unknown": -}`, `unexpected '}' at offset 13`},
+		{`{} {}`, `unexpected '{' at offset 3`},
+	}
+	for _, tc := range cases {
+		rec := &testRecord{}
+		if err := rec.DecodeJSON([]byte(tc.JSON)); err == nil || err.Error() != tc.Expected {
+			t.Errorf("%s\nGot: %v\nExpected: %s", tc.JSON, err, tc.Expected)
+		}
+	}
+}
+
+// TestDecodeUsers compares decoding of the whole log with `encoding/json`.
+func TestDecodeUsers(t *testing.T) {
+	data, err := ioutil.ReadFile(filePath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	user := &User{}
+	for i, line := range bytes.Split(data, []byte("\n")) {
+		if len(line) == 0 {
+			continue
+		}
+		if err = user.DecodeJSON(line); err != nil {
+			t.Fatalf("line %d: %s", i, err)
+		}
+		// the same fields in the same order, but as strings
+		var expected struct {
+			Browsers                                  []string
+			Company, Country, Email, Job, Name, Phone string
+		}
+		if err = json.Unmarshal(line, &expected); err != nil {
+			t.Fatal(err)
+		}
+		if got := fmt.Sprintf("%q", *user); got != fmt.Sprintf("%q", expected) {
+			t.Fatalf("line %d\nGot: %s\nExpected: %q", i, got, expected)
+		}
+	}
+}
+
+func TestDecodeAllocs(t *testing.T) {
+	line := []byte(`{"browsers":["Mozilla/5.0","Opera/9.80"],"company":"Flashpoint","country":"Dominican Republic",` +
+		`"email":"JonathanMorris@Muxo.edu","job":"Programmer Analyst #{N}","name":"Sharon Crawford",` +
+		`"phone":"176-88-49","unknown":{"a":[1,2.5e3,true,null,"A"]}}`)
+	user := &User{}
+	if err := user.DecodeJSON(line); err != nil {
+		t.Fatal(err)
+	}
+	if allocs := testing.AllocsPerRun(100, func() { user.DecodeJSON(line) }); allocs != 0 {
+		t.Errorf("Got: %v allocations\nExpected: 0", allocs)
+	}
+	if !reflect.DeepEqual(user.Browsers, [][]byte{[]byte("Mozilla/5.0"), []byte("Opera/9.80")}) {
+		t.Errorf("Got: %q", user.Browsers)
+	}
+}
@@ -0,0 +1,37 @@
+package main
+
+import (
+	"fmt"
+	"io"
+)
+
+// Mode selects what the search does with malformed lines.
+// Lines rejected by the prefilter of the search are not parsed, so they are never reported as malformed.
+type Mode int
+
+const (
+	// Strict stops the search at the first malformed line and returns it as `*LineError`.
+	Strict Mode = iota
+	// Lenient skips malformed lines and returns them with the results.
+	Lenient
+)
+
+// LineError describes a malformed line of the log.
+type LineError struct {
+	// Line is the number of the line counted from 0, the same as in the search results.
+	Line uint64
+	// Offset is the offset of the line start in the decompressed log.
+	Offset int64
+	Err    error
+}
+
+func (e *LineError) Error() string {
+	return fmt.Sprintf("line %d at offset %d: %s", e.Line, e.Offset, e.Err)
+}
+
+// closeErr closes `c` and stores the error into `err` unless it already holds one, it's meant for `defer`.
+func closeErr(c io.Closer, err *error) {
+	if cerr := c.Close(); cerr != nil && *err == nil {
+		*err = cerr
+	}
+}
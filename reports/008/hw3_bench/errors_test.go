@@ -0,0 +1,128 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"testing"
+)
+
+// malformedLog returns the log with malformed lines inserted, the same log with the lines replaced by empty objects
+// and the positions of the malformed lines.
+func malformedLog(t *testing.T) (malformed, replaced []byte, positions []string) {
+	data, err := ioutil.ReadFile(filePath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	lines := bytes.SplitAfter(data, []byte("\n"))
+	bad := map[int][]byte{
+		3:   []byte(`{"browsers":["MSIE 7.0"],` + "\n"),
+		501: []byte(`Android` + "\n"),
+	}
+	offset := 0
+	for i := 0; len(lines) > 0; i++ {
+		line, ok := bad[i]
+		if ok {
+			positions = append(positions, fmt.Sprintf("%d:%d", i, offset))
+			replaced = append(replaced, "{}\n"...)
+		} else {
+			line, lines = lines[0], lines[1:]
+			replaced = append(replaced, line...)
+		}
+		malformed = append(malformed, line...)
+		offset += len(line)
+	}
+	return malformed, replaced, positions
+}
+
+func TestSearchLenient(t *testing.T) {
+	malformed, replaced, positions := malformedLog(t)
+	expected := new(bytes.Buffer)
+	if _, err := DefaultSearch.RunReader(expected, bytes.NewReader(replaced), Strict); err != nil {
+		t.Fatal(err)
+	}
+	log, cleanup := tempLog(t, malformed)
+	defer cleanup()
+
+	check := func(t *testing.T, out *bytes.Buffer, skipped []*LineError, err error) {
+		if err != nil {
+			t.Fatal(err)
+		}
+		if out.String() != expected.String() {
+			t.Errorf("results not match\nGot:\n%v\nExpected:\n%v", out.String(), expected.String())
+		}
+		var got []string
+		for _, lineErr := range skipped {
+			got = append(got, fmt.Sprintf("%d:%d", lineErr.Line, lineErr.Offset))
+		}
+		if fmt.Sprint(got) != fmt.Sprint(positions) {
+			t.Errorf("skipped lines\nGot: %v\nExpected: %v", got, positions)
+		}
+	}
+	t.Run("reader", func(t *testing.T) {
+		out := new(bytes.Buffer)
+		skipped, err := DefaultSearch.RunReader(out, bytes.NewReader(malformed), Lenient)
+		check(t, out, skipped, err)
+	})
+	for _, workers := range []int{1, 3, 8} {
+		t.Run(fmt.Sprintf("workers=%d", workers), func(t *testing.T) {
+			out := new(bytes.Buffer)
+			skipped, err := DefaultSearch.RunParallel(out, ParallelOptions{Path: log, Workers: workers, Mmap: workers == 3, Mode: Lenient})
+			check(t, out, skipped, err)
+		})
+	}
+}
+
+func TestSearchStrict(t *testing.T) {
+	malformed, _, positions := malformedLog(t)
+	log, cleanup := tempLog(t, malformed)
+	defer cleanup()
+
+	check := func(t *testing.T, out *bytes.Buffer, err error) {
+		lineErr, ok := err.(*LineError)
+		if !ok {
+			t.Fatalf("Got: %v\nExpected: *LineError", err)
+		}
+		if got := fmt.Sprintf("%d:%d", lineErr.Line, lineErr.Offset); got != positions[0] {
+			t.Errorf("Got: %s\nExpected: %s", got, positions[0])
+		}
+		if out.Len() != 0 {
+			t.Errorf("results written on error")
+		}
+	}
+	t.Run("reader", func(t *testing.T) {
+		out := new(bytes.Buffer)
+		_, err := DefaultSearch.RunReader(out, bytes.NewReader(malformed), Strict)
+		check(t, out, err)
+	})
+	for _, workers := range []int{1, 3, 8} {
+		t.Run(fmt.Sprintf("workers=%d", workers), func(t *testing.T) {
+			out := new(bytes.Buffer)
+			_, err := DefaultSearch.RunParallel(out, ParallelOptions{Path: log, Workers: workers, Mmap: workers == 3})
+			check(t, out, err)
+		})
+	}
+}
+
+// failingWriter fails every write.
+type failingWriter struct{}
+
+var errWrite = errors.New("write failed")
+
+func (failingWriter) Write(p []byte) (int, error) {
+	return 0, errWrite
+}
+
+func TestSearchErrors(t *testing.T) {
+	if _, err := DefaultSearch.Run(failingWriter{}, Strict); err != errWrite {
+		t.Errorf("Got: %v\nExpected: %v", err, errWrite)
+	}
+	expected := "./data/missing.txt: no such file"
+	if _, err := DefaultSearch.RunSource(ioutil.Discard, "./data/missing.txt", Strict); err == nil || err.Error() != expected {
+		t.Errorf("Got: %v\nExpected: %s", err, expected)
+	}
+	if _, err := DefaultSearch.RunParallel(ioutil.Discard, ParallelOptions{Path: "./data/missing.txt"}); err == nil {
+		t.Errorf("missing file accepted")
+	}
+}
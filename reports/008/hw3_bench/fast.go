@@ -1,98 +1,263 @@
 package main
 
 import (
-	"bufio"
 	"bytes"
 	"io"
-	"os"
 	"strconv"
-	"strings"
-
-	"github.com/mailru/easyjson"
-	"github.com/mailru/easyjson/jlexer"
 )
 
-// Close allows not to ignore potential error inside `defer`.
-func Close(c io.Closer) {
-	err := c.Close()
+// Search is a report over the users log compiled from queries.
+type Search struct {
+	// Users selects the users which are listed.
+	Users *Query
+	// Browsers selects the browsers which are counted as unique, its predicates over `browsers` see one browser at a time.
+	Browsers *Query
+	// Precision selects how unique browsers are counted: 0 counts them exactly in a hash set,
+	// a value from `MinPrecision` to `MaxPrecision` estimates the number with `HyperLogLog` of that precision.
+	Precision int
+	// Output configures the format of the results, nil means the output of `FastSearch`.
+	Output *Output
+
+	// prefilter holds byte strings one of which is present in every line worth parsing, nil disables it.
+	prefilter [][]byte
+}
+
+// NewSearch compiles the search listing users matching `users` and counting unique browsers matching `browsers`.
+func NewSearch(users, browsers string) (*Search, error) {
+	u, err := ParseQuery(users)
+	if err != nil {
+		return nil, err
+	}
+	b, err := ParseQuery(browsers)
+	if err != nil {
+		return nil, err
+	}
+	s := &Search{Users: u, Browsers: b}
+	if ul, bl := u.root.literals(), b.root.literals(); ul != nil && bl != nil {
+		s.prefilter = append(ul[:len(ul):len(ul)], bl...)
+	}
+	return s, nil
+}
+
+// MustNewSearch is like `NewSearch` but panics on error.
+func MustNewSearch(users, browsers string) *Search {
+	s, err := NewSearch(users, browsers)
 	if err != nil {
 		panic(err)
 	}
+	return s
 }
 
+// DefaultSearch lists users of both Android and MSIE and counts unique browsers of either kind.
+var DefaultSearch = MustNewSearch(
+	`browsers contains "Android" AND browsers contains "MSIE"`,
+	`browsers contains "Android" OR browsers contains "MSIE"`,
+)
+
 // FastSearch reads log output from `filePath` and outputs all unique users and browsers.
+// It panics on any error, use `Search.Run` to handle them.
 func FastSearch(out io.Writer) {
-	f, err := os.Open(filePath)
-	defer Close(f)
-	if err != nil {
+	if _, err := DefaultSearch.Run(out, Strict); err != nil {
 		panic(err)
 	}
+}
 
-	s := bufio.NewScanner(f)
-	seenBrowsers, foundUsers, isAndroid, isMSIE, user, i, j :=
-		make([][]byte, 0, 128), make([]byte, 0, 8192), false, false, &User{}, uint64(0), 0
-	foundUsers = append(foundUsers, []byte("found users:\n")...)
-	for ; s.Scan(); i++ {
-		if bytes.Contains(s.Bytes(), []byte("Android")) || bytes.Contains(s.Bytes(), []byte("MSIE")) {
-			err := easyjson.Unmarshal(s.Bytes(), user)
-			if err != nil {
-				panic(err)
-			}
-			isAndroid, isMSIE = false, false
-			for _, browser := range user.Browsers {
-				if bytes.Contains(browser, []byte("Android")) {
-					isAndroid = true
-					notSeenBefore := true
-					for _, item := range seenBrowsers {
-						if bytes.Equal(item, browser) {
-							notSeenBefore = false
-							break
-						}
-					}
-					if notSeenBefore {
-						temp := append(browser[:0:0], browser...)
-						seenBrowsers = append(seenBrowsers, temp)
-					}
-				} else if bytes.Contains(browser, []byte("MSIE")) {
-					isMSIE = true
-					notSeenBefore := true
-					for _, item := range seenBrowsers {
-						if bytes.Equal(item, browser) {
-							notSeenBefore = false
-							break
-						}
-					}
-					if notSeenBefore {
-						temp := append(browser[:0:0], browser...)
-						seenBrowsers = append(seenBrowsers, temp)
-					}
-				}
-			}
-			if isAndroid && isMSIE {
-				j = strings.Index(user.Email, "@")
-				foundUsers = append(foundUsers, []byte("[")...)
-				foundUsers = strconv.AppendUint(foundUsers, i, 10)
-				foundUsers = append(foundUsers, []byte("] ")...)
-				foundUsers = append(foundUsers, []byte(user.Name)...)
-				foundUsers = append(foundUsers, []byte(" <")...)
-				foundUsers = append(foundUsers, []byte(user.Email[:j])...)
-				foundUsers = append(foundUsers, []byte(" [at] ")...)
-				foundUsers = append(foundUsers, []byte(user.Email[j+1:])...)
-				foundUsers = append(foundUsers, []byte(">\n")...)
-			}
+// Run reads log output from `filePath` and outputs the matching users and the number of unique matching browsers.
+// The malformed lines skipped in `Lenient` mode are returned, in `Strict` mode nothing is written on error.
+func (s *Search) Run(out io.Writer, mode Mode) ([]*LineError, error) {
+	return s.RunSource(out, filePath, mode)
+}
+
+// RunSource is `Run` over the source opened by `OpenSource`.
+func (s *Search) RunSource(out io.Writer, name string, mode Mode) (skipped []*LineError, err error) {
+	in, err := OpenSource(name)
+	if err != nil {
+		return nil, err
+	}
+	defer closeErr(in, &err)
+	return s.RunReader(out, in, mode)
+}
+
+// RunReader is `Run` over the log read from the input as is, compressed input is read with `Decompress`.
+func (s *Search) RunReader(out io.Writer, in io.Reader, mode Mode) ([]*LineError, error) {
+	res, err := s.newResult(mode)
+	if err != nil {
+		return nil, err
+	}
+	if err = s.scanReader(in, res); err != nil {
+		return nil, err
+	}
+	return res.skipped, s.report(out, res)
+}
+
+// result holds the output of the search over a part of the log.
+type result struct {
+	mode Mode
+	// lines is the number of lines in the part, `offset` is the offset of the next one in the log.
+	lines  uint64
+	offset int64
+	// chunk is set for the parts scanned in parallel which lines are numbered only once the preceding parts are scanned.
+	chunk bool
+	// found holds matched users formatted as "[line] name <email>\n". In a chunk the line is left out:
+	// `ends` are the end offsets of the users and `indexes` are their line numbers counted from the start of the chunk.
+	found   []byte
+	ends    []int
+	indexes []uint64
+	// browsers counts the unique matching browsers seen in the part.
+	browsers counter
+	// skipped are the malformed lines with numbers counted from the start of the part.
+	skipped []*LineError
+	// records are matched users with line numbers counted from the start of the part, they are used instead of
+	// `found` when the search has `Output`.
+	records []UserRecord
+	user    User
+}
+
+// newResult returns the empty result of the search.
+func (s *Search) newResult(mode Mode) (*result, error) {
+	res := &result{mode: mode, found: make([]byte, 0, 8192)}
+	if s.Precision == 0 {
+		res.browsers = make(hashSet, 128)
+		return res, nil
+	}
+	hll, err := NewHyperLogLog(s.Precision)
+	res.browsers = hll
+	return res, err
+}
+
+// scanReader runs the search over all lines of the reader.
+func (s *Search) scanReader(r io.Reader, res *result) error {
+	sc := newLineScanner(r)
+	for sc.Scan() {
+		if err := s.line(sc.Bytes(), sc.size, res); err != nil {
+			return err
 		}
 	}
-	if err = s.Err(); err != nil {
-		panic(err)
+	return sc.Err()
+}
+
+// line runs the search over the next line of the part which takes `size` bytes in the log.
+// It returns `*LineError` if the line is malformed in `Strict` mode.
+func (s *Search) line(line []byte, size int, res *result) error {
+	i, offset := res.lines, res.offset
+	res.lines++
+	res.offset += int64(size)
+	if !s.worthParsing(line) {
+		return nil
+	}
+	user := &res.user
+	if err := user.DecodeJSON(line); err != nil {
+		lineErr := &LineError{Line: i, Offset: offset, Err: err}
+		if res.mode == Strict {
+			return lineErr
+		}
+		res.skipped = append(res.skipped, lineErr)
+		return nil
+	}
+	for _, browser := range user.Browsers {
+		if !s.Browsers.MatchBrowser(user, browser) {
+			continue
+		}
+		res.browsers.add(browser)
+	}
+	if s.Users.Match(user) {
+		s.found(res, i, user)
+	}
+	return nil
+}
+
+// found adds the matched user from the line with the given number to the result.
+func (s *Search) found(res *result, i uint64, user *User) {
+	if s.Output == nil {
+		res.add(i, user)
+		return
+	}
+	res.records = append(res.records, s.Output.record(i, user))
+}
+
+// add appends the matched user from the line with the given number.
+func (res *result) add(i uint64, user *User) {
+	j := bytes.IndexByte(user.Email, '@')
+	if !res.chunk {
+		res.found = append(res.found, '[')
+		res.found = strconv.AppendUint(res.found, i, 10)
+		res.found = append(res.found, ']')
+	}
+	res.found = append(res.found, ' ')
+	res.found = append(res.found, user.Name...)
+	res.found = append(res.found, []byte(" <")...)
+	if j < 0 {
+		res.found = append(res.found, user.Email...)
+	} else {
+		res.found = append(res.found, user.Email[:j]...)
+		res.found = append(res.found, []byte(" [at] ")...)
+		res.found = append(res.found, user.Email[j+1:]...)
+	}
+	res.found = append(res.found, []byte(">\n")...)
+	if res.chunk {
+		res.ends = append(res.ends, len(res.found))
+		res.indexes = append(res.indexes, i)
+	}
+}
+
+// report writes the results of consecutive parts of the log, numbering lines across all of them.
+func (s *Search) report(out io.Writer, parts ...*result) error {
+	for _, res := range parts[1:] {
+		parts[0].browsers.merge(res.browsers)
+	}
+	unique := parts[0].browsers.count()
+	if s.Output != nil {
+		report, err := s.Output.report(parts, unique)
+		if err != nil {
+			return err
+		}
+		_, err = out.Write(report)
+		return err
+	}
+
+	// users of a single part are numbered already, so they are written as is
+	foundUsers := parts[0].found
+	if len(parts) > 1 || parts[0].chunk {
+		size := 0
+		for _, res := range parts {
+			size += len(res.found) + 16*len(res.indexes)
+		}
+		foundUsers = make([]byte, 0, size+64)
+		base := uint64(0)
+		for _, res := range parts {
+			start := 0
+			for k, end := range res.ends {
+				foundUsers = append(foundUsers, '[')
+				foundUsers = strconv.AppendUint(foundUsers, base+res.indexes[k], 10)
+				foundUsers = append(foundUsers, ']')
+				foundUsers = append(foundUsers, res.found[start:end]...)
+				start = end
+			}
+			base += res.lines
+		}
 	}
 
 	foundUsers = append(foundUsers, []byte("\nTotal unique browsers ")...)
-	foundUsers = strconv.AppendUint(foundUsers, uint64(len(seenBrowsers)), 10)
+	foundUsers = strconv.AppendUint(foundUsers, unique, 10)
 	foundUsers = append(foundUsers, []byte("\n")...)
-	err = write(out, string(foundUsers))
-	if err != nil {
-		panic(err)
+	if err := write(out, "found users:\n"); err != nil {
+		return err
+	}
+	_, err := out.Write(foundUsers)
+	return err
+}
+
+// worthParsing reports whether the raw line may contain a matching user or browser.
+func (s *Search) worthParsing(line []byte) bool {
+	if s.prefilter == nil {
+		return true
+	}
+	for _, lit := range s.prefilter {
+		if bytes.Contains(line, lit) {
+			return true
+		}
 	}
+	return false
 }
 
 // write performs buffered write of entire string.
@@ -104,61 +269,16 @@ func write(out io.Writer, str string) (err error) {
 	return
 }
 
+//go:generate go run ./decoder_gen fast.go fast_decoder.go
+
 // User holds the useful part of data from one line of log file.
+// jsongen:decode
 type User struct {
 	Browsers [][]byte `json:"browsers"`
-	Email    string   `json:"email"`
-	Name     string   `json:"name"`
-}
-
-// UnmarshalEasyJSON implements easyjson.Unmarshaler interface for type User.
-func (out *User) UnmarshalEasyJSON(in *jlexer.Lexer) {
-	isTopLevel := in.IsStart()
-	if in.IsNull() {
-		if isTopLevel {
-			in.Consumed()
-		}
-		in.Skip()
-		return
-	}
-	in.Delim('{')
-	for !in.IsDelim('}') {
-		key := in.UnsafeString()
-		in.WantColon()
-		if in.IsNull() {
-			in.Skip()
-			in.WantComma()
-			continue
-		}
-		switch key {
-		case "browsers":
-			if in.IsNull() {
-				in.Skip()
-				out.Browsers = (out.Browsers)[:0]
-			} else {
-				in.Delim('[')
-				if out.Browsers == nil {
-					out.Browsers = make([][]byte, 0, 4)
-				} else {
-					out.Browsers = (out.Browsers)[:0]
-				}
-				for !in.IsDelim(']') {
-					out.Browsers = append(out.Browsers, in.UnsafeBytes())
-					in.WantComma()
-				}
-				in.Delim(']')
-			}
-		case "email":
-			out.Email = in.UnsafeString()
-		case "name":
-			out.Name = in.UnsafeString()
-		default:
-			in.SkipRecursive()
-		}
-		in.WantComma()
-	}
-	in.Delim('}')
-	if isTopLevel {
-		in.Consumed()
-	}
+	Company  []byte   `json:"company"`
+	Country  []byte   `json:"country"`
+	Email    []byte   `json:"email"`
+	Job      []byte   `json:"job"`
+	Name     []byte   `json:"name"`
+	Phone    []byte   `json:"phone"`
 }
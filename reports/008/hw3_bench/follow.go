@@ -0,0 +1,239 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"time"
+)
+
+// FollowOptions configure `Search.Follow`.
+type FollowOptions struct {
+	// Path is the followed file, `filePath` by default.
+	Path string
+	// Poll is the interval of checking the file for new lines, 250ms by default.
+	Poll time.Duration
+	// FromEnd skips the lines already in the file like `tail -n 0 -f`.
+	FromEnd bool
+	Mode    Mode
+	// Skipped is called with the malformed lines skipped in `Lenient` mode.
+	Skipped func(*LineError)
+}
+
+// Follow runs the search as a live monitor of the log until the context is done: it reads the file, then keeps
+// reading lines appended to it and writes the matched users as soon as they arrive followed by the number
+// of unique browsers whenever it changes. The file may be truncated or rotated by renaming it and creating
+// the new one, the rest of the old file is read before switching to the new one.
+// Lines are numbered across all files read since following started, offsets of malformed lines are counted from
+// the start of their file. Compressed files can't be followed.
+func (s *Search) Follow(ctx context.Context, out io.Writer, opts FollowOptions) (err error) {
+	if opts.Path == "" {
+		opts.Path = filePath
+	}
+	if opts.Poll <= 0 {
+		opts.Poll = time.Second / 4
+	}
+	res, err := s.newResult(opts.Mode)
+	if err != nil {
+		return err
+	}
+	fl := &follower{path: opts.Path, buf: make([]byte, 64<<10)}
+	if err = fl.open(); err != nil {
+		return err
+	}
+	defer func() {
+		closeErr(fl.f, &err)
+	}()
+	if opts.FromEnd {
+		if fl.pos, err = fl.f.Seek(0, io.SeekEnd); err != nil {
+			return err
+		}
+		res.offset = fl.pos
+	}
+	header := new(bytes.Buffer)
+	if s.Output == nil {
+		header.WriteString("found users:\n")
+	} else if err = s.Output.header(header); err != nil {
+		return err
+	}
+	if err = write(out, header.String()); err != nil {
+		return err
+	}
+
+	var unique uint64
+	for ctx.Err() == nil {
+		read, err := fl.read(func(line []byte, size int) error {
+			return s.line(line, size, res)
+		})
+		if err != nil {
+			return err
+		}
+		if read > 0 {
+			if err = s.flush(out, res, &unique, opts.Skipped); err != nil {
+				return err
+			}
+		}
+
+		switched, err := fl.check(func(line []byte, size int) error {
+			return s.line(line, size, res)
+		})
+		if err != nil {
+			return err
+		}
+		if switched {
+			// offsets in the new file are counted from its start
+			res.offset = 0
+			if err = s.flush(out, res, &unique, opts.Skipped); err != nil {
+				return err
+			}
+			continue
+		}
+		if read == 0 {
+			select {
+			case <-ctx.Done():
+				return nil
+			case <-time.After(opts.Poll):
+			}
+		}
+	}
+	return nil
+}
+
+// flush writes the users found since the last flush and the number of unique browsers if it changed.
+func (s *Search) flush(out io.Writer, res *result, unique *uint64, skipped func(*LineError)) error {
+	buf := new(bytes.Buffer)
+	buf.Write(res.found)
+	for k := range res.records {
+		if err := s.Output.user(buf, &res.records[k]); err != nil {
+			return err
+		}
+	}
+	res.found, res.records = res.found[:0], res.records[:0]
+	if n := res.browsers.count(); n != *unique {
+		*unique = n
+		if s.Output == nil {
+			fmt.Fprintf(buf, "Total unique browsers %d\n", n)
+		} else if err := s.Output.total(buf, n, false); err != nil {
+			return err
+		}
+	}
+	if skipped != nil {
+		for _, lineErr := range res.skipped {
+			skipped(lineErr)
+		}
+	}
+	res.skipped = res.skipped[:0]
+	return write(out, buf.String())
+}
+
+// follower reads lines appended to the file.
+type follower struct {
+	path string
+	f    *os.File
+	info os.FileInfo
+	// pos is the read position in the file, `pending` is the unterminated line read before it.
+	pos     int64
+	pending []byte
+	buf     []byte
+}
+
+// open opens the file at the path, the current file is left to the caller to close.
+func (fl *follower) open() error {
+	f, err := os.Open(fl.path)
+	if err != nil {
+		return err
+	}
+	info, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return err
+	}
+	fl.f, fl.info, fl.pos, fl.pending = f, info, 0, fl.pending[:0]
+	return nil
+}
+
+// read passes the complete lines appended to the file since the last call to `line`
+// and returns the number of bytes read.
+func (fl *follower) read(line func(line []byte, size int) error) (int64, error) {
+	var read int64
+	for {
+		n, err := fl.f.Read(fl.buf)
+		read += int64(n)
+		fl.pos += int64(n)
+		data := fl.buf[:n]
+		for len(data) > 0 {
+			i := bytes.IndexByte(data, '\n')
+			if i < 0 {
+				fl.pending = append(fl.pending, data...)
+				break
+			}
+			chunk := data[:i]
+			if len(fl.pending) > 0 {
+				fl.pending = append(fl.pending, chunk...)
+				chunk = fl.pending
+			}
+			if lerr := line(dropCR(chunk), len(chunk)+1); lerr != nil {
+				return read, lerr
+			}
+			fl.pending = fl.pending[:0]
+			data = data[i+1:]
+		}
+		if err == io.EOF {
+			return read, nil
+		}
+		if err != nil {
+			return read, err
+		}
+	}
+}
+
+// check detects truncation and rotation of the file and reports whether it switched to the new one.
+// On rotation the rest of the old file including its unterminated last line is passed to `line` first.
+func (fl *follower) check(line func(line []byte, size int) error) (switched bool, err error) {
+	info, err := os.Stat(fl.path)
+	if os.IsNotExist(err) {
+		// the old file is renamed and the new one is not created yet
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	if os.SameFile(info, fl.info) {
+		if info.Size() >= fl.pos {
+			return false, nil
+		}
+		// the file is truncated, the unterminated line is gone with it
+		if _, err = fl.f.Seek(0, io.SeekStart); err != nil {
+			return false, err
+		}
+		fl.pos, fl.pending = 0, fl.pending[:0]
+		return true, nil
+	}
+
+	old := *fl
+	if err = fl.open(); err != nil {
+		*fl = old
+		if os.IsNotExist(err) {
+			return false, nil
+		}
+		return false, err
+	}
+	defer closeErr(old.f, &err)
+	if _, err = old.read(line); err != nil {
+		return false, err
+	}
+	if len(old.pending) > 0 {
+		err = line(dropCR(old.pending), len(old.pending))
+	}
+	return true, err
+}
+
+// dropCR drops the terminal \r like `bufio.ScanLines`.
+func dropCR(line []byte) []byte {
+	if len(line) > 0 && line[len(line)-1] == '\r' {
+		return line[:len(line)-1]
+	}
+	return line
+}
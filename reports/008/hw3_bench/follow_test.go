@@ -0,0 +1,150 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// syncBuffer is `bytes.Buffer` safe for concurrent use.
+type syncBuffer struct {
+	mu  sync.Mutex
+	buf bytes.Buffer
+}
+
+func (b *syncBuffer) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.Write(p)
+}
+
+func (b *syncBuffer) String() string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.String()
+}
+
+// follow runs the monitor of the log in the background, the returned function stops it.
+func follow(t *testing.T, s *Search, opts FollowOptions) (*syncBuffer, func() error) {
+	out := new(syncBuffer)
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	opts.Poll = 5 * time.Millisecond
+	go func() {
+		done <- s.Follow(ctx, out, opts)
+	}()
+	return out, func() error {
+		cancel()
+		return <-done
+	}
+}
+
+// waitOutput waits for the monitor to write the expected output.
+func waitOutput(t *testing.T, out *syncBuffer, expected string) {
+	deadline := time.Now().Add(5 * time.Second)
+	for out.String() != expected {
+		if time.Now().After(deadline) {
+			t.Fatalf("Got:\n%s\nExpected:\n%s", out.String(), expected)
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+// appendLog appends the lines to the log.
+func appendLog(t *testing.T, log string, lines ...string) {
+	f, err := os.OpenFile(log, os.O_APPEND|os.O_WRONLY|os.O_CREATE, 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err = f.WriteString(strings.Join(lines, "")); err != nil {
+		t.Fatal(err)
+	}
+	if err = f.Close(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+var (
+	bothUser   = `{"browsers":["Android 4.0","MSIE 8.0"],"email":"a@b.c","name":"Both"}` + "\n"
+	msieUser   = `{"browsers":["MSIE 9.0"],"email":"m@b.c","name":"Msie"}` + "\n"
+	bothUser2  = `{"browsers":["Android 5.0","MSIE 8.0","Chrome"],"email":"x@y.z","name":"Again"}` + "\n"
+	unrelated  = `{"browsers":["Chrome"],"email":"c@b.c","name":"Chrome"}` + "\n"
+	malformedA = `{"browsers":["Android"` + "\n"
+)
+
+func TestFollow(t *testing.T) {
+	log, cleanup := tempLog(t, []byte(bothUser+unrelated))
+	defer cleanup()
+	out, stop := follow(t, DefaultSearch, FollowOptions{Path: log})
+
+	expected := "found users:\n[0] Both <a [at] b.c>\nTotal unique browsers 2\n"
+	waitOutput(t, out, expected)
+
+	// the line is written in parts
+	appendLog(t, log, msieUser[:10])
+	time.Sleep(20 * time.Millisecond)
+	appendLog(t, log, msieUser[10:], bothUser2[:20])
+	expected += "Total unique browsers 3\n"
+	waitOutput(t, out, expected)
+	appendLog(t, log, bothUser2[20:])
+	expected += "[3] Again <x [at] y.z>\nTotal unique browsers 4\n"
+	waitOutput(t, out, expected)
+
+	// truncation: line numbering continues
+	if err := os.Truncate(log, 0); err != nil {
+		t.Fatal(err)
+	}
+	appendLog(t, log, unrelated, bothUser)
+	expected += "[5] Both <a [at] b.c>\n"
+	waitOutput(t, out, expected)
+
+	// rotation: the rest of the old file is read before switching to the new one
+	if err := os.Rename(log, log+".1"); err != nil {
+		t.Fatal(err)
+	}
+	appendLog(t, log+".1", `{"browsers":["MSIE 10.0"],"email":"r@b.c","name":"Rest"}`)
+	appendLog(t, log, bothUser2)
+	expected += "Total unique browsers 5\n[7] Again <x [at] y.z>\n"
+	waitOutput(t, out, expected)
+
+	if err := stop(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestFollowFromEnd(t *testing.T) {
+	log, cleanup := tempLog(t, []byte(bothUser))
+	defer cleanup()
+	var skipped []*LineError
+	var mu sync.Mutex
+	out, stop := follow(t, DefaultSearch, FollowOptions{Path: log, FromEnd: true, Mode: Lenient, Skipped: func(lineErr *LineError) {
+		mu.Lock()
+		skipped = append(skipped, lineErr)
+		mu.Unlock()
+	}})
+	waitOutput(t, out, "found users:\n")
+	appendLog(t, log, malformedA, bothUser2)
+	waitOutput(t, out, "found users:\n[1] Again <x [at] y.z>\nTotal unique browsers 2\n")
+	if err := stop(); err != nil {
+		t.Fatal(err)
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	if len(skipped) != 1 || skipped[0].Line != 0 || skipped[0].Offset != int64(len(bothUser)) {
+		t.Errorf("Got: %v\nExpected: line 0 at offset %d", skipped, len(bothUser))
+	}
+}
+
+func TestFollowStrict(t *testing.T) {
+	log, cleanup := tempLog(t, []byte(bothUser+malformedA))
+	defer cleanup()
+	out := new(syncBuffer)
+	err := DefaultSearch.Follow(context.Background(), out, FollowOptions{Path: log})
+	if lineErr, ok := err.(*LineError); !ok || lineErr.Line != 1 || lineErr.Offset != int64(len(bothUser)) {
+		t.Errorf("Got: %v\nExpected: line 1 at offset %d", err, len(bothUser))
+	}
+}
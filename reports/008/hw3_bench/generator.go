@@ -0,0 +1,331 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"math/rand"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// GeneratorOptions configure `Generate`, use `DefaultGeneratorOptions` for a log resembling `data/users.txt`.
+type GeneratorOptions struct {
+	// Lines is the number of lines to write, Size is the minimal size of the log in bytes.
+	// Generation stops at whichever is reached first, 1000 lines are written if both are zero.
+	Lines int
+	Size  int64
+	// Seed makes the log reproducible, the same options always produce the same log.
+	Seed int64
+	// BrowserMix weights the browser families of `GeneratedFamilies`, families missing from the mix aren't generated.
+	BrowserMix map[string]float64
+	// Browsers is the number of browsers of each user, 4 by default. Users with both Android and MSIE have at least 2.
+	Browsers int
+	// AndroidMSIE is the fraction of users having both Android and MSIE browsers, the ones found by `DefaultSearch`.
+	// The rest of users never have both.
+	AndroidMSIE float64
+	// Malformed is the fraction of malformed lines.
+	Malformed float64
+}
+
+// GeneratorStats describe the generated log.
+type GeneratorStats struct {
+	Lines       int
+	Bytes       int64
+	AndroidMSIE int
+	Malformed   int
+}
+
+// DefaultGeneratorOptions returns the options of the log with the same distributions as `data/users.txt`.
+func DefaultGeneratorOptions() GeneratorOptions {
+	return GeneratorOptions{
+		Lines: 1000,
+		BrowserMix: map[string]float64{
+			"Other": 966, "Firefox": 682, "Chrome": 665, "Safari": 599, "IE": 335, "Opera": 325,
+			"Android Browser": 281, "Bot": 87, "Chrome Mobile iOS": 31, "Edge": 29,
+		},
+		Browsers:    4,
+		AndroidMSIE: 0.083,
+	}
+}
+
+// GeneratedFamilies are the browser families `Generate` makes user agents of,
+// the names are the ones returned by `ParseUserAgent`.
+var GeneratedFamilies = []string{
+	"Chrome", "Chrome Mobile iOS", "Edge", "Firefox", "IE", "Opera", "Safari", "Android Browser", "Bot", "Other",
+}
+
+// ParseBrowserMix parses the mix like "Chrome=5,IE=1".
+func ParseBrowserMix(mix string) (map[string]float64, error) {
+	res := make(map[string]float64)
+	for _, item := range strings.Split(mix, ",") {
+		eq := strings.LastIndexByte(item, '=')
+		if eq < 0 {
+			return nil, fmt.Errorf("browser mix item %q is not family=weight", item)
+		}
+		weight, err := strconv.ParseFloat(item[eq+1:], 64)
+		if err != nil {
+			return nil, fmt.Errorf("browser mix item %q: %s", item, err)
+		}
+		res[strings.TrimSpace(item[:eq])] = weight
+	}
+	return res, nil
+}
+
+var (
+	genFirstNames = []string{
+		"Sharon", "Susan", "Jonathan", "Maria", "Ralph", "Jessica", "Gerald", "Kathy", "Victor", "Irene",
+		"Douglas", "Anna", "Howard", "Judith", "Carlos", "Diana", "Peter", "Martha", "Bruce", "Helen",
+	}
+	genLastNames = []string{
+		"Crawford", "Ellis", "Morris", "Ramos", "Hunt", "Palmer", "Gordon", "Stone", "Warren", "Jordan",
+		"Fisher", "Black", "Perry", "Simmons", "Cox", "Wells", "Medina", "Fuller", "Bishop", "Hayes",
+	}
+	genCompanies = []string{
+		"Flashpoint", "Jatri", "Muxo", "Topiczoom", "Skinix", "Yodel", "Quimba", "Realbuzz", "Twinte", "Eabox",
+		"Zoombox", "Divanoodle", "Feedfire", "Kwilith", "Linktype", "Oyoloo", "Rhybox", "Thoughtworks", "Vinte", "Wikizz",
+	}
+	genDomains   = []string{"com", "org", "net", "edu", "info", "biz", "name", "gov", "mil"}
+	genCountries = []string{
+		"Dominican Republic", "Kenya", "Brazil", "Russia", "China", "Indonesia", "Nigeria", "France", "Peru", "Mongolia",
+		"Canada", "Germany", "Japan", "Mexico", "Poland", "Sweden", "Vietnam", "Egypt", "Chile", "Norway",
+	}
+	genJobs = []string{
+		"Programmer Analyst #{N}", "Web Developer #{N}", "Software Engineer #{N}", "Accountant #{N}", "Nurse",
+		"Geologist", "Marketing Manager", "Desktop Support Technician", "Financial Advisor", "Teacher",
+		"Statistician #{N}", "Help Desk Operator", "Environmental Specialist", "Research Assistant #{N}", "VP Sales",
+	}
+	genDesktops = []string{
+		"Windows NT 6.1; WOW64", "Windows NT 10.0; Win64; x64", "Windows NT 6.3", "X11; Linux x86_64",
+		"X11; FreeBSD amd64", "Macintosh; Intel Mac OS X 10_12_6", "Macintosh; Intel Mac OS X 10_9_5",
+	}
+	genPhones = []string{"Nexus 5", "GT-I9300", "HTC One", "LG-P500", "SM-G900F", "T-Mobile_G2_Touch", "Xperia Z"}
+	genBuilds = []string{"CUPCAKE", "FRF91", "GRJ22", "IMM76D", "JZO54K", "KOT49H", "LRX22G", "MRA58K"}
+	genOthers = []string{
+		"LG-LX550 AU-MIC-LX550/2.0 MMP/2.0 Profile/MIDP-2.0 Configuration/CLDC-1.1",
+		"Nokia6300/2.0 (05.00) Profile/MIDP-2.0 Configuration/CLDC-1.1",
+		"SAMSUNG-SGH-E250/1.0 Profile/MIDP-2.0 Configuration/CLDC-1.1 UP.Link/6.3.0.0.0",
+		"MOT-V3/0E.40.3CR MIB/2.2.1 Profile/MIDP-2.0 Configuration/CLDC-1.0",
+		"SonyEricssonK750i/R1AA Browser/SEMC-Browser/4.2 Profile/MIDP-2.0 Configuration/CLDC-1.1",
+		"curl/7.%d.0",
+		"Wget/1.%d (linux-gnu)",
+	}
+	genBots = []string{
+		"Mozilla/5.0 (compatible; Googlebot/2.%d; +http://www.google.com/bot.html)",
+		"Mozilla/5.0 (compatible; bingbot/2.%d; +http://www.bing.com/bingbot.htm)",
+		"Mozilla/5.0 (compatible; YandexBot/3.%d; +http://yandex.com/bots)",
+		"Mozilla/5.0 (compatible; Baiduspider/2.%d; +http://www.baidu.com/search/spider.html)",
+	}
+)
+
+// agent returns the random user agent of the family from `GeneratedFamilies`.
+func agent(r *rand.Rand, family string) string {
+	desktop := genDesktops[r.Intn(len(genDesktops))]
+	chrome := fmt.Sprintf("Chrome/%d.0.%d.%d", 10+r.Intn(70), 500+r.Intn(3500), r.Intn(200))
+	switch family {
+	case "Chrome":
+		return fmt.Sprintf("Mozilla/5.0 (%s) AppleWebKit/537.36 (KHTML, like Gecko) %s Safari/537.36", desktop, chrome)
+	case "Chrome Mobile iOS":
+		return fmt.Sprintf("Mozilla/5.0 (iPhone; CPU iPhone OS %d_%d like Mac OS X) AppleWebKit/601.1 (KHTML, like Gecko) "+
+			"CriOS/%d.0.%d.%d Mobile/14A5335b Safari/601.1.46", 7+r.Intn(6), r.Intn(4), 30+r.Intn(40), 1000+r.Intn(3000), r.Intn(200))
+	case "Edge":
+		return fmt.Sprintf("Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36 (KHTML, like Gecko) %s "+
+			"Safari/537.36 Edge/%d.%d", chrome, 12+r.Intn(7), 10000+r.Intn(8000))
+	case "Firefox":
+		v := 3 + r.Intn(70)
+		return fmt.Sprintf("Mozilla/5.0 (%s; rv:%d.0) Gecko/20100101 Firefox/%d.0", desktop, v, v)
+	case "IE":
+		v := 5 + r.Intn(6)
+		return fmt.Sprintf("Mozilla/4.0 (compatible; MSIE %d.0; Windows NT %d.%d; Trident/%d.0)", v, 5+r.Intn(2), r.Intn(3), v-4)
+	case "Opera":
+		return fmt.Sprintf("Opera/9.80 (%s) Presto/2.%d.%d Version/%d.%d", desktop, 2+r.Intn(11), 100+r.Intn(300), 9+r.Intn(4), r.Intn(70))
+	case "Safari":
+		v := 4 + r.Intn(8)
+		return fmt.Sprintf("Mozilla/5.0 (Macintosh; Intel Mac OS X 10_%d_%d) AppleWebKit/60%d.1.%d (KHTML, like Gecko) "+
+			"Version/%d.%d Safari/60%d.1.%d", 6+r.Intn(8), r.Intn(8), r.Intn(5), r.Intn(60), v, r.Intn(3), r.Intn(5), r.Intn(60))
+	case "Android Browser":
+		return fmt.Sprintf("Mozilla/5.0 (Linux; U; Android %d.%d; en-us; %s Build/%s) AppleWebKit/534.30 (KHTML, like Gecko) "+
+			"Version/4.0 Mobile Safari/534.30", 1+r.Intn(4), r.Intn(5), genPhones[r.Intn(len(genPhones))],
+			genBuilds[r.Intn(len(genBuilds))])
+	case "Bot":
+		return fmt.Sprintf(genBots[r.Intn(len(genBots))], r.Intn(10))
+	default:
+		ua := genOthers[r.Intn(len(genOthers))]
+		if strings.Contains(ua, "%d") {
+			ua = fmt.Sprintf(ua, 10+r.Intn(50))
+		}
+		return ua
+	}
+}
+
+// generator holds the state of `Generate`.
+type generator struct {
+	opts     GeneratorOptions
+	r        *rand.Rand
+	families []string
+	// weights are cumulative weights of `families`.
+	weights  []float64
+	browsers []string
+	line     []byte
+}
+
+// Generate writes the synthetic users log in the format of `data/users.txt`.
+func Generate(out io.Writer, opts GeneratorOptions) (stats GeneratorStats, err error) {
+	if opts.Lines <= 0 && opts.Size <= 0 {
+		opts.Lines = 1000
+	}
+	if opts.Browsers <= 0 {
+		opts.Browsers = 4
+	}
+	g := &generator{opts: opts, r: rand.New(rand.NewSource(opts.Seed))}
+	// families go in a fixed order so that the log does not depend on the map iteration order
+	total := 0.0
+	for _, family := range GeneratedFamilies {
+		if weight := opts.BrowserMix[family]; weight > 0 {
+			total += weight
+			g.families = append(g.families, family)
+			g.weights = append(g.weights, total)
+		}
+	}
+	for family, weight := range opts.BrowserMix {
+		if !containsString(GeneratedFamilies, family) {
+			return stats, fmt.Errorf("unknown browser family %q, expected one of %s", family, strings.Join(GeneratedFamilies, ", "))
+		}
+		if weight < 0 {
+			return stats, fmt.Errorf("negative weight of browser family %q", family)
+		}
+	}
+	if len(g.families) == 0 {
+		return stats, fmt.Errorf("browser mix is empty")
+	}
+
+	w := bufio.NewWriterSize(out, 64<<10)
+	for (opts.Lines <= 0 || stats.Lines < opts.Lines) && (opts.Size <= 0 || stats.Bytes < opts.Size) {
+		both := g.r.Float64() < opts.AndroidMSIE
+		if err = g.user(both); err != nil {
+			return stats, err
+		}
+		if g.r.Float64() < opts.Malformed {
+			g.corrupt()
+			stats.Malformed++
+		} else if both {
+			stats.AndroidMSIE++
+		}
+		g.line = append(g.line, '\n')
+		if _, err = w.Write(g.line); err != nil {
+			return stats, err
+		}
+		stats.Lines++
+		stats.Bytes += int64(len(g.line))
+	}
+	return stats, w.Flush()
+}
+
+// family returns the random browser family according to the mix.
+func (g *generator) family() string {
+	x := g.r.Float64() * g.weights[len(g.weights)-1]
+	return g.families[sort.SearchFloat64s(g.weights, x)]
+}
+
+// user formats the random user into `line`, `both` tells whether the user has both Android and MSIE browsers.
+func (g *generator) user(both bool) error {
+	for attempt := 0; ; attempt++ {
+		if attempt == 100 {
+			return fmt.Errorf("browser mix makes users without both Android and MSIE browsers too rare")
+		}
+		g.browsers = g.browsers[:0]
+		for k := 0; k < g.opts.Browsers; k++ {
+			g.browsers = append(g.browsers, agent(g.r, g.family()))
+		}
+		if both {
+			// Android and MSIE browsers are put at random places, they need at least two places
+			if len(g.browsers) == 1 {
+				g.browsers = append(g.browsers, "")
+			}
+			i := g.r.Intn(len(g.browsers))
+			g.browsers[i] = agent(g.r, "Android Browser")
+			j := (i + 1 + g.r.Intn(len(g.browsers)-1)) % len(g.browsers)
+			g.browsers[j] = agent(g.r, "IE")
+			break
+		}
+		android, msie := false, false
+		for _, browser := range g.browsers {
+			android = android || strings.Contains(browser, "Android")
+			msie = msie || strings.Contains(browser, "MSIE")
+		}
+		if !android || !msie {
+			break
+		}
+	}
+
+	first, last := genFirstNames[g.r.Intn(len(genFirstNames))], genLastNames[g.r.Intn(len(genLastNames))]
+	company := genCompanies[g.r.Intn(len(genCompanies))]
+	var email string
+	switch g.r.Intn(3) {
+	case 0:
+		email = first + last
+	case 1:
+		email = strings.ToLower(first + "." + last)
+	default:
+		email = strings.ToLower(last) + strconv.Itoa(g.r.Intn(1000))
+	}
+	email += "@" + genCompanies[g.r.Intn(len(genCompanies))] + "." + genDomains[g.r.Intn(len(genDomains))]
+
+	g.line = append(g.line[:0], `{"browsers":[`...)
+	for k, browser := range g.browsers {
+		if k > 0 {
+			g.line = append(g.line, ',')
+		}
+		g.line = appendJSONString(g.line, browser)
+	}
+	fields := [...]struct{ key, val string }{
+		{"company", company},
+		{"country", genCountries[g.r.Intn(len(genCountries))]},
+		{"email", email},
+		{"job", genJobs[g.r.Intn(len(genJobs))]},
+		{"name", first + " " + last},
+		{"phone", fmt.Sprintf("%03d-%02d-%02d", 100+g.r.Intn(900), g.r.Intn(100), g.r.Intn(100))},
+	}
+	g.line = append(g.line, ']')
+	for _, f := range fields {
+		g.line = append(g.line, `,"`...)
+		g.line = append(g.line, f.key...)
+		g.line = append(g.line, `":`...)
+		g.line = appendJSONString(g.line, f.val)
+	}
+	g.line = append(g.line, '}')
+	return nil
+}
+
+// corrupt turns `line` into a malformed one.
+func (g *generator) corrupt() {
+	switch g.r.Intn(3) {
+	case 0:
+		// a cut off line, as after a crash in the middle of a write
+		g.line = g.line[:1+g.r.Intn(len(g.line)-1)]
+	case 1:
+		g.line = append(g.line[:0], `{"browsers":"`...)
+		g.line = append(g.line, agent(g.r, g.family())...)
+		g.line = append(g.line, `","name":null}`...)
+	default:
+		g.line = append(g.line[:0], "ERROR: "...)
+		g.line = append(g.line, g.browsers[0]...)
+	}
+}
+
+// appendJSONString appends the string quoted as JSON.
+func appendJSONString(buf []byte, s string) []byte {
+	buf = append(buf, '"')
+	for i := 0; i < len(s); i++ {
+		switch c := s[i]; {
+		case c == '"' || c == '\\':
+			buf = append(buf, '\\', c)
+		case c < ' ':
+			buf = append(buf, fmt.Sprintf(`\u%04x`, c)...)
+		default:
+			buf = append(buf, c)
+		}
+	}
+	return append(buf, '"')
+}
@@ -0,0 +1,221 @@
+package main
+
+import (
+	"bytes"
+	"io"
+	"io/ioutil"
+	"math"
+	"os"
+	"strings"
+	"testing"
+)
+
+func TestGenerateReproducible(t *testing.T) {
+	opts := DefaultGeneratorOptions()
+	opts.Seed, opts.Malformed = 42, 0.01
+	a, b := new(bytes.Buffer), new(bytes.Buffer)
+	if _, err := Generate(a, opts); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := Generate(b, opts); err != nil {
+		t.Fatal(err)
+	}
+	if a.String() != b.String() {
+		t.Error("the same seed produced different logs")
+	}
+	opts.Seed++
+	b.Reset()
+	if _, err := Generate(b, opts); err != nil {
+		t.Fatal(err)
+	}
+	if a.String() == b.String() {
+		t.Error("different seeds produced the same log")
+	}
+}
+
+func TestGenerateDistributions(t *testing.T) {
+	opts := DefaultGeneratorOptions()
+	opts.Lines, opts.Seed, opts.AndroidMSIE, opts.Malformed = 20000, 1, 0.2, 0.05
+	opts.BrowserMix = map[string]float64{"Chrome": 3, "IE": 1, "Android Browser": 1, "Bot": 0}
+	data := new(bytes.Buffer)
+	stats, err := Generate(data, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stats.Lines != opts.Lines || stats.Bytes != int64(data.Len()) {
+		t.Errorf("Got: %d lines of %d bytes\nExpected: %d lines of %d bytes", stats.Lines, stats.Bytes, opts.Lines, data.Len())
+	}
+
+	// all lines but the corrupted ones are parsed, and the users found match the statistics
+	skipped, err := DefaultSearch.RunReader(ioutil.Discard, bytes.NewReader(data.Bytes()), Lenient)
+	if err != nil {
+		t.Fatal(err)
+	}
+	malformed, families := 0, make(map[string]int)
+	user := &User{}
+	found := 0
+	for _, line := range bytes.Split(bytes.TrimSuffix(data.Bytes(), []byte("\n")), []byte("\n")) {
+		if user.DecodeJSON(line) != nil || len(user.Browsers) != opts.Browsers {
+			malformed++
+			continue
+		}
+		if DefaultSearch.Users.Match(user) {
+			found++
+		}
+		for _, browser := range user.Browsers {
+			families[ParseUserAgent(string(browser)).Family]++
+		}
+	}
+	if malformed != stats.Malformed || found != stats.AndroidMSIE {
+		t.Errorf("Got: %d malformed, %d found\nExpected: %d malformed, %d found", malformed, found, stats.Malformed, stats.AndroidMSIE)
+	}
+	if len(skipped) > malformed {
+		t.Errorf("Got: %d skipped lines\nExpected: at most %d", len(skipped), malformed)
+	}
+
+	// shares are compared with a tolerance of 5 standard deviations
+	check := func(name string, got, n int, p float64) {
+		if sigma := math.Sqrt(p * (1 - p) / float64(n)); math.Abs(float64(got)/float64(n)-p) > 5*sigma {
+			t.Errorf("%s\nGot: %.4f\nExpected: %.4f", name, float64(got)/float64(n), p)
+		}
+	}
+	check("malformed", stats.Malformed, stats.Lines, opts.Malformed)
+	check("android+msie", stats.AndroidMSIE, stats.Lines-stats.Malformed, opts.AndroidMSIE)
+	if families["Bot"] != 0 || len(families) != 3 {
+		t.Errorf("Got: %v\nExpected: Chrome, IE and Android Browser only", families)
+	}
+}
+
+func TestGenerateBrowserMix(t *testing.T) {
+	// the mix has no Android and MSIE pair, otherwise the shares are skewed by the selection of users without it
+	opts := GeneratorOptions{Lines: 5000, Seed: 7, BrowserMix: map[string]float64{"Chrome": 3, "Firefox": 1, "Opera": 0.5}}
+	data := new(bytes.Buffer)
+	if _, err := Generate(data, opts); err != nil {
+		t.Fatal(err)
+	}
+	families, browsers := make(map[string]int), 0
+	user := &User{}
+	for _, line := range strings.Split(strings.TrimSpace(data.String()), "\n") {
+		if err := user.DecodeJSON([]byte(line)); err != nil {
+			t.Fatal(err)
+		}
+		for _, browser := range user.Browsers {
+			families[ParseUserAgent(string(browser)).Family]++
+			browsers++
+		}
+	}
+	for family, weight := range opts.BrowserMix {
+		p := weight / 4.5
+		got := float64(families[family]) / float64(browsers)
+		if sigma := math.Sqrt(p * (1 - p) / float64(browsers)); math.Abs(got-p) > 5*sigma {
+			t.Errorf("%s\nGot: %.4f\nExpected: %.4f", family, got, p)
+		}
+	}
+}
+
+func TestGenerateFamilies(t *testing.T) {
+	opts := GeneratorOptions{Lines: 200, Browsers: 1}
+	for _, family := range GeneratedFamilies {
+		opts.BrowserMix = map[string]float64{family: 1}
+		data := new(bytes.Buffer)
+		if _, err := Generate(data, opts); err != nil {
+			t.Fatal(err)
+		}
+		user := &User{}
+		for _, line := range strings.Split(strings.TrimSpace(data.String()), "\n") {
+			if err := user.DecodeJSON([]byte(line)); err != nil {
+				t.Fatal(err)
+			}
+			if got := ParseUserAgent(string(user.Browsers[0])).Family; got != family {
+				t.Fatalf("%s\nGot: %s\nExpected: %s", user.Browsers[0], got, family)
+			}
+		}
+	}
+}
+
+func TestGenerateSize(t *testing.T) {
+	opts := DefaultGeneratorOptions()
+	opts.Lines, opts.Size = 0, 100000
+	data := new(bytes.Buffer)
+	stats, err := Generate(data, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	last := strings.LastIndex(strings.TrimSuffix(data.String(), "\n"), "\n") + 1
+	if stats.Bytes < opts.Size || int64(last) >= opts.Size {
+		t.Errorf("Got: %d bytes\nExpected: the first line reaching %d bytes", stats.Bytes, opts.Size)
+	}
+}
+
+func TestGenerateErrors(t *testing.T) {
+	cases := []struct {
+		Mix      string
+		Android  float64
+		Expected string
+	}{
+		{"Chrome=1,Netscape=2", 0, `unknown browser family "Netscape", expected one of ` + strings.Join(GeneratedFamilies, ", ")},
+		{"Chrome=-1", 0, `negative weight of browser family "Chrome"`},
+		{"Chrome=0", 0, `browser mix is empty`},
+		{"IE=1,Android Browser=1", 0, `browser mix makes users without both Android and MSIE browsers too rare`},
+		{"Chrome", 0, `browser mix item "Chrome" is not family=weight`},
+	}
+	for _, tc := range cases {
+		mix, err := ParseBrowserMix(tc.Mix)
+		if err == nil {
+			_, err = Generate(ioutil.Discard, GeneratorOptions{BrowserMix: mix, Browsers: 8, AndroidMSIE: tc.Android})
+		}
+		if err == nil || err.Error() != tc.Expected {
+			t.Errorf("%s\nGot: %v\nExpected: %s", tc.Mix, err, tc.Expected)
+		}
+	}
+}
+
+// generatedLog writes the generated log of `logMB` megabytes, see `benchLog`.
+func generatedLog(b *testing.B) (string, func()) {
+	return benchLog(b, func(w io.Writer, size int64) error {
+		opts := DefaultGeneratorOptions()
+		opts.Lines, opts.Size, opts.Malformed = 0, size, 0.001
+		_, err := Generate(w, opts)
+		return err
+	})
+}
+
+// go test -bench Generated -benchmem -run ^$ -log-mb 4096 (or HW3_BENCH_MB=4096) for multi-GB file
+
+func BenchmarkGenerated(b *testing.B) {
+	path, cleanup := generatedLog(b)
+	defer cleanup()
+	info, err := os.Stat(path)
+	if err != nil {
+		b.Fatal(err)
+	}
+	b.Run("scan", func(b *testing.B) {
+		b.SetBytes(info.Size())
+		for i := 0; i < b.N; i++ {
+			if _, err := DefaultSearch.RunSource(ioutil.Discard, path, Lenient); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+	b.Run("parallel", func(b *testing.B) {
+		b.SetBytes(info.Size())
+		for i := 0; i < b.N; i++ {
+			if _, err := DefaultSearch.RunParallel(ioutil.Discard, ParallelOptions{Path: path, Mode: Lenient}); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+}
+
+func BenchmarkGenerate(b *testing.B) {
+	opts := DefaultGeneratorOptions()
+	opts.Lines = 10000
+	b.SetBytes(0)
+	for i := 0; i < b.N; i++ {
+		stats, err := Generate(ioutil.Discard, opts)
+		if err != nil {
+			b.Fatal(err)
+		}
+		b.SetBytes(stats.Bytes)
+	}
+}
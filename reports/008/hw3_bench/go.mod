@@ -2,4 +2,4 @@ module github.com/vadimpiven/vpn-from-scratch/reports/008/hw3_bench
 
 go 1.12
 
-require github.com/mailru/easyjson v0.0.0-20190626092158-b2ccc519800e
+require github.com/klauspost/compress v1.9.8
@@ -0,0 +1,481 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/gob"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"os"
+	"sort"
+)
+
+// IndexedFields are the fields with few distinct values which are put into the index.
+// Predicates over other fields are checked by parsing the candidate lines.
+var IndexedFields = []Field{FieldBrowsers, FieldCompany, FieldCountry, FieldJob}
+
+// fingerprintLen is the number of bytes at the start and at the end of the indexed part of the log
+// which are compared to detect that the log was rewritten rather than appended to.
+const fingerprintLen = 4096
+
+// Index is an inverted index over the users log stored in the file next to it, see `IndexPath`.
+type Index struct {
+	// Size is the number of indexed bytes at the start of the log.
+	Size int64
+	// Fingerprint is the checksum of the first and the last bytes of the indexed part.
+	Fingerprint uint32
+	// Lines are the offsets of the indexed lines.
+	Lines []int64
+	// Partial is true if the last indexed line is not terminated and may be continued by the next write.
+	Partial bool
+	// Malformed are the sorted numbers of the lines skipped in `Lenient` mode, they have no indexed values.
+	Malformed []uint32
+	// Values map values of indexed fields to the sorted numbers of the lines containing them.
+	Values map[Field]map[string][]uint32
+}
+
+// IndexPath returns the path of the index of the log.
+func IndexPath(log string) string {
+	return log + ".idx"
+}
+
+// LoadIndex reads the index of the log.
+func LoadIndex(log string) (ix *Index, err error) {
+	f, err := os.Open(IndexPath(log))
+	if err != nil {
+		return nil, err
+	}
+	defer closeErr(f, &err)
+	ix = &Index{}
+	if err = gob.NewDecoder(f).Decode(ix); err != nil {
+		return nil, fmt.Errorf("index %s: %s", IndexPath(log), err)
+	}
+	return ix, nil
+}
+
+// UpdateIndex brings the index of the log up to date and saves it.
+// The index is created if it doesn't exist, extended if the log was appended to and rebuilt otherwise.
+// The malformed lines of the newly indexed part are returned in `Lenient` mode, in `Strict` mode the index is not saved.
+func UpdateIndex(log string, mode Mode) (ix *Index, skipped []*LineError, err error) {
+	f, err := os.Open(log)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer closeErr(f, &err)
+	info, err := f.Stat()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	ix, _ = LoadIndex(log)
+	if ix != nil {
+		switch fresh, grown, err := ix.check(f, info.Size()); {
+		case err != nil:
+			return nil, nil, err
+		case fresh:
+			return ix, nil, nil
+		case !grown:
+			ix = nil
+		}
+	}
+	if ix == nil {
+		ix = &Index{}
+	}
+	if skipped, err = ix.extend(f, info.Size(), mode); err != nil {
+		return nil, nil, err
+	}
+	return ix, skipped, ix.save(log)
+}
+
+// save writes the index next to the log atomically.
+func (ix *Index) save(log string) error {
+	tmp := IndexPath(log) + ".tmp"
+	f, err := os.Create(tmp)
+	if err != nil {
+		return err
+	}
+	if err = gob.NewEncoder(f).Encode(ix); err != nil {
+		f.Close()
+		return err
+	}
+	if err = f.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp, IndexPath(log))
+}
+
+// check reports whether the index covers the whole log and whether the log was only appended to since then.
+func (ix *Index) check(r io.ReaderAt, size int64) (fresh, grown bool, err error) {
+	if size < ix.Size {
+		return false, false, nil
+	}
+	sum, err := fingerprint(r, ix.Size)
+	if err != nil || sum != ix.Fingerprint {
+		return false, false, err
+	}
+	return size == ix.Size, true, nil
+}
+
+// Fresh reports whether the index covers the whole log and can be used to answer queries.
+func (ix *Index) Fresh(log string) (fresh bool, err error) {
+	f, err := os.Open(log)
+	if err != nil {
+		return false, err
+	}
+	defer closeErr(f, &err)
+	info, err := f.Stat()
+	if err != nil {
+		return false, err
+	}
+	fresh, _, err = ix.check(f, info.Size())
+	return fresh, err
+}
+
+// fingerprint returns the checksum of the first and the last bytes of the part of the log.
+func fingerprint(r io.ReaderAt, size int64) (uint32, error) {
+	head := fingerprintLen
+	if int64(head) > size {
+		head = int(size)
+	}
+	tail := head
+	if size-int64(tail) < int64(head) {
+		tail = int(size) - head
+	}
+	buf := make([]byte, head+tail)
+	if _, err := r.ReadAt(buf[:head], 0); err != nil && err != io.EOF {
+		return 0, err
+	}
+	if _, err := r.ReadAt(buf[head:], size-int64(tail)); err != nil && err != io.EOF {
+		return 0, err
+	}
+	return crc32.ChecksumIEEE(buf), nil
+}
+
+// extend indexes the part of the log after the indexed one.
+func (ix *Index) extend(r io.ReaderAt, size int64, mode Mode) (skipped []*LineError, err error) {
+	if ix.Values == nil {
+		ix.Values = make(map[Field]map[string][]uint32)
+	}
+	for _, field := range IndexedFields {
+		if ix.Values[field] == nil {
+			ix.Values[field] = make(map[string][]uint32)
+		}
+	}
+	if ix.Partial {
+		// the unterminated line may have been completed since, so it is indexed again
+		last := uint32(len(ix.Lines) - 1)
+		ix.Size = ix.Lines[last]
+		ix.Lines = ix.Lines[:last]
+		for _, values := range ix.Values {
+			for val, lines := range values {
+				if lines[len(lines)-1] == last {
+					if len(lines) == 1 {
+						delete(values, val)
+					} else {
+						values[val] = lines[:len(lines)-1]
+					}
+				}
+			}
+		}
+		if n := len(ix.Malformed); n > 0 && ix.Malformed[n-1] == last {
+			ix.Malformed = ix.Malformed[:n-1]
+		}
+	}
+
+	user := &User{}
+	sc := newLineScanner(io.NewSectionReader(r, ix.Size, size-ix.Size))
+	off := ix.Size
+	for sc.Scan() {
+		line := uint32(len(ix.Lines))
+		ix.Lines = append(ix.Lines, off)
+		off += int64(sc.size)
+		ix.Partial = sc.partial
+		if err := user.DecodeJSON(sc.Bytes()); err != nil {
+			lineErr := &LineError{Line: uint64(line), Offset: ix.Lines[line], Err: err}
+			if mode == Strict {
+				return nil, lineErr
+			}
+			ix.Malformed = append(ix.Malformed, line)
+			skipped = append(skipped, lineErr)
+			continue
+		}
+		for _, field := range IndexedFields {
+			values := ix.Values[field]
+			user.any(field, nil, func(val []byte) bool {
+				lines := values[string(val)]
+				if len(lines) == 0 || lines[len(lines)-1] != line {
+					values[string(val)] = append(lines, line)
+				}
+				return false
+			})
+		}
+	}
+	if err := sc.Err(); err != nil {
+		return nil, err
+	}
+	ix.Size = size
+	ix.Fingerprint, err = fingerprint(r, size)
+	return skipped, err
+}
+
+// malformed reports whether the line was skipped as malformed when it was indexed.
+func (ix *Index) malformed(i uint32) bool {
+	k := sort.Search(len(ix.Malformed), func(k int) bool { return ix.Malformed[k] >= i })
+	return k < len(ix.Malformed) && ix.Malformed[k] == i
+}
+
+// lineScanner is `bufio.Scanner` splitting lines which keeps track of their size in the log.
+type lineScanner struct {
+	*bufio.Scanner
+	// size is the number of bytes the last line takes including the terminator.
+	size int
+	// partial is true if the last line is not terminated.
+	partial bool
+}
+
+func newLineScanner(r io.Reader) *lineScanner {
+	sc := &lineScanner{Scanner: bufio.NewScanner(r)}
+	sc.Split(func(data []byte, atEOF bool) (int, []byte, error) {
+		advance, token, err := bufio.ScanLines(data, atEOF)
+		if token != nil {
+			sc.size, sc.partial = advance, data[advance-1] != '\n'
+		}
+		return advance, token, err
+	})
+	return sc
+}
+
+// RunIndexed is `RunSource` over the given log which answers the queries from its index.
+// It falls back to scanning the log if the index is missing or stale.
+// Malformed lines are handled according to the mode the same way as by the scan.
+func (s *Search) RunIndexed(out io.Writer, log string, mode Mode) (skipped []*LineError, err error) {
+	f, err := os.Open(log)
+	if err != nil {
+		return nil, err
+	}
+	defer closeErr(f, &err)
+
+	info, err := f.Stat()
+	if err != nil {
+		return nil, err
+	}
+	res, err := s.newResult(mode)
+	if err != nil {
+		return nil, err
+	}
+	ix, _ := LoadIndex(log)
+	if ix != nil {
+		var fresh bool
+		if fresh, _, err = ix.check(f, info.Size()); err != nil {
+			return nil, err
+		}
+		if !fresh {
+			ix = nil
+		}
+	}
+	if ix == nil {
+		err = s.scanReader(f, res)
+	} else {
+		err = ix.search(f, s, res)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return res.skipped, s.report(out, res)
+}
+
+// search answers the queries of the search from the index.
+func (ix *Index) search(r io.ReaderAt, s *Search, res *result) error {
+	res.lines = uint64(len(ix.Lines))
+	user := &User{}
+	var buf []byte
+	// load reads the line with the given number into `buf`.
+	load := func(i uint32) error {
+		end := ix.Size
+		if int(i)+1 < len(ix.Lines) {
+			end = ix.Lines[i+1]
+		}
+		start := ix.Lines[i]
+		if cap(buf) < int(end-start) {
+			buf = make([]byte, end-start)
+		}
+		buf = buf[:end-start]
+		if _, err := r.ReadAt(buf, start); err != nil && err != io.EOF {
+			return err
+		}
+		buf = bytes.TrimRight(buf, "\r\n")
+		return nil
+	}
+	// read parses the line with the given number into `user`.
+	read := func(i uint32) error {
+		if err := load(i); err != nil {
+			return err
+		}
+		return user.DecodeJSON(buf)
+	}
+
+	// broken lines which would pass the prefilter are handled the same way as by the scan
+	for _, i := range ix.Malformed {
+		if err := load(i); err != nil {
+			return err
+		}
+		if !s.worthParsing(buf) {
+			continue
+		}
+		lineErr := &LineError{Line: uint64(i), Offset: ix.Lines[i], Err: user.DecodeJSON(buf)}
+		if res.mode == Strict {
+			return lineErr
+		}
+		res.skipped = append(res.skipped, lineErr)
+	}
+
+	browsers := ix.Values[FieldBrowsers]
+	names := make([]string, 0, len(browsers))
+	for browser := range browsers {
+		names = append(names, browser)
+	}
+	sort.Strings(names)
+	for _, browser := range names {
+		set, exact := ix.eval(s.Browsers.root, []byte(browser))
+		for _, i := range browsers[browser] {
+			if !set.has(i) {
+				continue
+			}
+			if !exact {
+				if err := read(i); err != nil {
+					return err
+				}
+				if !s.Browsers.MatchBrowser(user, []byte(browser)) {
+					continue
+				}
+			}
+			res.browsers.add([]byte(browser))
+			break
+		}
+	}
+
+	set, exact := ix.eval(s.Users.root, nil)
+	for i := range ix.Lines {
+		if !set.has(uint32(i)) || ix.malformed(uint32(i)) {
+			continue
+		}
+		if err := read(uint32(i)); err != nil {
+			return err
+		}
+		if exact || s.Users.Match(user) {
+			s.found(res, uint64(i), user)
+		}
+	}
+	return nil
+}
+
+// eval returns the lines which may match the query and whether all of them match it.
+// If `browser` is not nil, predicates over `browsers` are checked only against it.
+func (ix *Index) eval(n node, browser []byte) (lineSet, bool) {
+	switch n := n.(type) {
+	case *and:
+		left, leftExact := ix.eval(n.left, browser)
+		right, rightExact := ix.eval(n.right, browser)
+		return left.and(right), leftExact && rightExact
+	case *or:
+		left, leftExact := ix.eval(n.left, browser)
+		right, rightExact := ix.eval(n.right, browser)
+		return left.or(right), leftExact && rightExact
+	case *not:
+		set, exact := ix.eval(n.expr, browser)
+		if !exact {
+			return lineSet{all: true}, false
+		}
+		return set.not(len(ix.Lines)), true
+	case predicate:
+		if n.on() == FieldBrowsers && browser != nil {
+			return lineSet{all: n.test(browser)}, true
+		}
+		values, ok := ix.Values[n.on()]
+		if !ok {
+			return lineSet{all: true}, false
+		}
+		set := lineSet{}
+		for val, lines := range values {
+			if n.test([]byte(val)) {
+				set = set.with(lines, len(ix.Lines))
+			}
+		}
+		return set, true
+	}
+	panic(fmt.Sprintf("unexpected query node %T", n))
+}
+
+// lineSet is a set of line numbers, its zero value is empty.
+type lineSet struct {
+	all  bool
+	bits []uint64
+}
+
+func (s lineSet) has(i uint32) bool {
+	return s.all || (int(i/64) < len(s.bits) && s.bits[i/64]&(1<<(i%64)) != 0)
+}
+
+// with returns the set extended by the lines, it may modify the set.
+func (s lineSet) with(lines []uint32, n int) lineSet {
+	if s.all {
+		return s
+	}
+	if s.bits == nil {
+		s.bits = make([]uint64, (n+63)/64)
+	}
+	for _, i := range lines {
+		s.bits[i/64] |= 1 << (i % 64)
+	}
+	return s
+}
+
+func (s lineSet) and(o lineSet) lineSet {
+	switch {
+	case s.all:
+		return o
+	case o.all:
+		return s
+	case s.bits == nil || o.bits == nil:
+		return lineSet{}
+	}
+	res := make([]uint64, len(s.bits))
+	for k := range res {
+		res[k] = s.bits[k] & o.bits[k]
+	}
+	return lineSet{bits: res}
+}
+
+func (s lineSet) or(o lineSet) lineSet {
+	switch {
+	case s.all || o.all:
+		return lineSet{all: true}
+	case o.bits == nil:
+		return s
+	case s.bits == nil:
+		return o
+	}
+	res := make([]uint64, len(s.bits))
+	for k := range res {
+		res[k] = s.bits[k] | o.bits[k]
+	}
+	return lineSet{bits: res}
+}
+
+func (s lineSet) not(n int) lineSet {
+	switch {
+	case s.all:
+		return lineSet{}
+	case s.bits == nil:
+		return lineSet{all: true}
+	}
+	res := make([]uint64, len(s.bits))
+	for k := range res {
+		res[k] = ^s.bits[k]
+	}
+	if n%64 != 0 {
+		res[len(res)-1] &= 1<<uint(n%64) - 1
+	}
+	return lineSet{bits: res}
+}
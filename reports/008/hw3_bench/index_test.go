@@ -0,0 +1,221 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+// indexQueries are searches which are answered both from the index and by scanning.
+var indexQueries = []*Search{
+	DefaultSearch,
+	MustNewSearch(`country = "Kenya" OR company matches "^Ja"`, `browsers contains "Firefox" AND NOT country = "Kenya"`),
+	MustNewSearch(`name matches "^S" AND NOT browsers contains "Chrome"`, `browsers contains "Opera" AND email contains ".org"`),
+	MustNewSearch(`NOT (job contains "Developer" OR phone = "")`, `NOT browsers contains "Mozilla"`),
+}
+
+// tempLog writes the log into the temporary directory and returns its path.
+func tempLog(t *testing.T, data []byte) (string, func()) {
+	dir, err := ioutil.TempDir("", "hw3_index")
+	if err != nil {
+		t.Fatal(err)
+	}
+	log := filepath.Join(dir, "users.txt")
+	if err = ioutil.WriteFile(log, data, 0644); err != nil {
+		t.Fatal(err)
+	}
+	return log, func() {
+		os.RemoveAll(dir)
+	}
+}
+
+// checkIndexed compares the results and the errors of the indexed search with the ones of the scan.
+func checkIndexed(t *testing.T, log string, mode Mode) {
+	for _, s := range indexQueries {
+		expected, got := new(bytes.Buffer), new(bytes.Buffer)
+		expectedSkipped, expectedErr := s.RunParallel(expected, ParallelOptions{Path: log, Workers: 1, Mode: mode})
+		skipped, err := s.RunIndexed(got, log, mode)
+		if fmt.Sprint(err) != fmt.Sprint(expectedErr) || fmt.Sprint(skipped) != fmt.Sprint(expectedSkipped) {
+			t.Errorf("%s / %s\nGot:\n%v %v\nExpected:\n%v %v", s.Users, s.Browsers, skipped, err, expectedSkipped, expectedErr)
+		}
+		if got.String() != expected.String() {
+			t.Errorf("%s / %s\nGot:\n%v\nExpected:\n%v", s.Users, s.Browsers, got, expected)
+		}
+	}
+}
+
+func TestIndexSearch(t *testing.T) {
+	data, err := ioutil.ReadFile(filePath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	log, cleanup := tempLog(t, data)
+	defer cleanup()
+
+	// without the index the search falls back to the scan
+	checkIndexed(t, log, Strict)
+	ix, _, err := UpdateIndex(log, Strict)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if fresh, err := ix.Fresh(log); !fresh || err != nil {
+		t.Fatalf("new index is stale: %v", err)
+	}
+	checkIndexed(t, log, Strict)
+}
+
+func TestIndexUpdate(t *testing.T) {
+	data, err := ioutil.ReadFile(filePath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	lines := bytes.SplitAfter(data, []byte("\n"))
+	half := bytes.Join(lines[:len(lines)/2], nil)
+	// the last line of the half of the file is unterminated
+	log, cleanup := tempLog(t, half[:len(half)-1])
+	defer cleanup()
+	if _, _, err = UpdateIndex(log, Strict); err != nil {
+		t.Fatal(err)
+	}
+
+	f, err := os.OpenFile(log, os.O_APPEND|os.O_WRONLY, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err = f.Write(data[len(half)-1:]); err != nil {
+		t.Fatal(err)
+	}
+	if err = f.Close(); err != nil {
+		t.Fatal(err)
+	}
+	ix, err := LoadIndex(log)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if fresh, _ := ix.Fresh(log); fresh {
+		t.Errorf("index of the grown log is fresh")
+	}
+	checkIndexed(t, log, Strict)
+
+	updated, _, err := UpdateIndex(log, Strict)
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkIndexed(t, log, Strict)
+	if err = os.Remove(IndexPath(log)); err != nil {
+		t.Fatal(err)
+	}
+	rebuilt, _, err := UpdateIndex(log, Strict)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(updated, rebuilt) {
+		t.Errorf("updated index differs from the rebuilt one")
+	}
+}
+
+func TestIndexRewrite(t *testing.T) {
+	data, err := ioutil.ReadFile(filePath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	log, cleanup := tempLog(t, data)
+	defer cleanup()
+	if _, _, err = UpdateIndex(log, Strict); err != nil {
+		t.Fatal(err)
+	}
+
+	// a file of the same size but with different content
+	rewritten := bytes.Replace(data, []byte("Kenya"), []byte("Kenia"), -1)
+	if err = ioutil.WriteFile(log, rewritten, 0644); err != nil {
+		t.Fatal(err)
+	}
+	checkIndexed(t, log, Strict)
+	ix, _, err := UpdateIndex(log, Strict)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := ix.Values[FieldCountry]["Kenya"]; ok {
+		t.Errorf("index was not rebuilt")
+	}
+	checkIndexed(t, log, Strict)
+}
+
+func TestIndexMalformed(t *testing.T) {
+	log, cleanup := tempLog(t, []byte("{\"name\":\"a\"}\n{\"name\":]}\n"))
+	defer cleanup()
+	expected := `line 1 at offset 13: unexpected ']' at offset 8`
+	if _, _, err := UpdateIndex(log, Strict); err == nil || err.Error() != expected {
+		t.Errorf("Got: %v\nExpected: %s", err, expected)
+	}
+	ix, skipped, err := UpdateIndex(log, Lenient)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if fmt.Sprint(skipped) != "["+expected+"]" || fmt.Sprint(ix.Malformed) != "[1]" {
+		t.Errorf("Got: %v %v\nExpected: [%s] [1]", skipped, ix.Malformed, expected)
+	}
+}
+
+func TestIndexLenient(t *testing.T) {
+	data, err := ioutil.ReadFile(filePath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.HasSuffix(data, []byte("\n")) {
+		data = append(data, '\n')
+	}
+	lines := bytes.SplitAfter(data[:len(data)-1], []byte("\n"))
+	// broken lines in the middle and at the end, one of them passes the prefilter of the default search
+	broken := [][]byte{[]byte("{\"browsers\":[\"MSIE\"],]}\n"), []byte("{\"name\":]}\n")}
+	data = append(bytes.Join(append(append(append([][]byte{}, lines[:100]...), broken...), lines[100:]...), nil), '\n')
+	log, cleanup := tempLog(t, append(data, lines[0][:10]...))
+	defer cleanup()
+
+	ix, skipped, err := UpdateIndex(log, Lenient)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(skipped) != 3 || fmt.Sprint(ix.Malformed) != fmt.Sprintf("[100 101 %d]", len(lines)+2) {
+		t.Errorf("Got: %v %v", skipped, ix.Malformed)
+	}
+	checkIndexed(t, log, Lenient)
+	checkIndexed(t, log, Strict)
+
+	// the unterminated broken line is completed and is not broken anymore
+	f, err := os.OpenFile(log, os.O_APPEND|os.O_WRONLY, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err = f.Write(lines[0][10:]); err != nil {
+		t.Fatal(err)
+	}
+	if err = f.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if ix, _, err = UpdateIndex(log, Lenient); err != nil {
+		t.Fatal(err)
+	}
+	if fmt.Sprint(ix.Malformed) != "[100 101]" {
+		t.Errorf("Got: %v\nExpected: [100 101]", ix.Malformed)
+	}
+	checkIndexed(t, log, Lenient)
+}
+
+func BenchmarkIndexed(b *testing.B) {
+	path, cleanup := bigLog(b)
+	defer cleanup()
+	if _, _, err := UpdateIndex(path, Strict); err != nil {
+		b.Fatal(err)
+	}
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if _, err := DefaultSearch.RunIndexed(ioutil.Discard, path, Strict); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
@@ -0,0 +1,288 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+	"os/signal"
+	"strings"
+	"text/template"
+	"time"
+)
+
+// Usage: hw3_bench [-in users.txt] [-users query] [-browsers query] [-lenient] [-precision p] [-follow [-poll 250ms] [-from-end]]
+//                  [-parallel [-workers n] [-mmap] | -index]
+//                  [-format text|csv|json] [-template tmpl] [-fields name,email] [-email policy] [-phone policy] [-salt s]
+//        hw3_bench -report [-by family|version|os|device] [-group-by field] [-top n] [-users query]
+//                  [-in users.txt] [-lenient] [-format text|csv|json]
+//        hw3_bench -sql "SELECT name, email WHERE browsers CONTAINS 'MSIE' GROUP BY country ORDER BY count DESC LIMIT 10"
+//                  [-in users.txt] [-lenient] [-format text|csv|json] [-email policy] [-phone policy] [-salt s]
+//        hw3_bench -generate [-gen-lines n] [-gen-mb n] [-gen-seed n] [-gen-mix Chrome=5,IE=1] [-gen-android-msie f] [-gen-malformed f]
+//
+// Runs the search over the users log and prints the matched users and the number of unique matched browsers.
+// With `-parallel` it scans the uncompressed file in line-aligned chunks concurrently, see `RunParallel`.
+// With `-index` it answers the search from the index next to the file updating it first, see `UpdateIndex`.
+// With `-follow` it keeps watching the file like `tail -F` and prints new results as lines are appended.
+// With `-report` it prints the tables of the most popular browsers of `BrowserReport` instead,
+// only the users selected by `-users` are counted if it's given.
+// With `-sql` it runs the statement of `ParseStatement` instead, FROM of the statement overrides `-in`.
+// With `-generate` it writes the synthetic log to the standard output instead.
+
+// fail prints the error and exits.
+func fail(err error) {
+	fmt.Fprintln(os.Stderr, err)
+	os.Exit(1)
+}
+
+// checkSalt returns an error if any of the policies is `Hash` but the salt is empty:
+// unsalted hashes of phones and emails are easy to reverse by brute force.
+func checkSalt(salt string, policies ...Redaction) error {
+	for _, r := range policies {
+		if r == Hash && salt == "" {
+			return fmt.Errorf("-salt is required with hash redaction")
+		}
+	}
+	return nil
+}
+
+// output returns the output configured by the flags, nil if it's the output of `FastSearch`.
+func output(format, tmpl, fields, email, phone, salt string) (*Output, error) {
+	if format == "text" && tmpl == "" && email == "obfuscate" && phone == "keep" {
+		return nil, nil
+	}
+	o := &Output{Salt: salt}
+	var err error
+	if o.Format, err = ParseFormat(format); err != nil {
+		return nil, err
+	}
+	if tmpl != "" {
+		if o.Template, err = template.New("user").Parse(tmpl); err != nil {
+			return nil, err
+		}
+	}
+	for _, name := range strings.Split(fields, ",") {
+		f, err := ParseField(strings.TrimSpace(name))
+		if err != nil {
+			return nil, err
+		}
+		o.Fields = append(o.Fields, f)
+	}
+	if o.Email, err = ParseRedaction(email); err != nil {
+		return nil, err
+	}
+	if o.Phone, err = ParseRedaction(phone); err != nil {
+		return nil, err
+	}
+	if err = checkSalt(salt, o.Email, o.Phone); err != nil {
+		return nil, err
+	}
+	return o, nil
+}
+
+// runStatement runs the statement over the source.
+func runStatement(sql, in, format, email, phone, salt string, mode Mode) (skipped []*LineError, err error) {
+	st, err := ParseStatement(sql)
+	if err != nil {
+		return nil, err
+	}
+	opts := SQLOptions{Salt: salt, Mode: mode}
+	if opts.Format, err = ParseFormat(format); err != nil {
+		return nil, err
+	}
+	if opts.Email, err = ParseRedaction(email); err != nil {
+		return nil, err
+	}
+	if opts.Phone, err = ParseRedaction(phone); err != nil {
+		return nil, err
+	}
+	if err = checkSalt(salt, opts.Email, opts.Phone); err != nil {
+		return nil, err
+	}
+	if st.From != "" {
+		in = st.From
+	}
+	r, err := OpenSource(in)
+	if err != nil {
+		return nil, err
+	}
+	defer closeErr(r, &err)
+	return st.Run(os.Stdout, r, opts)
+}
+
+// flagSet reports whether the flag was given on the command line.
+func flagSet(name string) (set bool) {
+	flag.Visit(func(f *flag.Flag) {
+		set = set || f.Name == name
+	})
+	return set
+}
+
+// runReport prints the browser report over the source.
+func runReport(in, by, groupBy, format string, top int, users *Query, mode Mode) (skipped []*LineError, err error) {
+	opts := ReportOptions{Top: top, Users: users, Mode: mode}
+	if opts.By, err = ParseDimension(by); err != nil {
+		return nil, err
+	}
+	if groupBy != "" {
+		if opts.GroupBy, err = ParseField(groupBy); err != nil {
+			return nil, err
+		}
+		// `FieldBrowsers` means no grouping, and the tables already split users by their browsers
+		if opts.GroupBy == FieldBrowsers {
+			return nil, fmt.Errorf("-group-by %s is not supported, use -by to split users by browsers", groupBy)
+		}
+	}
+	if opts.Format, err = ParseFormat(format); err != nil {
+		return nil, err
+	}
+	r, err := OpenSource(in)
+	if err != nil {
+		return nil, err
+	}
+	defer closeErr(r, &err)
+	return BrowserReport(os.Stdout, r, opts)
+}
+
+func main() {
+	var (
+		in        = flag.String("in", filePath, "users log: file, glob of rotated files or - for stdin")
+		users     = flag.String("users", DefaultSearch.Users.String(), "query selecting the listed users")
+		browsers  = flag.String("browsers", DefaultSearch.Browsers.String(), "query selecting the counted browsers")
+		lenient   = flag.Bool("lenient", false, "skip malformed lines instead of stopping at the first one")
+		precision = flag.Int("precision", 0, "estimate unique browsers with HyperLogLog of this precision, 0 counts exactly")
+		follow    = flag.Bool("follow", false, "keep reading lines appended to the file")
+		poll      = flag.Duration("poll", time.Second/4, "interval of checking the followed file")
+		fromEnd   = flag.Bool("from-end", false, "follow only the lines appended after the start")
+		parallel  = flag.Bool("parallel", false, "scan the uncompressed file in chunks concurrently")
+		workers   = flag.Int("workers", 0, "number of chunks scanned concurrently with -parallel, 0 for all cores")
+		useMmap   = flag.Bool("mmap", false, "map the file into memory with -parallel")
+		index     = flag.Bool("index", false, "update the index next to the file and answer the search from it")
+
+		format = flag.String("format", "text", "output format: text, csv or json lines")
+		tmpl   = flag.String("template", "", "text/template of each found user in text format, like FastSearch by default")
+		fields = flag.String("fields", "name,email", "columns of csv and json formats")
+		email  = flag.String("email", "obfuscate", "redaction of emails: keep, obfuscate, mask, hash or drop")
+		phone  = flag.String("phone", "keep", "redaction of phones: keep, obfuscate, mask, hash or drop")
+		salt   = flag.String("salt", "", "salt of hashed fields, required with hash redaction")
+		sql    = flag.String("sql", "", "SQL-like statement to run instead of the search")
+
+		report  = flag.Bool("report", false, "print the most popular browsers instead of the search")
+		by      = flag.String("by", ByFamily.String(), "counted property of browsers: family, version, os or device")
+		groupBy = flag.String("group-by", "", "field of users other than browsers to make a separate report table for each of its values")
+		top     = flag.Int("top", 10, "number of rows in each report table")
+
+		defaults     = DefaultGeneratorOptions()
+		generate     = flag.Bool("generate", false, "write the synthetic log to the standard output")
+		genLines     = flag.Int("gen-lines", defaults.Lines, "number of generated lines, 0 for no limit")
+		genMB        = flag.Int64("gen-mb", 0, "minimal size of the generated log in megabytes, 0 for no limit")
+		genSeed      = flag.Int64("gen-seed", 0, "seed of the generated log")
+		genMix       = flag.String("gen-mix", "", "weights of browser families like Chrome=5,IE=1, the mix of users.txt by default")
+		genBoth      = flag.Float64("gen-android-msie", defaults.AndroidMSIE, "fraction of users with both Android and MSIE browsers")
+		genMalformed = flag.Float64("gen-malformed", 0, "fraction of malformed lines")
+	)
+	flag.Parse()
+
+	if *generate {
+		opts := defaults
+		opts.Lines, opts.Size, opts.Seed, opts.AndroidMSIE, opts.Malformed = *genLines, *genMB<<20, *genSeed, *genBoth, *genMalformed
+		if *genMix != "" {
+			mix, err := ParseBrowserMix(*genMix)
+			if err != nil {
+				fail(err)
+			}
+			opts.BrowserMix = mix
+		}
+		if _, err := Generate(os.Stdout, opts); err != nil {
+			fail(err)
+		}
+		return
+	}
+
+	mode := Strict
+	if *lenient {
+		mode = Lenient
+	}
+	reportSkipped := func(lineErr *LineError) {
+		fmt.Fprintf(os.Stderr, "skipped %s\n", lineErr)
+	}
+
+	if *sql != "" {
+		skipped, err := runStatement(*sql, *in, *format, *email, *phone, *salt, mode)
+		if err != nil {
+			fail(err)
+		}
+		for _, lineErr := range skipped {
+			reportSkipped(lineErr)
+		}
+		return
+	}
+
+	if *report {
+		var selected *Query
+		if flagSet("users") {
+			var err error
+			if selected, err = ParseQuery(*users); err != nil {
+				fail(err)
+			}
+		}
+		skipped, err := runReport(*in, *by, *groupBy, *format, *top, selected, mode)
+		if err != nil {
+			fail(err)
+		}
+		for _, lineErr := range skipped {
+			reportSkipped(lineErr)
+		}
+		return
+	}
+
+	s, err := NewSearch(*users, *browsers)
+	if err != nil {
+		fail(err)
+	}
+	s.Precision = *precision
+	if s.Output, err = output(*format, *tmpl, *fields, *email, *phone, *salt); err != nil {
+		fail(err)
+	}
+	if *follow {
+		ctx, cancel := context.WithCancel(context.Background())
+		interrupt := make(chan os.Signal, 1)
+		signal.Notify(interrupt, os.Interrupt)
+		go func() {
+			<-interrupt
+			cancel()
+		}()
+		opts := FollowOptions{Path: *in, Poll: *poll, FromEnd: *fromEnd, Mode: mode, Skipped: reportSkipped}
+		if err = s.Follow(ctx, os.Stdout, opts); err != nil {
+			fail(err)
+		}
+		return
+	}
+
+	if (*parallel || *index) && *in == Stdin {
+		fail(fmt.Errorf("-parallel and -index need a file, not the standard input"))
+	}
+	var skipped []*LineError
+	switch {
+	case *parallel && *index:
+		fail(fmt.Errorf("-parallel and -index can't be used together"))
+	case *index:
+		// broken lines are reported by the search, updating the index finds the same ones
+		if _, _, err = UpdateIndex(*in, mode); err == nil {
+			skipped, err = s.RunIndexed(os.Stdout, *in, mode)
+		}
+	case *parallel:
+		opts := ParallelOptions{Path: *in, Workers: *workers, Mmap: *useMmap, Mode: mode, Fallback: func(err error) {
+			fmt.Fprintf(os.Stderr, "reading the file as it can't be mapped: %s\n", err)
+		}}
+		skipped, err = s.RunParallel(os.Stdout, opts)
+	default:
+		skipped, err = s.RunSource(os.Stdout, *in, mode)
+	}
+	if err != nil {
+		fail(err)
+	}
+	for _, lineErr := range skipped {
+		reportSkipped(lineErr)
+	}
+}
@@ -0,0 +1,19 @@
+//go:build !darwin && !dragonfly && !freebsd && !linux && !netbsd && !openbsd
+// +build !darwin,!dragonfly,!freebsd,!linux,!netbsd,!openbsd
+
+package main
+
+import (
+	"errors"
+	"os"
+)
+
+// mmap is not supported on this platform, the file is read instead.
+func mmap(f *os.File, size int64) ([]byte, error) {
+	return nil, errors.New("mmap is not supported")
+}
+
+// munmap is never called on this platform.
+func munmap(data []byte) error {
+	return nil
+}
@@ -0,0 +1,299 @@
+package main
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/csv"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+	"text/template"
+)
+
+// Redaction is the policy of writing a personal field of the found users.
+type Redaction int
+
+const (
+	// Keep writes the field as is.
+	Keep Redaction = iota
+	// Obfuscate writes emails as "user [at] domain" like `FastSearch`, other fields are kept.
+	Obfuscate
+	// Mask hides all but a few characters: "j***@m***.edu" for emails and "***-**-49" for phones.
+	Mask
+	// Hash replaces the field with the hex of its salted SHA-256 truncated to 16 characters,
+	// so equal values can still be matched.
+	Hash
+	// Drop leaves the field empty and omits it from CSV and JSON.
+	Drop
+)
+
+var redactionNames = []string{"keep", "obfuscate", "mask", "hash", "drop"}
+
+func (r Redaction) String() string {
+	return redactionNames[r]
+}
+
+// ParseRedaction returns the redaction policy with the given name.
+func ParseRedaction(name string) (Redaction, error) {
+	for r, rn := range redactionNames {
+		if strings.EqualFold(name, rn) {
+			return Redaction(r), nil
+		}
+	}
+	return 0, fmt.Errorf("unknown redaction %q, expected one of %s", name, strings.Join(redactionNames, ", "))
+}
+
+// UserRecord is the found user passed to the output template, personal fields are already redacted.
+type UserRecord struct {
+	// Line is the number of the line of the user counted from 0.
+	Line     uint64
+	Browsers []string
+	Company  string
+	Country  string
+	Email    string
+	Job      string
+	Name     string
+	Phone    string
+}
+
+// DefaultTemplate formats the found user like `FastSearch`.
+var DefaultTemplate = template.Must(template.New("user").Parse("[{{.Line}}] {{.Name}} <{{.Email}}>\n"))
+
+// Output configures how `Search` writes the found users, nil means the output of `FastSearch`
+// which is the same as `FormatText` with `DefaultTemplate` and obfuscated emails.
+type Output struct {
+	// Format is `FormatText` for the users formatted with the template between the "found users:" header
+	// and the number of unique browsers, `FormatCSV` for the users followed by the unique_browsers,N row padded
+	// to the width of the header and `FormatJSON` for JSON lines of the users followed by {"unique_browsers":N}.
+	Format Format
+	// Template formats each user in `FormatText`, `DefaultTemplate` by default.
+	Template *template.Template
+	// Fields are the columns of CSV and JSON, name and email by default.
+	Fields []Field
+	Email  Redaction
+	Phone  Redaction
+	// Salt is mixed into the values before `Hash`, without it phone numbers are easy to recover by brute force.
+	Salt string
+}
+
+// record returns the user with the redacted fields.
+func (o *Output) record(i uint64, user *User) UserRecord {
+	rec := UserRecord{
+		Line:     i,
+		Browsers: make([]string, len(user.Browsers)),
+		Company:  string(user.Company),
+		Country:  string(user.Country),
+		Email:    o.redact(o.Email, user.Email, maskEmail),
+		Job:      string(user.Job),
+		Name:     string(user.Name),
+		Phone:    o.redact(o.Phone, user.Phone, maskPhone),
+	}
+	for k, browser := range user.Browsers {
+		rec.Browsers[k] = string(browser)
+	}
+	return rec
+}
+
+// redact applies the policy to the value, `mask` hides the value for `Mask`. Empty values stay empty.
+func (o *Output) redact(policy Redaction, val []byte, mask func([]byte) string) string {
+	switch {
+	case len(val) == 0:
+		return ""
+	case policy == Obfuscate:
+		if j := bytes.IndexByte(val, '@'); j >= 0 {
+			return string(val[:j]) + " [at] " + string(val[j+1:])
+		}
+	case policy == Mask:
+		return mask(val)
+	case policy == Hash:
+		sum := sha256.Sum256(append([]byte(o.Salt), val...))
+		return hex.EncodeToString(sum[:8])
+	case policy == Drop:
+		return ""
+	}
+	return string(val)
+}
+
+// maskEmail keeps the first characters of the user and the domain name and the top-level domain.
+func maskEmail(email []byte) string {
+	s := string(email)
+	j := strings.IndexByte(s, '@')
+	if j < 0 {
+		return maskRest(s, 1)
+	}
+	domain, tld := s[j+1:], ""
+	if dot := strings.LastIndexByte(domain, '.'); dot >= 0 {
+		domain, tld = domain[:dot], domain[dot:]
+	}
+	return maskRest(s[:j], 1) + "@" + maskRest(domain, 1) + tld
+}
+
+// maskRest replaces the string after the first n characters with asterisks.
+func maskRest(s string, n int) string {
+	if len(s) <= n {
+		return strings.Repeat("*", len(s))
+	}
+	return s[:n] + "***"
+}
+
+// maskPhone replaces all digits but the last two with asterisks.
+func maskPhone(phone []byte) string {
+	res := []byte(string(phone))
+	keep := 2
+	for k := len(res) - 1; k >= 0; k-- {
+		if res[k] < '0' || res[k] > '9' {
+			continue
+		}
+		if keep > 0 {
+			keep--
+			continue
+		}
+		res[k] = '*'
+	}
+	return string(res)
+}
+
+// fields returns the columns of CSV and JSON without the dropped ones.
+func (o *Output) fields() []Field {
+	fields := o.Fields
+	if len(fields) == 0 {
+		fields = []Field{FieldName, FieldEmail}
+	}
+	res := make([]Field, 0, len(fields))
+	for _, f := range fields {
+		if (f == FieldEmail && o.Email == Drop) || (f == FieldPhone && o.Phone == Drop) {
+			continue
+		}
+		res = append(res, f)
+	}
+	return res
+}
+
+// value returns the field of the record, browsers are separated with newlines.
+func (rec *UserRecord) value(f Field) string {
+	switch f {
+	case FieldBrowsers:
+		return strings.Join(rec.Browsers, "\n")
+	case FieldCompany:
+		return rec.Company
+	case FieldCountry:
+		return rec.Country
+	case FieldEmail:
+		return rec.Email
+	case FieldJob:
+		return rec.Job
+	case FieldName:
+		return rec.Name
+	default:
+		return rec.Phone
+	}
+}
+
+// header writes what goes before the users.
+func (o *Output) header(buf *bytes.Buffer) error {
+	switch o.Format {
+	case FormatCSV:
+		record := []string{"line"}
+		for _, f := range o.fields() {
+			record = append(record, f.String())
+		}
+		return writeCSV(buf, record)
+	case FormatJSON:
+		return nil
+	default:
+		buf.WriteString("found users:\n")
+		return nil
+	}
+}
+
+// user writes the found user.
+func (o *Output) user(buf *bytes.Buffer, rec *UserRecord) error {
+	switch o.Format {
+	case FormatCSV:
+		record := []string{strconv.FormatUint(rec.Line, 10)}
+		for _, f := range o.fields() {
+			record = append(record, rec.value(f))
+		}
+		return writeCSV(buf, record)
+	case FormatJSON:
+		buf.WriteString(`{"line":`)
+		buf.WriteString(strconv.FormatUint(rec.Line, 10))
+		for _, f := range o.fields() {
+			buf.WriteString(`,"` + f.String() + `":`)
+			var val interface{} = rec.value(f)
+			if f == FieldBrowsers {
+				val = rec.Browsers
+			}
+			data, err := json.Marshal(val)
+			if err != nil {
+				return err
+			}
+			buf.Write(data)
+		}
+		buf.WriteString("}\n")
+		return nil
+	default:
+		tmpl := o.Template
+		if tmpl == nil {
+			tmpl = DefaultTemplate
+		}
+		return tmpl.Execute(buf, rec)
+	}
+}
+
+// total writes the number of unique browsers, `last` tells that it goes after all users of the report.
+func (o *Output) total(buf *bytes.Buffer, unique uint64, last bool) error {
+	switch o.Format {
+	case FormatCSV:
+		// the row is padded to the header width so that the file reads as CSV with a constant number of columns
+		record := make([]string, 1+len(o.fields()))
+		if len(record) < 2 {
+			record = make([]string, 2)
+		}
+		record[0], record[1] = "unique_browsers", strconv.FormatUint(unique, 10)
+		return writeCSV(buf, record)
+	case FormatJSON:
+		fmt.Fprintf(buf, "{\"unique_browsers\":%d}\n", unique)
+	default:
+		if last {
+			buf.WriteByte('\n')
+		}
+		fmt.Fprintf(buf, "Total unique browsers %d\n", unique)
+	}
+	return nil
+}
+
+// report formats the users found in consecutive parts of the log, numbering lines across all of them.
+func (o *Output) report(parts []*result, unique uint64) ([]byte, error) {
+	buf := new(bytes.Buffer)
+	if err := o.header(buf); err != nil {
+		return nil, err
+	}
+	base := uint64(0)
+	for _, res := range parts {
+		for k := range res.records {
+			rec := &res.records[k]
+			rec.Line += base
+			if err := o.user(buf, rec); err != nil {
+				return nil, err
+			}
+		}
+		base += res.lines
+	}
+	if err := o.total(buf, unique, true); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// writeCSV writes one CSV record.
+func writeCSV(buf *bytes.Buffer, record []string) error {
+	w := csv.NewWriter(buf)
+	if err := w.Write(record); err != nil {
+		return err
+	}
+	w.Flush()
+	return w.Error()
+}
@@ -0,0 +1,140 @@
+package main
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"text/template"
+)
+
+func TestSearchDefaultTemplate(t *testing.T) {
+	expected := new(bytes.Buffer)
+	FastSearch(expected)
+	s := *DefaultSearch
+	s.Output = &Output{Email: Obfuscate}
+	for _, workers := range []int{0, 3} {
+		out := new(bytes.Buffer)
+		var err error
+		if workers == 0 {
+			_, err = s.Run(out, Strict)
+		} else {
+			_, err = s.RunParallel(out, ParallelOptions{Workers: workers})
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		if out.String() != expected.String() {
+			t.Errorf("workers=%d\nGot:\n%s\nExpected:\n%s", workers, out.String(), expected.String())
+		}
+	}
+}
+
+// outputLog has two matching users, the second one lacks the phone and has no @ in the email.
+var outputLog = `{"browsers":["Android","MSIE"],"email":"JonathanMorris@Muxo.edu","name":"Sharon Crawford","phone":"176-88-49","country":"Kenya"}
+{"browsers":["Chrome"],"email":"a@b.c","name":"Nobody"}
+{"browsers":["Android 4","MSIE 8","Opera"],"email":"no-email","name":"Susan \"Sue\" Ellis","country":"Peru"}
+`
+
+func TestOutputFormats(t *testing.T) {
+	cases := []struct {
+		Output   Output
+		Expected string
+	}{
+		{
+			Output{},
+			"found users:\n[0] Sharon Crawford <JonathanMorris@Muxo.edu>\n[2] Susan \"Sue\" Ellis <no-email>\n\nTotal unique browsers 4\n",
+		},
+		{
+			Output{Template: template.Must(template.New("").Parse("{{.Line}}: {{.Name}} {{.Phone}} {{.Country}} {{len .Browsers}}\n")), Phone: Mask},
+			"found users:\n0: Sharon Crawford ***-**-49 Kenya 2\n2: Susan \"Sue\" Ellis  Peru 3\n\nTotal unique browsers 4\n",
+		},
+		{
+			Output{Format: FormatCSV, Email: Mask, Fields: []Field{FieldName, FieldEmail, FieldPhone, FieldBrowsers}},
+			"line,name,email,phone,browsers\n0,Sharon Crawford,J***@M***.edu,176-88-49,\"Android\nMSIE\"\n2,\"Susan \"\"Sue\"\" Ellis\",n***,,\"Android 4\nMSIE 8\nOpera\"\nunique_browsers,4,,,\n",
+		},
+		{
+			Output{Format: FormatCSV, Email: Drop, Phone: Hash, Salt: "pepper", Fields: []Field{FieldEmail, FieldPhone}},
+			"line,phone\n0,66a784d16249d21d\n2,\nunique_browsers,4\n",
+		},
+		{
+			Output{Format: FormatCSV, Email: Drop, Fields: []Field{FieldEmail}},
+			"line\n0\n2\nunique_browsers,4\n",
+		},
+		{
+			Output{Format: FormatJSON, Email: Hash, Phone: Drop, Fields: []Field{FieldName, FieldEmail, FieldPhone, FieldBrowsers}},
+			`{"line":0,"name":"Sharon Crawford","email":"cfeaea129615d931","browsers":["Android","MSIE"]}` + "\n" +
+				`{"line":2,"name":"Susan \"Sue\" Ellis","email":"ab0f9ec59693d70c","browsers":["Android 4","MSIE 8","Opera"]}` + "\n" +
+				`{"unique_browsers":4}` + "\n",
+		},
+	}
+	for k, tc := range cases {
+		s := *DefaultSearch
+		output := tc.Output
+		s.Output = &output
+		out := new(bytes.Buffer)
+		if _, err := s.RunReader(out, strings.NewReader(outputLog), Strict); err != nil {
+			t.Fatal(err)
+		}
+		if out.String() != tc.Expected {
+			t.Errorf("case %d\nGot:\n%s\nExpected:\n%s", k, out.String(), tc.Expected)
+		}
+	}
+}
+
+func TestRedact(t *testing.T) {
+	cases := []struct {
+		Policy   Redaction
+		Value    string
+		Mask     func([]byte) string
+		Expected string
+	}{
+		{Keep, "user@example.com", maskEmail, "user@example.com"},
+		{Obfuscate, "user@example.com", maskEmail, "user [at] example.com"},
+		{Obfuscate, "176-88-49", maskPhone, "176-88-49"},
+		{Mask, "user@example.com", maskEmail, "u***@e***.com"},
+		{Mask, "u@localhost", maskEmail, "*@l***"},
+		{Mask, "+7 (495) 123-45-67", maskPhone, "+* (***) ***-**-67"},
+		{Mask, "5", maskPhone, "5"},
+		{Drop, "user@example.com", maskEmail, ""},
+	}
+	o := &Output{}
+	for _, tc := range cases {
+		if got := o.redact(tc.Policy, []byte(tc.Value), tc.Mask); got != tc.Expected {
+			t.Errorf("%s %q\nGot: %s\nExpected: %s", tc.Policy, tc.Value, got, tc.Expected)
+		}
+	}
+
+	a := (&Output{Salt: "a"}).redact(Hash, []byte("176-88-49"), maskPhone)
+	b := (&Output{Salt: "b"}).redact(Hash, []byte("176-88-49"), maskPhone)
+	if len(a) != 16 || a == b || a != (&Output{Salt: "a"}).redact(Hash, []byte("176-88-49"), maskPhone) {
+		t.Errorf("hashes with different salts: %s, %s", a, b)
+	}
+	// the command line does not hash without a salt
+	expected := "-salt is required with hash redaction"
+	if _, err := output("csv", "", "name,phone", "keep", "hash", ""); err == nil || err.Error() != expected {
+		t.Errorf("Got: %v\nExpected: %s", err, expected)
+	}
+	if _, err := runStatement("SELECT email", filePath, "csv", "hash", "keep", "", Strict); err == nil || err.Error() != expected {
+		t.Errorf("Got: %v\nExpected: %s", err, expected)
+	}
+	if _, err := output("csv", "", "name,phone", "keep", "hash", "pepper"); err != nil {
+		t.Errorf("unexpected error: %s", err)
+	}
+	for _, name := range redactionNames {
+		if r, err := ParseRedaction(strings.ToUpper(name)); err != nil || r.String() != name {
+			t.Errorf("Got: %v, %v\nExpected: %s", r, err, name)
+		}
+	}
+}
+
+func TestFollowOutput(t *testing.T) {
+	log, cleanup := tempLog(t, []byte(bothUser))
+	defer cleanup()
+	s := *DefaultSearch
+	s.Output = &Output{Format: FormatJSON, Email: Mask}
+	out, stop := follow(t, &s, FollowOptions{Path: log})
+	waitOutput(t, out, `{"line":0,"name":"Both","email":"*@*.c"}`+"\n"+`{"unique_browsers":2}`+"\n")
+	if err := stop(); err != nil {
+		t.Fatal(err)
+	}
+}
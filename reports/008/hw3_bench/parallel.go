@@ -0,0 +1,178 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"runtime"
+	"sync"
+)
+
+// ParallelOptions configure `RunParallel`, zero value scans `filePath` on all cores in `Strict` mode.
+type ParallelOptions struct {
+	// Path is the log file, `filePath` by default.
+	Path string
+	// Workers is the number of parts parsed concurrently, `runtime.NumCPU()` by default.
+	Workers int
+	// Mmap maps the file into memory instead of reading it.
+	Mmap bool
+	// Fallback is called with the error if the file can't be mapped (e.g. mmap is not supported) and is read instead.
+	Fallback func(err error)
+	// Mode selects what to do with malformed lines.
+	Mode Mode
+}
+
+// FastSearchParallel is `FastSearch` parsing the log on all cores.
+func FastSearchParallel(out io.Writer) {
+	if _, err := DefaultSearch.RunParallel(out, ParallelOptions{}); err != nil {
+		panic(err)
+	}
+}
+
+// RunParallel is `Run` which splits the file into byte ranges aligned to lines and parses them concurrently.
+// The output is the same as of `Run`, line numbers and offsets are counted from the start of the file.
+// Compressed files can't be split, they are rejected.
+func (s *Search) RunParallel(out io.Writer, opts ParallelOptions) (skipped []*LineError, err error) {
+	if opts.Path == "" {
+		opts.Path = filePath
+	}
+	if opts.Workers <= 0 {
+		opts.Workers = runtime.NumCPU()
+	}
+	f, err := os.Open(opts.Path)
+	if err != nil {
+		return nil, err
+	}
+	defer closeErr(f, &err)
+	info, err := f.Stat()
+	if err != nil {
+		return nil, err
+	}
+
+	magic := make([]byte, len(zstdMagic))
+	n, err := f.ReadAt(magic, 0)
+	if err != nil && err != io.EOF {
+		return nil, err
+	}
+	if bytes.HasPrefix(magic[:n], gzipMagic) || bytes.HasPrefix(magic[:n], zstdMagic) {
+		return nil, fmt.Errorf("%s: compressed file can't be scanned in parallel", opts.Path)
+	}
+
+	var data []byte
+	if opts.Mmap && info.Size() > 0 {
+		var merr error
+		if data, merr = mmap(f, info.Size()); merr != nil {
+			data = nil
+			if opts.Fallback != nil {
+				opts.Fallback(merr)
+			}
+		} else {
+			defer func() {
+				if merr := munmap(data); merr != nil && err == nil {
+					err = merr
+				}
+			}()
+		}
+	}
+	var src io.ReaderAt = f
+	if data != nil {
+		src = bytes.NewReader(data)
+	}
+	bounds, err := split(src, info.Size(), opts.Workers)
+	if err != nil {
+		return nil, err
+	}
+
+	parts := make([]*result, len(bounds)-1)
+	errs := make([]error, len(parts))
+	wg := &sync.WaitGroup{}
+	for k := range parts {
+		if parts[k], err = s.newResult(opts.Mode); err != nil {
+			return nil, err
+		}
+		parts[k].chunk, parts[k].offset = true, bounds[k]
+		wg.Add(1)
+		go func(k int, start, end int64) {
+			defer wg.Done()
+			if data != nil {
+				errs[k] = s.scanBytes(data[start:end], parts[k])
+			} else {
+				errs[k] = s.scanReader(io.NewSectionReader(f, start, end-start), parts[k])
+			}
+		}(k, bounds[k], bounds[k+1])
+	}
+	wg.Wait()
+
+	base := uint64(0)
+	for k, res := range parts {
+		if lineErr, ok := errs[k].(*LineError); ok {
+			lineErr.Line += base
+		}
+		if errs[k] != nil {
+			return nil, errs[k]
+		}
+		for _, lineErr := range res.skipped {
+			lineErr.Line += base
+			skipped = append(skipped, lineErr)
+		}
+		base += res.lines
+	}
+	return skipped, s.report(out, parts...)
+}
+
+// scanBytes runs the search over all lines of the data.
+func (s *Search) scanBytes(data []byte, res *result) error {
+	for len(data) > 0 {
+		end := bytes.IndexByte(data, '\n')
+		if end < 0 {
+			end = len(data)
+		}
+		line := data[:end]
+		if len(line) > 0 && line[len(line)-1] == '\r' {
+			line = line[:len(line)-1]
+		}
+		if end < len(data) {
+			end++
+		}
+		if err := s.line(line, end, res); err != nil {
+			return err
+		}
+		data = data[end:]
+	}
+	return nil
+}
+
+// split returns the boundaries of at most n byte ranges of similar size, each starting at the beginning of a line.
+func split(r io.ReaderAt, size int64, n int) ([]int64, error) {
+	bounds := []int64{0}
+	for k := 1; k < n; k++ {
+		start, err := align(r, size*int64(k)/int64(n), size)
+		if err != nil {
+			return nil, err
+		}
+		if start > bounds[len(bounds)-1] && start < size {
+			bounds = append(bounds, start)
+		}
+	}
+	return append(bounds, size), nil
+}
+
+// align returns the offset of the first line starting at or after the given offset.
+func align(r io.ReaderAt, off, size int64) (int64, error) {
+	if off == 0 {
+		return 0, nil
+	}
+	buf := make([]byte, 4096)
+	// start from the previous byte so that a line beginning exactly at the boundary is not skipped
+	for pos := off - 1; pos < size; pos += int64(len(buf)) {
+		n, err := r.ReadAt(buf, pos)
+		if i := bytes.IndexByte(buf[:n], '\n'); i >= 0 {
+			return pos + int64(i) + 1, nil
+		}
+		if err != nil && err != io.EOF {
+			return 0, err
+		}
+	}
+	return size, nil
+}
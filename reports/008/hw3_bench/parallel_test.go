@@ -0,0 +1,152 @@
+package main
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+func TestSearchParallel(t *testing.T) {
+	expected := new(bytes.Buffer)
+	FastSearch(expected)
+	for _, workers := range []int{1, 2, 3, 8, 1000} {
+		for _, useMmap := range []bool{false, true} {
+			t.Run(fmt.Sprintf("workers=%d,mmap=%v", workers, useMmap), func(t *testing.T) {
+				out := new(bytes.Buffer)
+				if _, err := DefaultSearch.RunParallel(out, ParallelOptions{Workers: workers, Mmap: useMmap}); err != nil {
+					t.Fatal(err)
+				}
+				if out.String() != expected.String() {
+					t.Errorf("results not match\nGot:\n%v\nExpected:\n%v", out.String(), expected.String())
+				}
+			})
+		}
+	}
+}
+
+func TestSearchParallelCompressed(t *testing.T) {
+	dir, err := ioutil.TempDir("", "hw3_parallel")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "users.txt.gz")
+	if err = ioutil.WriteFile(path, append(gzipMagic, 0), 0644); err != nil {
+		t.Fatal(err)
+	}
+	_, err = DefaultSearch.RunParallel(ioutil.Discard, ParallelOptions{Path: path})
+	if expected := path + ": compressed file can't be scanned in parallel"; err == nil || err.Error() != expected {
+		t.Errorf("Got: %v\nExpected: %s", err, expected)
+	}
+}
+
+func TestSplit(t *testing.T) {
+	cases := []struct {
+		Data     string
+		Parts    int
+		Expected string
+	}{
+		{"", 4, "[0 0]"},
+		{"aaa\nbbb\nccc\nddd\n", 4, "[0 4 8 12 16]"},
+		{"aaa\nbbb\nccc\nddd", 2, "[0 8 15]"},
+		{"aaaaaaaaaaaa\nb\nc\n", 3, "[0 13 17]"},
+		{"aaaaaaaaaaaa", 3, "[0 12]"},
+		{"a\nb\n", 8, "[0 2 4]"},
+	}
+	for _, tc := range cases {
+		bounds, err := split(strings.NewReader(tc.Data), int64(len(tc.Data)), tc.Parts)
+		if err != nil {
+			t.Fatal(err)
+		}
+		got := fmt.Sprint(bounds)
+		if got != tc.Expected {
+			t.Errorf("%q in %d parts\nGot: %s\nExpected: %s", tc.Data, tc.Parts, got, tc.Expected)
+		}
+	}
+}
+
+// logMB is the size of the log written by `benchLog`, $HW3_BENCH_MB by default.
+var logMB = flag.Int("log-mb", envInt("HW3_BENCH_MB", 64), "size of the log in megabytes for BenchmarkParallel, BenchmarkIndexed and BenchmarkGenerated")
+
+// envInt returns the integer environment variable or `def` if it's not set or malformed.
+func envInt(name string, def int) int {
+	if n, err := strconv.Atoi(os.Getenv(name)); err == nil {
+		return n
+	}
+	return def
+}
+
+// benchLog writes the log of `logMB` megabytes with `write` into the temporary directory,
+// the returned function removes it.
+func benchLog(b *testing.B, write func(w io.Writer, size int64) error) (string, func()) {
+	dir, err := ioutil.TempDir("", "hw3_bench")
+	if err != nil {
+		b.Fatal(err)
+	}
+	cleanup := func() {
+		os.RemoveAll(dir)
+	}
+	path := filepath.Join(dir, "users.txt")
+	f, err := os.Create(path)
+	if err != nil {
+		cleanup()
+		b.Fatal(err)
+	}
+	err = write(f, int64(*logMB)<<20)
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		cleanup()
+		b.Fatal(err)
+	}
+	return path, cleanup
+}
+
+// bigLog writes the log made of `users.txt` repeated up to `logMB` megabytes, see `benchLog`.
+func bigLog(b *testing.B) (string, func()) {
+	data, err := ioutil.ReadFile(filePath)
+	if err != nil {
+		b.Fatal(err)
+	}
+	if !bytes.HasSuffix(data, []byte("\n")) {
+		data = append(data, '\n')
+	}
+	return benchLog(b, func(w io.Writer, size int64) (err error) {
+		for written := int64(0); written < size && err == nil; written += int64(len(data)) {
+			_, err = w.Write(data)
+		}
+		return err
+	})
+}
+
+// go test -bench Parallel -benchmem -run ^$ -log-mb 4096 (or HW3_BENCH_MB=4096) for multi-GB file
+
+func BenchmarkParallel(b *testing.B) {
+	path, cleanup := bigLog(b)
+	defer cleanup()
+	info, err := os.Stat(path)
+	if err != nil {
+		b.Fatal(err)
+	}
+	for _, workers := range []int{1, 2, 4, 8} {
+		for _, useMmap := range []bool{false, true} {
+			opts := ParallelOptions{Path: path, Workers: workers, Mmap: useMmap}
+			b.Run(fmt.Sprintf("workers=%d,mmap=%v", workers, useMmap), func(b *testing.B) {
+				b.SetBytes(info.Size())
+				for i := 0; i < b.N; i++ {
+					if _, err := DefaultSearch.RunParallel(ioutil.Discard, opts); err != nil {
+						b.Fatal(err)
+					}
+				}
+			})
+		}
+	}
+}
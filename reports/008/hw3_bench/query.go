@@ -0,0 +1,453 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// Field identifies a field of the `User` record which can be used in a query.
+type Field int
+
+// Fields of the `User` record.
+const (
+	FieldBrowsers Field = iota
+	FieldCompany
+	FieldCountry
+	FieldEmail
+	FieldJob
+	FieldName
+	FieldPhone
+)
+
+// fieldNames maps field names used in queries and JSON to fields.
+var fieldNames = map[string]Field{
+	"browsers": FieldBrowsers,
+	"company":  FieldCompany,
+	"country":  FieldCountry,
+	"email":    FieldEmail,
+	"job":      FieldJob,
+	"name":     FieldName,
+	"phone":    FieldPhone,
+}
+
+// String returns the name of the field.
+func (f Field) String() string {
+	for name, field := range fieldNames {
+		if field == f {
+			return name
+		}
+	}
+	return "field(" + strconv.Itoa(int(f)) + ")"
+}
+
+// ParseField returns the field with the given name.
+func ParseField(name string) (Field, error) {
+	f, ok := fieldNames[strings.ToLower(name)]
+	if !ok {
+		return 0, fmt.Errorf("unknown field %q", name)
+	}
+	return f, nil
+}
+
+// Query is a compiled condition over a `User` record.
+//
+// The syntax is
+//
+//	expr := term { OR term }
+//	term := factor { AND factor }
+//	factor := NOT factor | ( expr ) | field op string
+//	op := contains | matches | =
+//
+// Keywords are case-insensitive, strings are enclosed in double quotes with Go escapes or in single quotes as is.
+// A predicate over `browsers` holds if it holds for any of the browsers.
+type Query struct {
+	src  string
+	root node
+}
+
+// node is an element of the compiled query.
+// If `browser` is not nil, predicates over `browsers` are checked only against it.
+type node interface {
+	match(u *User, browser []byte) bool
+	// literals returns the set of byte strings one of which is present in the raw JSON line of every matching record,
+	// nil means that no such set is known.
+	literals() [][]byte
+}
+
+// ParseQuery compiles the query.
+func ParseQuery(src string) (*Query, error) {
+	p := &parser{src: src}
+	p.next()
+	root := p.expr()
+	if p.err == nil && p.tok.kind != tokEOF {
+		p.fail("unexpected %s", p.tok)
+	}
+	if p.err != nil {
+		return nil, fmt.Errorf("query %q: %s", src, p.err)
+	}
+	return &Query{src: src, root: root}, nil
+}
+
+// MustParseQuery is like `ParseQuery` but panics on error.
+func MustParseQuery(src string) *Query {
+	q, err := ParseQuery(src)
+	if err != nil {
+		panic(err)
+	}
+	return q
+}
+
+// String returns the source of the query.
+func (q *Query) String() string {
+	return q.src
+}
+
+// Match reports whether the record satisfies the query.
+func (q *Query) Match(u *User) bool {
+	return q.root.match(u, nil)
+}
+
+// MatchBrowser reports whether the record with `browsers` replaced by the given browser satisfies the query.
+func (q *Query) MatchBrowser(u *User, browser []byte) bool {
+	return q.root.match(u, browser)
+}
+
+type (
+	and struct{ left, right node }
+	or  struct{ left, right node }
+	not struct{ expr node }
+
+	contains struct {
+		field Field
+		value []byte
+	}
+	equals struct {
+		field Field
+		value []byte
+	}
+	matches struct {
+		field Field
+		re    *regexp.Regexp
+	}
+)
+
+func (n *and) match(u *User, browser []byte) bool {
+	return n.left.match(u, browser) && n.right.match(u, browser)
+}
+
+func (n *or) match(u *User, browser []byte) bool {
+	return n.left.match(u, browser) || n.right.match(u, browser)
+}
+
+func (n *not) match(u *User, browser []byte) bool {
+	return !n.expr.match(u, browser)
+}
+
+func (n *contains) match(u *User, browser []byte) bool {
+	return u.any(n.field, browser, n.test)
+}
+
+func (n *equals) match(u *User, browser []byte) bool {
+	return u.any(n.field, browser, n.test)
+}
+
+func (n *matches) match(u *User, browser []byte) bool {
+	return u.any(n.field, browser, n.test)
+}
+
+// predicate is a query leaf checking values of a single field.
+type predicate interface {
+	node
+	// on returns the checked field.
+	on() Field
+	// test checks a single value of the field.
+	test(val []byte) bool
+}
+
+func (n *contains) on() Field { return n.field }
+func (n *equals) on() Field   { return n.field }
+func (n *matches) on() Field  { return n.field }
+
+func (n *contains) test(val []byte) bool {
+	return bytes.Contains(val, n.value)
+}
+
+func (n *equals) test(val []byte) bool {
+	return bytes.Equal(val, n.value)
+}
+
+func (n *matches) test(val []byte) bool {
+	return n.re.Match(val)
+}
+
+func (n *and) literals() [][]byte {
+	left, right := n.left.literals(), n.right.literals()
+	if left == nil || (right != nil && len(right) < len(left)) {
+		return right
+	}
+	return left
+}
+
+func (n *or) literals() [][]byte {
+	left, right := n.left.literals(), n.right.literals()
+	if left == nil || right == nil {
+		return nil
+	}
+	return append(left[:len(left):len(left)], right...)
+}
+
+func (n *not) literals() [][]byte {
+	return nil
+}
+
+func (n *contains) literals() [][]byte {
+	return literal(n.value)
+}
+
+func (n *equals) literals() [][]byte {
+	return literal(n.value)
+}
+
+func (n *matches) literals() [][]byte {
+	return nil
+}
+
+// literal returns the value as a prefilter literal if it appears in JSON unchanged.
+func literal(value []byte) [][]byte {
+	if len(value) == 0 {
+		return nil
+	}
+	for _, c := range value {
+		if c < ' ' || c > '~' || c == '"' || c == '\\' || c == '/' || c == '<' || c == '>' || c == '&' {
+			return nil
+		}
+	}
+	return [][]byte{value}
+}
+
+// any reports whether the check holds for any value of the field.
+func (u *User) any(f Field, browser []byte, check func([]byte) bool) bool {
+	switch f {
+	case FieldBrowsers:
+		if browser != nil {
+			return check(browser)
+		}
+		for _, b := range u.Browsers {
+			if check(b) {
+				return true
+			}
+		}
+		return false
+	case FieldCompany:
+		return check(u.Company)
+	case FieldCountry:
+		return check(u.Country)
+	case FieldEmail:
+		return check(u.Email)
+	case FieldJob:
+		return check(u.Job)
+	case FieldName:
+		return check(u.Name)
+	case FieldPhone:
+		return check(u.Phone)
+	}
+	return false
+}
+
+// tokKind is a kind of query token.
+type tokKind int
+
+const (
+	tokEOF tokKind = iota
+	tokWord
+	tokString
+	tokOp
+	tokLParen
+	tokRParen
+	tokComma
+	tokStar
+)
+
+type token struct {
+	kind tokKind
+	text string
+	pos  int
+}
+
+func (t token) String() string {
+	if t.kind == tokEOF {
+		return "end of query"
+	}
+	return fmt.Sprintf("%q at %d", t.text, t.pos)
+}
+
+// is reports whether the token is the given keyword.
+func (t token) is(keyword string) bool {
+	return t.kind == tokWord && strings.EqualFold(t.text, keyword)
+}
+
+// parser is a recursive descent parser of queries, it keeps the first error.
+type parser struct {
+	src string
+	pos int
+	tok token
+	err error
+}
+
+func (p *parser) fail(format string, args ...interface{}) {
+	if p.err == nil {
+		p.err = fmt.Errorf(format, args...)
+	}
+}
+
+// next reads the next token.
+func (p *parser) next() {
+	for p.pos < len(p.src) && strings.IndexByte(" \t\r\n", p.src[p.pos]) >= 0 {
+		p.pos++
+	}
+	start := p.pos
+	if p.pos == len(p.src) {
+		p.tok = token{kind: tokEOF, pos: start}
+		return
+	}
+	switch c := p.src[p.pos]; {
+	case c == '(':
+		p.pos++
+		p.tok = token{kind: tokLParen, text: "(", pos: start}
+	case c == ')':
+		p.pos++
+		p.tok = token{kind: tokRParen, text: ")", pos: start}
+	case c == '=':
+		p.pos++
+		p.tok = token{kind: tokOp, text: "=", pos: start}
+	case c == ',':
+		p.pos++
+		p.tok = token{kind: tokComma, text: ",", pos: start}
+	case c == '*':
+		p.pos++
+		p.tok = token{kind: tokStar, text: "*", pos: start}
+	case c == '\'':
+		end := strings.IndexByte(p.src[start+1:], '\'')
+		if end < 0 {
+			p.fail("unterminated string at %d", start)
+			p.pos = len(p.src)
+			p.tok = token{kind: tokEOF, pos: start}
+			return
+		}
+		p.pos = start + end + 2
+		p.tok = token{kind: tokString, text: p.src[start+1 : p.pos-1], pos: start}
+	case c == '"':
+		p.pos++
+		for p.pos < len(p.src) && p.src[p.pos] != '"' {
+			if p.src[p.pos] == '\\' {
+				p.pos++
+			}
+			p.pos++
+		}
+		if p.pos >= len(p.src) {
+			p.fail("unterminated string at %d", start)
+			p.tok = token{kind: tokEOF, pos: start}
+			return
+		}
+		p.pos++
+		text, err := strconv.Unquote(p.src[start:p.pos])
+		if err != nil {
+			p.fail("invalid string at %d: %s", start, err)
+		}
+		p.tok = token{kind: tokString, text: text, pos: start}
+	case isWordByte(c):
+		for p.pos < len(p.src) && isWordByte(p.src[p.pos]) {
+			p.pos++
+		}
+		p.tok = token{kind: tokWord, text: p.src[start:p.pos], pos: start}
+	default:
+		p.fail("unexpected %q at %d", c, start)
+		p.pos = len(p.src)
+		p.tok = token{kind: tokEOF, pos: start}
+	}
+}
+
+func isWordByte(c byte) bool {
+	return c == '_' || (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z') || (c >= '0' && c <= '9')
+}
+
+func (p *parser) expr() node {
+	left := p.term()
+	for p.err == nil && p.tok.is("OR") {
+		p.next()
+		left = &or{left: left, right: p.term()}
+	}
+	return left
+}
+
+func (p *parser) term() node {
+	left := p.factor()
+	for p.err == nil && p.tok.is("AND") {
+		p.next()
+		left = &and{left: left, right: p.factor()}
+	}
+	return left
+}
+
+func (p *parser) factor() node {
+	switch {
+	case p.err != nil:
+		return nil
+	case p.tok.is("NOT"):
+		p.next()
+		return &not{expr: p.factor()}
+	case p.tok.kind == tokLParen:
+		p.next()
+		n := p.expr()
+		if p.err == nil && p.tok.kind != tokRParen {
+			p.fail("expected ) instead of %s", p.tok)
+		}
+		p.next()
+		return n
+	case p.tok.kind == tokWord:
+		return p.predicate()
+	default:
+		p.fail("expected condition instead of %s", p.tok)
+		return nil
+	}
+}
+
+func (p *parser) predicate() node {
+	field, err := ParseField(p.tok.text)
+	if err != nil {
+		p.fail("%s at %d", err, p.tok.pos)
+		return nil
+	}
+	p.next()
+	op := p.tok
+	if op.kind != tokOp && op.kind != tokWord {
+		p.fail("expected operator instead of %s", op)
+		return nil
+	}
+	p.next()
+	if p.tok.kind != tokString {
+		p.fail("expected string instead of %s", p.tok)
+		return nil
+	}
+	value := p.tok.text
+	p.next()
+	switch {
+	case op.is("contains"):
+		return &contains{field: field, value: []byte(value)}
+	case op.text == "=":
+		return &equals{field: field, value: []byte(value)}
+	case op.is("matches"):
+		re, err := regexp.Compile(value)
+		if err != nil {
+			p.fail("invalid regexp at %d: %s", op.pos, err)
+			return nil
+		}
+		return &matches{field: field, re: re}
+	default:
+		p.fail("unknown operator %s", op)
+		return nil
+	}
+}
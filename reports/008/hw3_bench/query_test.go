@@ -0,0 +1,155 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"strings"
+	"testing"
+)
+
+// testUser is the record the queries are checked against.
+var testUser = &User{
+	Browsers: [][]byte{
+		[]byte("Mozilla/5.0 (Linux; U; Android 1.5; en-gb) Mobile Safari/525.20.1"),
+		[]byte("Mozilla/4.0 (compatible; MSIE 7.0; Windows NT 6.0; Trident/5.0)"),
+	},
+	Company: []byte("Jatri"),
+	Country: []byte("Kenya"),
+	Email:   []byte("eum_rerum@Topiczoom.info"),
+	Name:    []byte("Susan Ellis"),
+}
+
+func TestQueryMatch(t *testing.T) {
+	cases := []struct {
+		Query    string
+		Expected bool
+	}{
+		{`browsers contains "Android" AND browsers contains "MSIE"`, true},
+		{`browsers contains "Android" AND browsers contains "Opera"`, false},
+		{`browsers contains "Opera" or country = 'Kenya'`, true},
+		{`NOT country = "Kenya"`, false},
+		{`country = "Ken"`, false},
+		{`name matches "^Susan [A-Z]"`, true},
+		{`email contains "@" AND NOT (company = "Jatri" OR job contains "x")`, false},
+		{`(browsers contains 'MSIE 7.0') and phone = ""`, true},
+		{`name = "b" OR country = "Kenya" AND name = "x"`, false},
+	}
+	for _, tc := range cases {
+		q, err := ParseQuery(tc.Query)
+		if err != nil {
+			t.Errorf("%s", err)
+			continue
+		}
+		if got := q.Match(testUser); got != tc.Expected {
+			t.Errorf("%s\nGot: %v\nExpected: %v", tc.Query, got, tc.Expected)
+		}
+	}
+}
+
+func TestQueryMatchBrowser(t *testing.T) {
+	q := MustParseQuery(`browsers contains "Android" AND country = "Kenya"`)
+	if !q.MatchBrowser(testUser, testUser.Browsers[0]) {
+		t.Errorf("Android browser not matched")
+	}
+	if q.MatchBrowser(testUser, testUser.Browsers[1]) {
+		t.Errorf("MSIE browser matched")
+	}
+}
+
+func TestQueryErrors(t *testing.T) {
+	cases := []struct {
+		Query    string
+		Expected string
+	}{
+		{``, `query "": expected condition instead of end of query`},
+		{`age = "1"`, `query "age = \"1\"": unknown field "age" at 0`},
+		{`name is "x"`, `query "name is \"x\"": unknown operator "is" at 5`},
+		{`name = x`, `query "name = x": expected string instead of "x" at 7`},
+		{`name = 'x`, `query "name = 'x": unterminated string at 7`},
+		{`(name = "x"`, `query "(name = \"x\"": expected ) instead of end of query`},
+		{`name = "x")`, `query "name = \"x\")": unexpected ")" at 10`},
+		{`name matches "("`, "query \"name matches \\\"(\\\"\": invalid regexp at 5: error parsing regexp: missing closing ): `(`"},
+		{`name = "x" ! `, `query "name = \"x\" ! ": unexpected '!' at 11`},
+	}
+	for _, tc := range cases {
+		_, err := ParseQuery(tc.Query)
+		if err == nil || err.Error() != tc.Expected {
+			t.Errorf("Got: %v\nExpected: %s", err, tc.Expected)
+		}
+	}
+}
+
+func TestQueryLiterals(t *testing.T) {
+	cases := []struct {
+		Query    string
+		Expected string
+	}{
+		{`browsers contains "Android" AND browsers contains "MSIE"`, "[Android]"},
+		{`browsers contains "Android" OR browsers contains "MSIE"`, "[Android MSIE]"},
+		{`browsers contains "Android" OR name matches "x"`, "[]"},
+		{`name matches "x" AND country = "Kenya"`, "[Kenya]"},
+		{`NOT country = "Kenya"`, "[]"},
+		{`browsers contains "Mozilla/5.0"`, "[]"},
+	}
+	for _, tc := range cases {
+		var got []string
+		for _, lit := range MustParseQuery(tc.Query).root.literals() {
+			got = append(got, string(lit))
+		}
+		if fmt.Sprint(got) != tc.Expected {
+			t.Errorf("%s\nGot: %v\nExpected: %s", tc.Query, got, tc.Expected)
+		}
+	}
+}
+
+func TestQueryNoAllocs(t *testing.T) {
+	q := MustParseQuery(`(browsers contains "Android" AND browsers contains "MSIE") OR name matches "^S" OR country = "Kenya"`)
+	allocs := testing.AllocsPerRun(100, func() {
+		q.Match(testUser)
+		q.MatchBrowser(testUser, testUser.Browsers[0])
+	})
+	if allocs != 0 {
+		t.Errorf("allocations per match\nGot: %v\nExpected: 0", allocs)
+	}
+}
+
+// TestSearchCustom checks the search against straightforward evaluation over the decoded log.
+func TestSearchCustom(t *testing.T) {
+	s := MustNewSearch(`country = "Kenya" OR company matches "^Ja"`, `browsers contains "Firefox"`)
+	out := new(bytes.Buffer)
+	if _, err := s.Run(out, Strict); err != nil {
+		t.Fatal(err)
+	}
+
+	data, err := ioutil.ReadFile(filePath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected, seen := "found users:\n", map[string]bool{}
+	for i, line := range strings.Split(strings.TrimSuffix(string(data), "\n"), "\n") {
+		var u struct {
+			Browsers []string
+			Company  string
+			Country  string
+			Email    string
+			Name     string
+		}
+		if err = json.Unmarshal([]byte(line), &u); err != nil {
+			t.Fatal(err)
+		}
+		for _, b := range u.Browsers {
+			if strings.Contains(b, "Firefox") {
+				seen[b] = true
+			}
+		}
+		if u.Country == "Kenya" || strings.HasPrefix(u.Company, "Ja") {
+			expected += fmt.Sprintf("[%d] %s <%s>\n", i, u.Name, strings.Replace(u.Email, "@", " [at] ", 1))
+		}
+	}
+	expected += fmt.Sprintf("\nTotal unique browsers %d\n", len(seen))
+	if out.String() != expected {
+		t.Errorf("results not match\nGot:\n%v\nExpected:\n%v", out.String(), expected)
+	}
+}
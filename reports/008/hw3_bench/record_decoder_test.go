@@ -0,0 +1,60 @@
+// Code generated by decoder_gen, DO NOT EDIT.
+
+package main
+
+// DecodeJSON decodes the JSON object into `testRecord`, keys are matched case-sensitively, unknown fields are skipped
+// and nulls leave fields empty.
+// Byte slices share memory with the data unless they contain escapes.
+func (out *testRecord) DecodeJSON(data []byte) error {
+	*out = testRecord{Tags: out.Tags[:0], Lists: out.Lists[:0], Scores: out.Scores[:0]}
+	l := jsonLexer{data: data}
+	if !l.null() {
+		l.delim('{')
+		for first := true; l.next('}', first); first = false {
+			key := l.str()
+			l.delim(':')
+			if l.null() {
+				continue
+			}
+			switch string(key) {
+			case "id":
+				out.ID = int(l.int(intBits))
+			case "small":
+				out.Small = int8(l.int(8))
+			case "big":
+				out.Big = uint64(l.uint(64))
+			case "title":
+				out.Title = string(l.str())
+			case "tags":
+				out.Tags = out.Tags[:0]
+				l.delim('[')
+				for first := true; l.next(']', first); first = false {
+					out.Tags = append(out.Tags, string(l.str()))
+				}
+			case "raw":
+				out.Raw = l.str()
+			case "lists":
+				out.Lists = out.Lists[:0]
+				l.delim('[')
+				for first := true; l.next(']', first); first = false {
+					out.Lists = append(out.Lists, l.str())
+				}
+			case "scores":
+				out.Scores = out.Scores[:0]
+				l.delim('[')
+				for first := true; l.next(']', first); first = false {
+					out.Scores = append(out.Scores, int(l.int(intBits)))
+				}
+			case "active":
+				out.Active = l.bool()
+			case "rating":
+				out.Rating = float64(l.float(64))
+			case "Default":
+				out.Default = string(l.str())
+			default:
+				l.skip()
+			}
+		}
+	}
+	return l.end()
+}
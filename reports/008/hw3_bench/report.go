@@ -0,0 +1,278 @@
+package main
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+)
+
+// Dimension is a property of browsers counted by `BrowserReport`.
+type Dimension int
+
+const (
+	// ByFamily counts browser families like "Chrome".
+	ByFamily Dimension = iota
+	// ByVersion counts browser families with versions like "Chrome 41.0".
+	ByVersion
+	// ByOS counts operating systems with versions like "Windows 7".
+	ByOS
+	// ByDevice counts device classes like "mobile".
+	ByDevice
+)
+
+var dimensionNames = []string{"family", "version", "os", "device"}
+
+func (d Dimension) String() string {
+	return dimensionNames[d]
+}
+
+// ParseDimension returns the dimension with the given name.
+func ParseDimension(name string) (Dimension, error) {
+	for d, dn := range dimensionNames {
+		if strings.EqualFold(name, dn) {
+			return Dimension(d), nil
+		}
+	}
+	return 0, fmt.Errorf("unknown dimension %q, expected one of %s", name, strings.Join(dimensionNames, ", "))
+}
+
+// of returns the value of the dimension for the user agent.
+func (d Dimension) of(ua UserAgent) string {
+	switch d {
+	case ByVersion:
+		return strings.TrimSpace(ua.Family + " " + ua.Version)
+	case ByOS:
+		return strings.TrimSpace(ua.OS + " " + ua.OSVersion)
+	case ByDevice:
+		return ua.Device
+	default:
+		return ua.Family
+	}
+}
+
+// Format is the output format of reports and search results.
+type Format int
+
+const (
+	// FormatText is a human-readable table or text.
+	FormatText Format = iota
+	// FormatCSV is comma-separated values with a header.
+	FormatCSV
+	// FormatJSON is a single JSON document for reports and JSON lines for search results.
+	FormatJSON
+)
+
+var formatNames = []string{"text", "csv", "json"}
+
+func (f Format) String() string {
+	return formatNames[f]
+}
+
+// ParseFormat returns the format with the given name.
+func ParseFormat(name string) (Format, error) {
+	for f, fn := range formatNames {
+		if strings.EqualFold(name, fn) {
+			return Format(f), nil
+		}
+	}
+	return 0, fmt.Errorf("unknown format %q, expected one of %s", name, strings.Join(formatNames, ", "))
+}
+
+// ReportOptions configure `BrowserReport`, zero value reports top 10 browser families of all users as text.
+type ReportOptions struct {
+	// By is the counted property of browsers.
+	By Dimension
+	// Top is the number of rows in each table, 10 by default.
+	Top int
+	// GroupBy is the field of users to make a separate table for each of its values, like `FieldCountry`.
+	// `FieldBrowsers` which is the zero value means the single table for all users.
+	GroupBy Field
+	// Users selects the counted users, all by default.
+	Users  *Query
+	Format Format
+	Mode   Mode
+}
+
+// BrowserReport reads the log and writes the tables of the most popular values of the browser property.
+// Each row holds the number of users having at least one browser with the value and their share among
+// the users of the table. Malformed lines skipped in `Lenient` mode are returned.
+// The input is read as is, compressed input is read with `Decompress`.
+func BrowserReport(out io.Writer, in io.Reader, opts ReportOptions) (skipped []*LineError, err error) {
+	if opts.Top <= 0 {
+		opts.Top = 10
+	}
+
+	var (
+		agents = make(map[string]UserAgent)
+		groups = make(map[string]*reportGroup)
+		values []string
+		user   = &User{}
+		line   uint64
+		offset int64
+	)
+	sc := newLineScanner(in)
+	for ; sc.Scan(); line++ {
+		i, off := line, offset
+		offset += int64(sc.size)
+		if err = user.DecodeJSON(sc.Bytes()); err != nil {
+			lineErr := &LineError{Line: i, Offset: off, Err: err}
+			if opts.Mode == Strict {
+				return nil, lineErr
+			}
+			skipped = append(skipped, lineErr)
+			continue
+		}
+		if opts.Users != nil && !opts.Users.Match(user) {
+			continue
+		}
+
+		values = values[:0]
+		for _, browser := range user.Browsers {
+			ua, ok := agents[string(browser)]
+			if !ok {
+				ua = ParseUserAgent(string(browser))
+				agents[string(browser)] = ua
+			}
+			if val := opts.By.of(ua); !containsString(values, val) {
+				values = append(values, val)
+			}
+		}
+
+		var name []byte
+		if opts.GroupBy != FieldBrowsers {
+			user.any(opts.GroupBy, nil, func(val []byte) bool {
+				name = val
+				return true
+			})
+		}
+		g, ok := groups[string(name)]
+		if !ok {
+			g = &reportGroup{Name: string(name), counts: make(map[string]int)}
+			groups[g.Name] = g
+		}
+		g.Users++
+		for _, val := range values {
+			g.counts[val]++
+		}
+	}
+	if err = sc.Err(); err != nil {
+		return nil, err
+	}
+
+	tables := make([]*reportGroup, 0, len(groups))
+	for _, g := range groups {
+		g.top(opts.Top)
+		tables = append(tables, g)
+	}
+	sort.Slice(tables, func(i, j int) bool {
+		if tables[i].Users != tables[j].Users {
+			return tables[i].Users > tables[j].Users
+		}
+		return tables[i].Name < tables[j].Name
+	})
+	return skipped, writeReport(out, tables, opts)
+}
+
+// reportGroup is a table of the report.
+type reportGroup struct {
+	Name   string      `json:"name,omitempty"`
+	Users  int         `json:"users"`
+	Top    []reportRow `json:"top"`
+	counts map[string]int
+}
+
+type reportRow struct {
+	Value string  `json:"value"`
+	Users int     `json:"users"`
+	Share float64 `json:"share"`
+}
+
+// top fills the table with the most popular values.
+func (g *reportGroup) top(n int) {
+	g.Top = make([]reportRow, 0, len(g.counts))
+	for val, users := range g.counts {
+		g.Top = append(g.Top, reportRow{Value: val, Users: users, Share: float64(users) / float64(g.Users)})
+	}
+	sort.Slice(g.Top, func(i, j int) bool {
+		if g.Top[i].Users != g.Top[j].Users {
+			return g.Top[i].Users > g.Top[j].Users
+		}
+		return g.Top[i].Value < g.Top[j].Value
+	})
+	if len(g.Top) > n {
+		g.Top = g.Top[:n]
+	}
+}
+
+// writeReport writes the tables in the format of the options.
+func writeReport(out io.Writer, tables []*reportGroup, opts ReportOptions) error {
+	grouped := opts.GroupBy != FieldBrowsers
+	switch opts.Format {
+	case FormatJSON:
+		doc := struct {
+			By      string         `json:"by"`
+			GroupBy string         `json:"group_by,omitempty"`
+			Tables  []*reportGroup `json:"tables"`
+		}{By: opts.By.String(), Tables: tables}
+		if grouped {
+			doc.GroupBy = opts.GroupBy.String()
+		}
+		return json.NewEncoder(out).Encode(doc)
+
+	case FormatCSV:
+		w := csv.NewWriter(out)
+		header := []string{opts.By.String(), "users", "share"}
+		if grouped {
+			header = append([]string{opts.GroupBy.String()}, header...)
+		}
+		if err := w.Write(header); err != nil {
+			return err
+		}
+		for _, g := range tables {
+			for _, row := range g.Top {
+				record := []string{row.Value, strconv.Itoa(row.Users), strconv.FormatFloat(row.Share, 'f', 4, 64)}
+				if grouped {
+					record = append([]string{g.Name}, record...)
+				}
+				if err := w.Write(record); err != nil {
+					return err
+				}
+			}
+		}
+		w.Flush()
+		return w.Error()
+
+	default:
+		w := tabwriter.NewWriter(out, 0, 4, 2, ' ', 0)
+		for k, g := range tables {
+			if k > 0 {
+				fmt.Fprintln(w)
+			}
+			if grouped {
+				fmt.Fprintf(w, "%s: %s (%d users)\n", strings.ToUpper(opts.GroupBy.String()), g.Name, g.Users)
+			} else {
+				fmt.Fprintf(w, "ALL (%d users)\n", g.Users)
+			}
+			fmt.Fprintf(w, "%s\tUSERS\tSHARE\n", strings.ToUpper(opts.By.String()))
+			for _, row := range g.Top {
+				fmt.Fprintf(w, "%s\t%d\t%.1f%%\n", row.Value, row.Users, row.Share*100)
+			}
+		}
+		return w.Flush()
+	}
+}
+
+// containsString reports whether the list contains the string.
+func containsString(list []string, str string) bool {
+	for _, item := range list {
+		if item == str {
+			return true
+		}
+	}
+	return false
+}
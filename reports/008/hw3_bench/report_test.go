@@ -0,0 +1,109 @@
+package main
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+// reportLog is a small log with known browsers.
+const reportLog = `{"browsers":["Mozilla/5.0 (X11; Linux x86_64) Chrome/41.0.2227.0 Safari/537.36","Mozilla/5.0 (X11; Linux x86_64) Chrome/40.0 Safari/537.36"],"country":"Kenya","company":"Jatri"}
+{"browsers":["Mozilla/4.0 (compatible; MSIE 7.0; Windows NT 6.0)"],"country":"Kenya","company":"Flashpoint"}
+{"browsers":["Mozilla/5.0 (iPad; CPU OS 7_0 like Mac OS X) Version/7.0 Mobile/11A465 Safari/8536.25","Mozilla/4.0 (compatible; MSIE 8.0; Windows NT 6.1)"],"country":"Peru","company":"Jatri"}
+`
+
+func TestBrowserReport(t *testing.T) {
+	cases := []struct {
+		Name     string
+		Options  ReportOptions
+		Expected string
+	}{
+		{
+			Name:    "text",
+			Options: ReportOptions{},
+			Expected: `ALL (3 users)
+FAMILY  USERS  SHARE
+IE      2      66.7%
+Chrome  1      33.3%
+Safari  1      33.3%
+`,
+		},
+		{
+			Name:    "text by country",
+			Options: ReportOptions{By: ByDevice, GroupBy: FieldCountry, Top: 1},
+			Expected: `COUNTRY: Kenya (2 users)
+DEVICE   USERS  SHARE
+desktop  2      100.0%
+
+COUNTRY: Peru (1 users)
+DEVICE   USERS  SHARE
+desktop  1      100.0%
+`,
+		},
+		{
+			Name:    "csv by company",
+			Options: ReportOptions{By: ByVersion, GroupBy: FieldCompany, Format: FormatCSV},
+			Expected: `company,version,users,share
+Jatri,Chrome 40.0,1,0.5000
+Jatri,Chrome 41.0,1,0.5000
+Jatri,IE 8.0,1,0.5000
+Jatri,Safari 7.0,1,0.5000
+Flashpoint,IE 7.0,1,1.0000
+`,
+		},
+		{
+			Name:    "json filtered",
+			Options: ReportOptions{By: ByOS, Format: FormatJSON, Users: MustParseQuery(`country = "Kenya"`)},
+			Expected: `{"by":"os","tables":[{"users":2,"top":[{"value":"Linux","users":1,"share":0.5},{"value":"Windows Vista","users":1,"share":0.5}]}]}
+`,
+		},
+	}
+	for _, tc := range cases {
+		t.Run(tc.Name, func(t *testing.T) {
+			out := new(bytes.Buffer)
+			if _, err := BrowserReport(out, strings.NewReader(reportLog), tc.Options); err != nil {
+				t.Fatal(err)
+			}
+			if out.String() != tc.Expected {
+				t.Errorf("Got:\n%s\nExpected:\n%s", out.String(), tc.Expected)
+			}
+		})
+	}
+}
+
+func TestBrowserReportMalformed(t *testing.T) {
+	log := reportLog + "{\"browsers\":\n" + reportLog
+	_, err := BrowserReport(new(bytes.Buffer), strings.NewReader(log), ReportOptions{})
+	if lineErr, ok := err.(*LineError); !ok || lineErr.Line != 3 || lineErr.Offset != int64(len(reportLog)) {
+		t.Errorf("Got: %v\nExpected: error at line 3", err)
+	}
+
+	out := new(bytes.Buffer)
+	skipped, err := BrowserReport(out, strings.NewReader(log), ReportOptions{Mode: Lenient, Top: 1})
+	if err != nil || len(skipped) != 1 || skipped[0].Line != 3 {
+		t.Errorf("Got: %v %v\nExpected: line 3 skipped", skipped, err)
+	}
+	if expected := "ALL (6 users)\nFAMILY  USERS  SHARE\nIE      4      66.7%\n"; out.String() != expected {
+		t.Errorf("Got:\n%s\nExpected:\n%s", out.String(), expected)
+	}
+}
+
+func TestRunReportGroupByBrowsers(t *testing.T) {
+	expected := "-group-by browsers is not supported, use -by to split users by browsers"
+	if _, err := runReport(filePath, "family", "browsers", "text", 10, nil, Strict); err == nil || err.Error() != expected {
+		t.Errorf("Got: %v\nExpected: %s", err, expected)
+	}
+}
+
+func TestParseDimensionFormat(t *testing.T) {
+	if d, err := ParseDimension("OS"); d != ByOS || err != nil {
+		t.Errorf("Got: %v %v\nExpected: %v", d, err, ByOS)
+	}
+	if f, err := ParseFormat("csv"); f != FormatCSV || err != nil {
+		t.Errorf("Got: %v %v\nExpected: %v", f, err, FormatCSV)
+	}
+	expected := `unknown format "xml", expected one of text, csv, json`
+	if _, err := ParseFormat("xml"); err == nil || err.Error() != expected {
+		t.Errorf("Got: %v\nExpected: %s", err, expected)
+	}
+}
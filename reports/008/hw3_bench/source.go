@@ -0,0 +1,210 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/klauspost/compress/zstd"
+)
+
+// Stdin is the source name meaning the standard input.
+const Stdin = "-"
+
+var (
+	gzipMagic = []byte{0x1f, 0x8b}
+	zstdMagic = []byte{0x28, 0xb5, 0x2f, 0xfd}
+)
+
+// OpenSource opens the users log for reading. The name is either `Stdin`, a file or a glob pattern
+// matching rotated files which are read one after another in the order of `SortRotated`.
+// Files compressed with gzip or zstd are decompressed transparently.
+func OpenSource(name string) (io.ReadCloser, error) {
+	if name == Stdin {
+		return Decompress(os.Stdin)
+	}
+	files, err := filepath.Glob(name)
+	if err != nil {
+		return nil, err
+	}
+	if len(files) == 0 {
+		return nil, fmt.Errorf("%s: no such file", name)
+	}
+	SortRotated(files)
+	return &multiFile{files: files}, nil
+}
+
+// Decompress returns the reader decompressing the input if it's compressed with gzip or zstd
+// and passing it as is otherwise. Closing the reader doesn't close the input.
+func Decompress(in io.Reader) (io.ReadCloser, error) {
+	magic, r, err := peekMagic(in)
+	if err != nil {
+		return nil, err
+	}
+	switch {
+	case bytes.HasPrefix(magic, gzipMagic):
+		return gzip.NewReader(r)
+	case bytes.HasPrefix(magic, zstdMagic):
+		d, err := zstd.NewReader(r)
+		if err != nil {
+			return nil, err
+		}
+		return zstdReader{d}, nil
+	default:
+		return nopCloser{r}, nil
+	}
+}
+
+// peekMagic returns the first bytes of the input telling its compression and the reader of the whole input.
+// Seekable input like a file is rewound after reading them, otherwise it's buffered.
+func peekMagic(in io.Reader) ([]byte, io.Reader, error) {
+	if rs, ok := in.(io.ReadSeeker); ok {
+		if pos, err := rs.Seek(0, io.SeekCurrent); err == nil {
+			magic := make([]byte, len(zstdMagic))
+			n, err := io.ReadFull(rs, magic)
+			if err != nil && err != io.EOF && err != io.ErrUnexpectedEOF {
+				return nil, nil, err
+			}
+			if _, err = rs.Seek(pos, io.SeekStart); err != nil {
+				return nil, nil, err
+			}
+			return magic[:n], rs, nil
+		}
+	}
+	br := bufio.NewReader(in)
+	magic, err := br.Peek(len(zstdMagic))
+	if err != nil && err != io.EOF && err != bufio.ErrBufferFull {
+		return nil, nil, err
+	}
+	return magic, br, nil
+}
+
+// zstdReader adapts `zstd.Decoder` to `io.ReadCloser`.
+type zstdReader struct {
+	*zstd.Decoder
+}
+
+func (r zstdReader) Close() error {
+	r.Decoder.Close()
+	return nil
+}
+
+type nopCloser struct {
+	io.Reader
+}
+
+func (nopCloser) Close() error {
+	return nil
+}
+
+// SortRotated orders rotated log files from the oldest to the newest:
+// files with the numeric suffix like `users.txt.2.gz` go first with higher numbers being older,
+// then the rest of the files in lexical order except that the file goes after the ones with its name as the prefix
+// like `users.txt-20190801`.
+func SortRotated(files []string) {
+	sort.SliceStable(files, func(i, j int) bool {
+		ri, rj := rotation(files[i]), rotation(files[j])
+		switch {
+		case ri != rj:
+			return ri > rj
+		case strings.HasPrefix(files[j], files[i]):
+			return false
+		case strings.HasPrefix(files[i], files[j]):
+			return true
+		default:
+			return files[i] < files[j]
+		}
+	})
+}
+
+// rotation returns the rotation number of the file or -1 if it doesn't have one.
+func rotation(name string) int {
+	name = strings.TrimSuffix(strings.TrimSuffix(filepath.Base(name), ".gz"), ".zst")
+	dot := strings.LastIndexByte(name, '.')
+	if dot < 0 {
+		return -1
+	}
+	n, err := strconv.Atoi(name[dot+1:])
+	if err != nil || n < 0 {
+		return -1
+	}
+	return n
+}
+
+// multiFile reads files one after another opening them only when needed.
+// Lines never span files: the newline is added after a file which doesn't end with it.
+type multiFile struct {
+	files []string
+	f     *os.File
+	r     io.ReadCloser
+	last  byte
+}
+
+func (m *multiFile) Read(p []byte) (int, error) {
+	for {
+		if m.r == nil {
+			if len(m.files) == 0 {
+				return 0, io.EOF
+			}
+			if len(p) > 0 && m.last != 0 && m.last != '\n' {
+				m.last = '\n'
+				p[0] = '\n'
+				return 1, nil
+			}
+			if err := m.open(); err != nil {
+				return 0, err
+			}
+		}
+		n, err := m.r.Read(p)
+		if n > 0 {
+			m.last = p[n-1]
+		}
+		if err == io.EOF {
+			err = m.closeFile()
+			if n > 0 || err != nil {
+				return n, err
+			}
+			continue
+		}
+		return n, err
+	}
+}
+
+// open opens the next file.
+func (m *multiFile) open() error {
+	f, err := os.Open(m.files[0])
+	if err != nil {
+		return err
+	}
+	r, err := Decompress(f)
+	if err != nil {
+		f.Close()
+		return fmt.Errorf("%s: %s", m.files[0], err)
+	}
+	m.f, m.r = f, r
+	return nil
+}
+
+// closeFile closes the current file and moves to the next one.
+func (m *multiFile) closeFile() error {
+	err := m.r.Close()
+	if ferr := m.f.Close(); err == nil {
+		err = ferr
+	}
+	m.f, m.r, m.files = nil, nil, m.files[1:]
+	return err
+}
+
+func (m *multiFile) Close() error {
+	if m.r == nil {
+		return nil
+	}
+	return m.closeFile()
+}
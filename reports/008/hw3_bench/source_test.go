@@ -0,0 +1,137 @@
+package main
+
+import (
+	"bytes"
+	"compress/gzip"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/klauspost/compress/zstd"
+)
+
+func gzipData(t *testing.T, data []byte) []byte {
+	buf := new(bytes.Buffer)
+	w := gzip.NewWriter(buf)
+	if _, err := w.Write(data); err != nil {
+		t.Fatal(err)
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func zstdData(t *testing.T, data []byte) []byte {
+	w, err := zstd.NewWriter(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer w.Close()
+	return w.EncodeAll(data, nil)
+}
+
+// tempFiles writes the files into the temporary directory and returns its path.
+func tempFiles(t *testing.T, files map[string][]byte) (string, func()) {
+	dir, err := ioutil.TempDir("", "hw3_source")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for name, data := range files {
+		if err = ioutil.WriteFile(filepath.Join(dir, name), data, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return dir, func() {
+		os.RemoveAll(dir)
+	}
+}
+
+func TestSources(t *testing.T) {
+	data, err := ioutil.ReadFile(filePath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	lines := bytes.SplitAfter(data, []byte("\n"))
+	first := bytes.Join(lines[:300], nil)
+	second := bytes.TrimSuffix(bytes.Join(lines[300:700], nil), []byte("\n"))
+	third := bytes.Join(lines[700:], nil)
+	dir, cleanup := tempFiles(t, map[string][]byte{
+		"users.txt":        data,
+		"users.txt.gz":     gzipData(t, data),
+		"users.txt.zst":    zstdData(t, data),
+		"app.log.2.gz":     gzipData(t, first),
+		"app.log.1.zst":    zstdData(t, second),
+		"app.log":          third,
+		"app.log.10.gz":    gzipData(t, nil),
+		"other.log.backup": []byte("not a log"),
+	})
+	defer cleanup()
+
+	expected := new(bytes.Buffer)
+	FastSearch(expected)
+	for _, name := range []string{"users.txt", "users.txt.gz", "users.txt.zst", "app.log*"} {
+		t.Run(name, func(t *testing.T) {
+			out := new(bytes.Buffer)
+			if _, err := DefaultSearch.RunSource(out, filepath.Join(dir, name), Strict); err != nil {
+				t.Fatal(err)
+			}
+			if out.String() != expected.String() {
+				t.Errorf("results not match\nGot:\n%v\nExpected:\n%v", out.String(), expected.String())
+			}
+		})
+	}
+	// files are rewound after reading the magic bytes, streams like stdin are buffered
+	tail := bytes.NewReader(append([]byte("skipped"), data...))
+	tail.Seek(int64(len("skipped")), io.SeekStart)
+	readers := map[string]io.Reader{
+		"reader":       bytes.NewReader(zstdData(t, data)),
+		"stream":       struct{ io.Reader }{bytes.NewReader(gzipData(t, data))},
+		"plain stream": struct{ io.Reader }{bytes.NewReader(data)},
+		"plain tail":   tail,
+	}
+	for name, in := range readers {
+		t.Run(name, func(t *testing.T) {
+			r, err := Decompress(in)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer r.Close()
+			out := new(bytes.Buffer)
+			if _, err = DefaultSearch.RunReader(out, r, Strict); err != nil {
+				t.Fatal(err)
+			}
+			if out.String() != expected.String() {
+				t.Errorf("results not match\nGot:\n%v\nExpected:\n%v", out.String(), expected.String())
+			}
+		})
+	}
+}
+
+func TestOpenSourceMissing(t *testing.T) {
+	_, err := OpenSource("./data/missing*.txt")
+	expected := "./data/missing*.txt: no such file"
+	if err == nil || err.Error() != expected {
+		t.Errorf("Got: %v\nExpected: %s", err, expected)
+	}
+}
+
+func TestSortRotated(t *testing.T) {
+	files := []string{
+		"log/users.txt",
+		"log/users.txt.1",
+		"log/users.txt.10.gz",
+		"log/users.txt.2.zst",
+		"log/users.txt-20190802",
+		"log/users.txt-20190801",
+	}
+	SortRotated(files)
+	got := strings.Join(files, " ")
+	expected := "log/users.txt.10.gz log/users.txt.2.zst log/users.txt.1 log/users.txt-20190801 log/users.txt-20190802 log/users.txt"
+	if got != expected {
+		t.Errorf("Got: %s\nExpected: %s", got, expected)
+	}
+}
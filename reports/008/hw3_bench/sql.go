@@ -0,0 +1,495 @@
+package main
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+)
+
+// Statement is a compiled SQL-like query over the users log.
+//
+// The syntax is
+//
+//	statement := SELECT columns [FROM string] [WHERE expr] [GROUP BY field {, field}]
+//		[ORDER BY order {, order}] [LIMIT number]
+//	columns := * | column {, column}
+//	column := field | COUNT | COUNT(*)
+//	order := (field | COUNT) [ASC | DESC]
+//
+// where `expr` is a condition of `Query`. Keywords are case-insensitive. With GROUP BY the rows are groups of users
+// with equal values of the grouped fields, COUNT is the number of users in the group and other fields take the values
+// of the first user of the group. Grouping by browsers puts the user into the group of each browser matching WHERE.
+// SELECT * selects all fields of users or the grouped fields and COUNT of groups.
+type Statement struct {
+	src string
+	// Columns are the selected fields, `countColumn` stands for COUNT.
+	Columns []Field
+	// From is the source of the log for `OpenSource`, empty if the statement doesn't set it.
+	From    string
+	Where   *Query
+	GroupBy []Field
+	OrderBy []Order
+	// Limit is the maximal number of rows, 0 means no limit.
+	Limit int
+}
+
+// Order is an item of ORDER BY.
+type Order struct {
+	// Field is the sorted field or `countColumn`.
+	Field Field
+	Desc  bool
+}
+
+// countColumn is the column of COUNT which goes after the fields of `User`.
+const countColumn = FieldPhone + 1
+
+// columnName returns the name of the column in the results.
+func columnName(f Field) string {
+	if f == countColumn {
+		return "count"
+	}
+	return f.String()
+}
+
+// ParseStatement compiles the statement.
+func ParseStatement(src string) (*Statement, error) {
+	p := &parser{src: src}
+	p.next()
+	st := p.statement()
+	if p.err == nil && p.tok.kind != tokEOF {
+		p.fail("unexpected %s", p.tok)
+	}
+	if p.err == nil {
+		p.err = st.check()
+	}
+	if p.err != nil {
+		return nil, fmt.Errorf("statement %q: %s", src, p.err)
+	}
+	st.src = src
+	return st, nil
+}
+
+// String returns the source of the statement.
+func (st *Statement) String() string {
+	return st.src
+}
+
+// keyword consumes the keyword or fails.
+func (p *parser) keyword(keyword string) {
+	if p.err == nil && !p.tok.is(keyword) {
+		p.fail("expected %s instead of %s", keyword, p.tok)
+	}
+	p.next()
+}
+
+func (p *parser) statement() *Statement {
+	st := &Statement{}
+	p.keyword("SELECT")
+	if p.tok.kind == tokStar {
+		p.next()
+	} else {
+		st.Columns = p.columns(true)
+	}
+	if p.err == nil && p.tok.is("FROM") {
+		p.next()
+		if p.tok.kind != tokString {
+			p.fail("expected string instead of %s", p.tok)
+		}
+		st.From = p.tok.text
+		p.next()
+	}
+	if p.err == nil && p.tok.is("WHERE") {
+		start := p.tok.pos
+		p.next()
+		// the condition is parsed by the `Query` grammar and ends at the first word not belonging to it
+		from := p.tok.pos
+		root := p.expr()
+		st.Where = &Query{src: strings.TrimSpace(p.src[from:p.tok.pos]), root: root}
+		if p.err != nil {
+			p.err = fmt.Errorf("WHERE at %d: %s", start, p.err)
+		}
+	}
+	if p.err == nil && p.tok.is("GROUP") {
+		p.next()
+		p.keyword("BY")
+		st.GroupBy = p.columns(false)
+	}
+	if p.err == nil && p.tok.is("ORDER") {
+		p.next()
+		p.keyword("BY")
+		for p.err == nil {
+			o := Order{Field: p.column(true)}
+			if p.tok.is("DESC") || p.tok.is("ASC") {
+				o.Desc = p.tok.is("DESC")
+				p.next()
+			}
+			st.OrderBy = append(st.OrderBy, o)
+			if p.tok.kind != tokComma {
+				break
+			}
+			p.next()
+		}
+	}
+	if p.err == nil && p.tok.is("LIMIT") {
+		p.next()
+		n, err := strconv.Atoi(p.tok.text)
+		if p.tok.kind != tokWord || err != nil || n <= 0 {
+			p.fail("expected positive number instead of %s", p.tok)
+		}
+		st.Limit = n
+		p.next()
+	}
+	return st
+}
+
+// columns parses the list of fields and COUNT if it's allowed.
+func (p *parser) columns(count bool) []Field {
+	var res []Field
+	for p.err == nil {
+		res = append(res, p.column(count))
+		if p.tok.kind != tokComma {
+			break
+		}
+		p.next()
+	}
+	return res
+}
+
+// column parses the field or COUNT if it's allowed.
+func (p *parser) column(count bool) Field {
+	if p.err != nil {
+		return 0
+	}
+	if count && p.tok.is("COUNT") {
+		p.next()
+		if p.tok.kind == tokLParen {
+			p.next()
+			if p.tok.kind != tokStar {
+				p.fail("expected * instead of %s", p.tok)
+			}
+			p.next()
+			if p.err == nil && p.tok.kind != tokRParen {
+				p.fail("expected ) instead of %s", p.tok)
+			}
+			p.next()
+		}
+		return countColumn
+	}
+	if p.tok.kind != tokWord {
+		p.fail("expected field instead of %s", p.tok)
+		return 0
+	}
+	f, err := ParseField(p.tok.text)
+	if err != nil {
+		p.fail("%s at %d", err, p.tok.pos)
+	}
+	p.next()
+	return f
+}
+
+// check validates the statement and fills SELECT *.
+func (st *Statement) check() error {
+	grouped := make(map[Field]bool)
+	for _, f := range st.GroupBy {
+		grouped[f] = true
+	}
+	if st.Columns == nil {
+		if len(st.GroupBy) > 0 {
+			st.Columns = append(append(st.Columns, st.GroupBy...), countColumn)
+		} else {
+			for f := FieldBrowsers; f < countColumn; f++ {
+				st.Columns = append(st.Columns, f)
+			}
+		}
+	}
+	for _, f := range st.Columns {
+		if f == countColumn && len(st.GroupBy) == 0 {
+			return fmt.Errorf("COUNT requires GROUP BY")
+		}
+		if f == FieldBrowsers && len(st.GroupBy) > 0 && !grouped[f] {
+			return fmt.Errorf("browsers must be grouped to be selected with GROUP BY")
+		}
+	}
+	for _, o := range st.OrderBy {
+		if o.Field == countColumn && len(st.GroupBy) == 0 {
+			return fmt.Errorf("COUNT requires GROUP BY")
+		}
+		if o.Field == FieldBrowsers && !grouped[o.Field] {
+			return fmt.Errorf("can't order by browsers unless they are grouped")
+		}
+	}
+	return nil
+}
+
+// row is a row of the results, `values` are indexed by fields.
+type row struct {
+	values   [countColumn]string
+	browsers []string
+	count    int
+}
+
+// SQLOptions configure `Statement.Run`, redaction policies are the same as in `Output`.
+type SQLOptions struct {
+	Format Format
+	Email  Redaction
+	Phone  Redaction
+	Salt   string
+	Mode   Mode
+}
+
+// Run executes the statement in a single pass over the log read from the input as is, compressed input is read
+// with `Decompress`, and writes the rows. Memory is bounded by the number of rows and groups rather than by the size of the log:
+// without ORDER BY the reading stops after LIMIT rows and with it only the best rows are kept.
+// Malformed lines skipped in `Lenient` mode are returned, in `Strict` mode nothing is written on error.
+func (st *Statement) Run(out io.Writer, in io.Reader, opts SQLOptions) (skipped []*LineError, err error) {
+	filter := &Search{}
+	if st.Where != nil {
+		filter.prefilter = st.Where.root.literals()
+	}
+	needed := make(map[Field]bool)
+	for _, f := range st.Columns {
+		needed[f] = true
+	}
+	for _, o := range st.OrderBy {
+		needed[o.Field] = true
+	}
+	redact := &Output{Email: opts.Email, Phone: opts.Phone, Salt: opts.Salt}
+
+	var (
+		rows   []*row
+		groups = make(map[string]*row)
+		user   = &User{}
+		key    []byte
+		seen   = make(hashSet)
+		line   uint64
+		offset int64
+	)
+	sc := newLineScanner(in)
+	for ; sc.Scan(); line++ {
+		i, off := line, offset
+		offset += int64(sc.size)
+		if !filter.worthParsing(sc.Bytes()) {
+			continue
+		}
+		if err = user.DecodeJSON(sc.Bytes()); err != nil {
+			lineErr := &LineError{Line: i, Offset: off, Err: err}
+			if opts.Mode == Strict {
+				return nil, lineErr
+			}
+			skipped = append(skipped, lineErr)
+			continue
+		}
+		if st.Where != nil && !st.Where.Match(user) {
+			continue
+		}
+
+		if len(st.GroupBy) == 0 {
+			rows = append(rows, st.row(user, needed, redact))
+			if st.Limit > 0 && len(rows) >= st.Limit {
+				if len(st.OrderBy) == 0 {
+					break
+				}
+				// the top rows are collected in batches so as not to sort after each one
+				if len(rows) >= 2*st.Limit {
+					rows = st.sort(rows)[:st.Limit]
+				}
+			}
+			continue
+		}
+
+		key = key[:0]
+		browsers := [][]byte{nil}
+		grouped := false
+		for _, f := range st.GroupBy {
+			if f == FieldBrowsers {
+				grouped = true
+				continue
+			}
+			user.any(f, nil, func(val []byte) bool {
+				key = append(key, val...)
+				return true
+			})
+			key = append(key, 0)
+		}
+		if grouped {
+			browsers = browsers[:0]
+			for k := range seen {
+				delete(seen, k)
+			}
+			for _, browser := range user.Browsers {
+				if _, dup := seen[string(browser)]; !dup && (st.Where == nil || st.Where.MatchBrowser(user, browser)) {
+					seen.add(browser)
+					browsers = append(browsers, browser)
+				}
+			}
+		}
+		for _, browser := range browsers {
+			n := len(key)
+			key = append(key, browser...)
+			g, ok := groups[string(key)]
+			if !ok {
+				g = st.row(user, needed, redact)
+				if grouped {
+					g.values[FieldBrowsers], g.browsers = string(browser), nil
+				}
+				groups[string(key)] = g
+				rows = append(rows, g)
+			}
+			g.count++
+			key = key[:n]
+		}
+	}
+	if err = sc.Err(); err != nil {
+		return nil, err
+	}
+
+	rows = st.sort(rows)
+	if st.Limit > 0 && len(rows) > st.Limit {
+		rows = rows[:st.Limit]
+	}
+	return skipped, st.write(out, rows, opts.Format)
+}
+
+// row returns the row of the user with the needed fields.
+func (st *Statement) row(user *User, needed map[Field]bool, redact *Output) *row {
+	res := &row{}
+	for f := range needed {
+		switch f {
+		case countColumn:
+		case FieldBrowsers:
+			res.browsers = make([]string, len(user.Browsers))
+			for k, browser := range user.Browsers {
+				res.browsers[k] = string(browser)
+			}
+		case FieldEmail:
+			res.values[f] = redact.redact(redact.Email, user.Email, maskEmail)
+		case FieldPhone:
+			res.values[f] = redact.redact(redact.Phone, user.Phone, maskPhone)
+		default:
+			user.any(f, nil, func(val []byte) bool {
+				res.values[f] = string(val)
+				return true
+			})
+		}
+	}
+	return res
+}
+
+// sort orders the rows by ORDER BY keeping the order of equal rows.
+func (st *Statement) sort(rows []*row) []*row {
+	if len(st.OrderBy) == 0 {
+		return rows
+	}
+	sort.SliceStable(rows, func(i, j int) bool {
+		for _, o := range st.OrderBy {
+			var less, greater bool
+			if o.Field == countColumn {
+				less, greater = rows[i].count < rows[j].count, rows[i].count > rows[j].count
+			} else {
+				less, greater = rows[i].values[o.Field] < rows[j].values[o.Field], rows[i].values[o.Field] > rows[j].values[o.Field]
+			}
+			if o.Desc {
+				less, greater = greater, less
+			}
+			if less || greater {
+				return less
+			}
+		}
+		return false
+	})
+	return rows
+}
+
+// value returns the value of the column in the row, browsers of a user are joined with the separator.
+func (r *row) value(f Field, sep string) string {
+	switch {
+	case f == countColumn:
+		return strconv.Itoa(r.count)
+	case f == FieldBrowsers && r.browsers != nil:
+		return strings.Join(r.browsers, sep)
+	default:
+		return r.values[f]
+	}
+}
+
+// write writes the rows in the format.
+func (st *Statement) write(out io.Writer, rows []*row, format Format) error {
+	switch format {
+	case FormatJSON:
+		enc := json.NewEncoder(out)
+		for _, r := range rows {
+			// keys go in the SELECT order, so the object is built by hand
+			var buf strings.Builder
+			buf.WriteByte('{')
+			for k, f := range st.Columns {
+				if k > 0 {
+					buf.WriteByte(',')
+				}
+				name, _ := json.Marshal(columnName(f))
+				buf.Write(name)
+				buf.WriteByte(':')
+				var val interface{} = r.value(f, "")
+				if f == countColumn {
+					val = r.count
+				} else if f == FieldBrowsers && r.browsers != nil {
+					val = r.browsers
+				}
+				data, err := json.Marshal(val)
+				if err != nil {
+					return err
+				}
+				buf.Write(data)
+			}
+			buf.WriteByte('}')
+			if err := enc.Encode(json.RawMessage(buf.String())); err != nil {
+				return err
+			}
+		}
+		return nil
+
+	case FormatCSV:
+		w := csv.NewWriter(out)
+		record := make([]string, len(st.Columns))
+		for k, f := range st.Columns {
+			record[k] = columnName(f)
+		}
+		if err := w.Write(record); err != nil {
+			return err
+		}
+		for _, r := range rows {
+			for k, f := range st.Columns {
+				record[k] = r.value(f, "\n")
+			}
+			if err := w.Write(record); err != nil {
+				return err
+			}
+		}
+		w.Flush()
+		return w.Error()
+
+	default:
+		w := tabwriter.NewWriter(out, 0, 4, 2, ' ', 0)
+		for k, f := range st.Columns {
+			if k > 0 {
+				fmt.Fprint(w, "\t")
+			}
+			fmt.Fprint(w, strings.ToUpper(columnName(f)))
+		}
+		fmt.Fprintln(w)
+		for _, r := range rows {
+			for k, f := range st.Columns {
+				if k > 0 {
+					fmt.Fprint(w, "\t")
+				}
+				fmt.Fprint(w, r.value(f, " | "))
+			}
+			fmt.Fprintln(w)
+		}
+		return w.Flush()
+	}
+}
@@ -0,0 +1,258 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"sort"
+	"strings"
+	"testing"
+)
+
+func TestParseStatement(t *testing.T) {
+	cases := []struct {
+		SQL      string
+		Expected string
+	}{
+		{
+			`SELECT name, email WHERE browsers CONTAINS 'MSIE' GROUP BY country ORDER BY count DESC LIMIT 10`,
+			`[name email] "" browsers CONTAINS 'MSIE' [country] [{count true}] 10`,
+		},
+		{`select * from 'data/users.*'`, `[browsers company country email job name phone] "data/users.*" <nil> [] [] 0`},
+		{`SELECT * GROUP BY country, job`, `[country job count] "" <nil> [country job] [] 0`},
+		{
+			`SELECT COUNT(*), browsers WHERE (name matches "^S" or NOT country = "Kenya") GROUP BY browsers ORDER BY count, browsers ASC`,
+			`[count browsers] "" (name matches "^S" or NOT country = "Kenya") [browsers] [{count false} {browsers false}] 0`,
+		},
+	}
+	for _, tc := range cases {
+		st, err := ParseStatement(tc.SQL)
+		if err != nil {
+			t.Errorf("%s: %s", tc.SQL, err)
+			continue
+		}
+		names := make([]string, len(st.Columns))
+		for k, f := range st.Columns {
+			names[k] = columnName(f)
+		}
+		var orders []string
+		for _, o := range st.OrderBy {
+			orders = append(orders, fmt.Sprintf("{%s %v}", columnName(o.Field), o.Desc))
+		}
+		got := fmt.Sprintf("%v %q %v %v [%s] %d", names, st.From, st.Where, st.GroupBy, strings.Join(orders, " "), st.Limit)
+		if got != tc.Expected {
+			t.Errorf("%s\nGot: %s\nExpected: %s", tc.SQL, got, tc.Expected)
+		}
+	}
+}
+
+func TestParseStatementErrors(t *testing.T) {
+	cases := []struct {
+		SQL      string
+		Expected string
+	}{
+		{``, `expected SELECT instead of end of query`},
+		{`SELECT`, `expected field instead of end of query`},
+		{`SELECT name,`, `expected field instead of end of query`},
+		{`SELECT age`, `unknown field "age" at 7`},
+		{`SELECT count`, `COUNT requires GROUP BY`},
+		{`SELECT name ORDER BY count`, `COUNT requires GROUP BY`},
+		{`SELECT browsers GROUP BY country`, `browsers must be grouped to be selected with GROUP BY`},
+		{`SELECT name ORDER BY browsers`, `can't order by browsers unless they are grouped`},
+		{`SELECT COUNT(name) GROUP BY job`, `expected * instead of "name" at 13`},
+		{`SELECT name WHERE`, `WHERE at 12: expected condition instead of end of query`},
+		{`SELECT name WHERE name contains 'a' LIMIT`, `expected positive number instead of end of query`},
+		{`SELECT name LIMIT -1`, `unexpected '-' at 18`},
+		{`SELECT name LIMIT 0`, `expected positive number instead of "0" at 18`},
+		{`SELECT name GROUP country`, `expected BY instead of "country" at 18`},
+		{`SELECT name FROM users`, `expected string instead of "users" at 17`},
+		{`SELECT name LIMIT 1 LIMIT 2`, `unexpected "LIMIT" at 20`},
+	}
+	for _, tc := range cases {
+		expected := fmt.Sprintf("statement %q: %s", tc.SQL, tc.Expected)
+		if _, err := ParseStatement(tc.SQL); err == nil || err.Error() != expected {
+			t.Errorf("Got: %v\nExpected: %s", err, expected)
+		}
+	}
+}
+
+// runSQL runs the statement over `users.txt`.
+func runSQL(t *testing.T, sql string, opts SQLOptions) string {
+	st, err := ParseStatement(sql)
+	if err != nil {
+		t.Fatal(err)
+	}
+	f, err := os.Open(filePath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	out := new(bytes.Buffer)
+	if _, err = st.Run(out, f, opts); err != nil {
+		t.Fatal(err)
+	}
+	return out.String()
+}
+
+func TestStatementSearch(t *testing.T) {
+	// the same users FastSearch finds
+	expected := new(bytes.Buffer)
+	s := *DefaultSearch
+	s.Output = &Output{Format: FormatCSV}
+	if _, err := s.Run(expected, Strict); err != nil {
+		t.Fatal(err)
+	}
+	var want []string
+	lines := strings.Split(strings.TrimSpace(expected.String()), "\n")
+	// without the header and the closing row with the number of unique browsers
+	for _, line := range lines[1 : len(lines)-1] {
+		want = append(want, line[strings.IndexByte(line, ',')+1:])
+	}
+	got := runSQL(t, `SELECT name, email WHERE browsers contains "Android" AND browsers contains "MSIE"`, SQLOptions{Format: FormatCSV})
+	if got != "name,email\n"+strings.Join(want, "\n")+"\n" {
+		t.Errorf("Got:\n%s\nExpected:\n%s", got, strings.Join(want, "\n"))
+	}
+
+	got = runSQL(t, `SELECT name, email WHERE browsers contains "Android" AND browsers contains "MSIE" LIMIT 3`, SQLOptions{Format: FormatCSV})
+	if got != "name,email\n"+strings.Join(want[:3], "\n")+"\n" {
+		t.Errorf("Got:\n%s\nExpected:\n%s", got, strings.Join(want[:3], "\n"))
+	}
+
+	// LIMIT with ORDER BY picks the top rows of the whole log
+	sort.Strings(want)
+	got = runSQL(t, `SELECT name, email WHERE browsers contains "Android" AND browsers contains "MSIE" ORDER BY name, email LIMIT 5`, SQLOptions{Format: FormatCSV})
+	if got != "name,email\n"+strings.Join(want[:5], "\n")+"\n" {
+		t.Errorf("Got:\n%s\nExpected:\n%s", got, strings.Join(want[:5], "\n"))
+	}
+}
+
+func TestStatementGroupBy(t *testing.T) {
+	data, err := ioutil.ReadFile(filePath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	type jsonUser struct {
+		Browsers []string
+		Country  string
+		Name     string
+	}
+	counts, first := make(map[string]int), make(map[string]string)
+	browsers := make(map[string]int)
+	for _, line := range bytes.Split(bytes.TrimSpace(data), []byte("\n")) {
+		var u jsonUser
+		if err = json.Unmarshal(line, &u); err != nil {
+			t.Fatal(err)
+		}
+		seen := make(map[string]bool)
+		msie := false
+		for _, b := range u.Browsers {
+			if strings.Contains(b, "MSIE") {
+				msie = true
+				if !seen[b] {
+					browsers[b]++
+				}
+				seen[b] = true
+			}
+		}
+		if msie {
+			if counts[u.Country] == 0 {
+				first[u.Country] = u.Name
+			}
+			counts[u.Country]++
+		}
+	}
+	var countries []string
+	for country := range counts {
+		countries = append(countries, country)
+	}
+	sort.Slice(countries, func(i, j int) bool {
+		if counts[countries[i]] != counts[countries[j]] {
+			return counts[countries[i]] > counts[countries[j]]
+		}
+		return countries[i] < countries[j]
+	})
+	var expected []string
+	for _, country := range countries[:10] {
+		expected = append(expected, fmt.Sprintf(`{"country":%q,"count":%d,"name":%q}`, country, counts[country], first[country]))
+	}
+	got := runSQL(t, `SELECT country, count, name WHERE browsers CONTAINS 'MSIE' GROUP BY country ORDER BY count DESC, country LIMIT 10`,
+		SQLOptions{Format: FormatJSON})
+	if got != strings.Join(expected, "\n")+"\n" {
+		t.Errorf("Got:\n%s\nExpected:\n%s", got, strings.Join(expected, "\n"))
+	}
+
+	// grouping by browsers counts only the browsers matching WHERE
+	got = runSQL(t, `SELECT * WHERE browsers contains 'MSIE' GROUP BY browsers`, SQLOptions{Format: FormatCSV})
+	lines := strings.Split(strings.TrimSpace(got), "\n")
+	if len(lines)-1 != len(browsers) {
+		t.Errorf("Got: %d groups\nExpected: %d", len(lines)-1, len(browsers))
+	}
+	for _, line := range lines[1:] {
+		var browser string
+		var count int
+		if _, err = fmt.Sscanf(line[strings.LastIndexByte(line, ',')+1:], "%d", &count); err != nil {
+			t.Fatal(err)
+		}
+		browser = strings.Trim(line[:strings.LastIndexByte(line, ',')], `"`)
+		if browsers[browser] != count {
+			t.Errorf("%s\nGot: %d\nExpected: %d", browser, count, browsers[browser])
+		}
+	}
+}
+
+func TestStatementFormats(t *testing.T) {
+	log := `{"browsers":["A","B"],"email":"ann@example.com","name":"Ann","phone":"123-45-67","country":"Peru"}
+{"browsers":["B"],"email":"bob@example.com","name":"Bob","country":"Peru"}
+{"browsers":["C"],"email":"cid@example.com","name":"Cid","country":"Chile"}
+`
+	cases := []struct {
+		SQL      string
+		Opts     SQLOptions
+		Expected string
+	}{
+		{
+			`SELECT country, COUNT GROUP BY country ORDER BY count DESC`, SQLOptions{},
+			"COUNTRY  COUNT\nPeru     2\nChile    1\n",
+		},
+		{
+			`SELECT name, browsers, email, phone ORDER BY name DESC`, SQLOptions{Email: Mask, Phone: Drop},
+			"NAME  BROWSERS  EMAIL          PHONE\nCid   C         c***@e***.com  \nBob   B         b***@e***.com  \nAnn   A | B     a***@e***.com  \n",
+		},
+		{
+			`SELECT name, browsers WHERE browsers = 'B'`, SQLOptions{Format: FormatCSV},
+			"name,browsers\nAnn,\"A\nB\"\nBob,B\n",
+		},
+		{
+			`SELECT browsers, count, email GROUP BY browsers ORDER BY count DESC, browsers DESC LIMIT 2`, SQLOptions{Format: FormatJSON, Email: Obfuscate},
+			`{"browsers":"B","count":2,"email":"ann [at] example.com"}` + "\n" + `{"browsers":"C","count":1,"email":"cid [at] example.com"}` + "\n",
+		},
+		{
+			`SELECT name, browsers WHERE country = 'Chile'`, SQLOptions{Format: FormatJSON},
+			`{"name":"Cid","browsers":["C"]}` + "\n",
+		},
+	}
+	for _, tc := range cases {
+		st, err := ParseStatement(tc.SQL)
+		if err != nil {
+			t.Fatal(err)
+		}
+		out := new(bytes.Buffer)
+		if _, err = st.Run(out, strings.NewReader(log), tc.Opts); err != nil {
+			t.Fatal(err)
+		}
+		if out.String() != tc.Expected {
+			t.Errorf("%s\nGot:\n%s\nExpected:\n%s", tc.SQL, out.String(), tc.Expected)
+		}
+	}
+
+	st, _ := ParseStatement(`SELECT name`)
+	skipped, err := st.Run(ioutil.Discard, strings.NewReader(log+"{\n"+log), SQLOptions{Mode: Lenient})
+	if err != nil || len(skipped) != 1 || skipped[0].Line != 3 {
+		t.Errorf("Got: %v, %v\nExpected: line 3 skipped", skipped, err)
+	}
+	if _, err = st.Run(ioutil.Discard, strings.NewReader(log+"{\n"), SQLOptions{}); err == nil {
+		t.Error("expected error in strict mode")
+	}
+}
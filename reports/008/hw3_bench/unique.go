@@ -0,0 +1,140 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"math/bits"
+)
+
+// Precision limits of `HyperLogLog`.
+const (
+	MinPrecision = 4
+	MaxPrecision = 18
+)
+
+// counter counts distinct byte strings.
+type counter interface {
+	add(val []byte)
+	// merge adds the strings counted by the other counter of the same kind.
+	merge(other counter)
+	count() uint64
+}
+
+// hashSet counts distinct strings exactly.
+type hashSet map[string]struct{}
+
+func (s hashSet) add(val []byte) {
+	// the lookup by string(val) does not allocate, the copy is made only for a new string
+	if _, ok := s[string(val)]; !ok {
+		s[string(val)] = struct{}{}
+	}
+}
+
+func (s hashSet) merge(other counter) {
+	for val := range other.(hashSet) {
+		s[val] = struct{}{}
+	}
+}
+
+func (s hashSet) count() uint64 {
+	return uint64(len(s))
+}
+
+// HyperLogLog estimates the number of distinct strings in constant memory of 2^precision bytes.
+// The relative standard error of the estimate is 1.04/sqrt(2^precision).
+type HyperLogLog struct {
+	precision uint
+	registers []uint8
+}
+
+// NewHyperLogLog returns the empty estimator with the precision from `MinPrecision` to `MaxPrecision`.
+func NewHyperLogLog(precision int) (*HyperLogLog, error) {
+	if precision < MinPrecision || precision > MaxPrecision {
+		return nil, fmt.Errorf("precision must be from %d to %d, got %d", MinPrecision, MaxPrecision, precision)
+	}
+	return &HyperLogLog{precision: uint(precision), registers: make([]uint8, 1<<uint(precision))}, nil
+}
+
+// Add counts the string.
+func (h *HyperLogLog) Add(val []byte) {
+	x := hash64(val)
+	k := x >> (64 - h.precision)
+	rank := uint8(bits.LeadingZeros64(x<<h.precision|1<<(h.precision-1)) + 1)
+	if rank > h.registers[k] {
+		h.registers[k] = rank
+	}
+}
+
+// Merge adds the strings counted by the other estimator of the same precision.
+func (h *HyperLogLog) Merge(other *HyperLogLog) error {
+	if h.precision != other.precision {
+		return fmt.Errorf("can't merge precision %d into %d", other.precision, h.precision)
+	}
+	for k, rank := range other.registers {
+		if rank > h.registers[k] {
+			h.registers[k] = rank
+		}
+	}
+	return nil
+}
+
+// Count returns the estimated number of distinct strings.
+func (h *HyperLogLog) Count() uint64 {
+	m := float64(len(h.registers))
+	sum, zeros := 0.0, 0
+	for _, rank := range h.registers {
+		sum += 1 / float64(uint64(1)<<rank)
+		if rank == 0 {
+			zeros++
+		}
+	}
+	estimate := alpha(len(h.registers)) * m * m / sum
+	if estimate <= 2.5*m && zeros > 0 {
+		// linear counting by empty registers is more accurate for small cardinalities
+		estimate = m * math.Log(m/float64(zeros))
+	}
+	return uint64(estimate + 0.5)
+}
+
+func (h *HyperLogLog) add(val []byte) {
+	h.Add(val)
+}
+
+func (h *HyperLogLog) merge(other counter) {
+	if err := h.Merge(other.(*HyperLogLog)); err != nil {
+		panic(err)
+	}
+}
+
+func (h *HyperLogLog) count() uint64 {
+	return h.Count()
+}
+
+// alpha is the bias correction constant for the number of registers.
+func alpha(m int) float64 {
+	switch m {
+	case 16:
+		return 0.673
+	case 32:
+		return 0.697
+	case 64:
+		return 0.709
+	default:
+		return 0.7213 / (1 + 1.079/float64(m))
+	}
+}
+
+// hash64 is FNV-1a finished by the mixer of MurmurHash3 to spread the bits evenly.
+func hash64(val []byte) uint64 {
+	x := uint64(14695981039346656037)
+	for _, c := range val {
+		x ^= uint64(c)
+		x *= 1099511628211
+	}
+	x ^= x >> 33
+	x *= 0xff51afd7ed558ccd
+	x ^= x >> 33
+	x *= 0xc4ceb9fe1a85ec53
+	x ^= x >> 33
+	return x
+}
@@ -0,0 +1,135 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"math"
+	"regexp"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+func TestHyperLogLogError(t *testing.T) {
+	for _, precision := range []int{MinPrecision, 8, 10, 12, 14, MaxPrecision} {
+		for _, n := range []int{10, 1000, 100000} {
+			h, err := NewHyperLogLog(precision)
+			if err != nil {
+				t.Fatal(err)
+			}
+			for i := 0; i < n; i++ {
+				h.Add([]byte("browser " + strconv.Itoa(i)))
+				// repeats must not affect the estimate
+				h.Add([]byte("browser " + strconv.Itoa(i/2)))
+			}
+			// 4 standard deviations, the chance to exceed them is negligible
+			bound := 4 * 1.04 / math.Sqrt(float64(uint64(1)<<uint(precision)))
+			got := h.Count()
+			if relErr := math.Abs(float64(got)-float64(n)) / float64(n); relErr > bound {
+				t.Errorf("precision %d, %d strings\nGot: %d (error %.4f)\nExpected: error within %.4f", precision, n, got, relErr, bound)
+			}
+		}
+	}
+}
+
+func TestHyperLogLogMerge(t *testing.T) {
+	a, _ := NewHyperLogLog(14)
+	b, _ := NewHyperLogLog(14)
+	all, _ := NewHyperLogLog(14)
+	for i := 0; i < 30000; i++ {
+		val := []byte(strconv.Itoa(i))
+		if i < 20000 {
+			a.Add(val)
+		}
+		if i >= 10000 {
+			b.Add(val)
+		}
+		all.Add(val)
+	}
+	if err := a.Merge(b); err != nil {
+		t.Fatal(err)
+	}
+	if a.Count() != all.Count() {
+		t.Errorf("merged estimate\nGot: %d\nExpected: %d", a.Count(), all.Count())
+	}
+
+	c, _ := NewHyperLogLog(10)
+	if err := a.Merge(c); err == nil {
+		t.Error("expected error merging different precisions")
+	}
+	for _, precision := range []int{0, MinPrecision - 1, MaxPrecision + 1} {
+		if _, err := NewHyperLogLog(precision); err == nil {
+			t.Errorf("expected error for precision %d", precision)
+		}
+	}
+}
+
+func TestSearchApproximate(t *testing.T) {
+	total := regexp.MustCompile(`Total unique browsers (\d+)`)
+	expected := new(bytes.Buffer)
+	FastSearch(expected)
+	exact, _ := strconv.Atoi(total.FindStringSubmatch(expected.String())[1])
+
+	for _, precision := range []int{10, 14} {
+		s := *DefaultSearch
+		s.Precision = precision
+		bound := 4 * 1.04 / math.Sqrt(float64(uint64(1)<<uint(precision)))
+		for _, workers := range []int{0, 3} {
+			t.Run(fmt.Sprintf("precision=%d,workers=%d", precision, workers), func(t *testing.T) {
+				out := new(bytes.Buffer)
+				var err error
+				if workers == 0 {
+					_, err = s.Run(out, Strict)
+				} else {
+					_, err = s.RunParallel(out, ParallelOptions{Workers: workers})
+				}
+				if err != nil {
+					t.Fatal(err)
+				}
+				got, _ := strconv.Atoi(total.FindStringSubmatch(out.String())[1])
+				if math.Abs(float64(got-exact))/float64(exact) > bound {
+					t.Errorf("Got: %d\nExpected: %d within %.4f", got, exact, bound)
+				}
+				// the list of users does not depend on the precision
+				if users(out.String()) != users(expected.String()) {
+					t.Error("found users differ from the exact search")
+				}
+			})
+		}
+	}
+
+	s := *DefaultSearch
+	s.Precision = MaxPrecision + 1
+	if _, err := s.Run(ioutil.Discard, Strict); err == nil {
+		t.Error("expected error for invalid precision")
+	}
+}
+
+// users cuts the total from the search output.
+func users(out string) string {
+	return out[:strings.LastIndex(out, "\nTotal")]
+}
+
+func BenchmarkUnique(b *testing.B) {
+	browsers := make([][]byte, 10000)
+	for i := range browsers {
+		browsers[i] = []byte("Mozilla/5.0 (Windows NT 6.1) Browser/" + strconv.Itoa(i))
+	}
+	b.Run("exact", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			s := make(hashSet)
+			for _, browser := range browsers {
+				s.add(browser)
+			}
+		}
+	})
+	b.Run("hll", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			h, _ := NewHyperLogLog(14)
+			for _, browser := range browsers {
+				h.add(browser)
+			}
+		}
+	})
+}
@@ -0,0 +1,216 @@
+package main
+
+import "strings"
+
+// Device classes of user agents.
+const (
+	DeviceDesktop = "desktop"
+	DeviceMobile  = "mobile"
+	DeviceTablet  = "tablet"
+	DeviceBot     = "bot"
+	DeviceOther   = "other"
+)
+
+// Other is the browser family or the OS of an unrecognised user agent.
+const Other = "Other"
+
+// UserAgent holds the properties of a browser extracted from its user agent string.
+type UserAgent struct {
+	Family    string
+	Version   string
+	OS        string
+	OSVersion string
+	Device    string
+}
+
+// uaRule recognises a browser family by the token in the user agent, the version follows the token.
+// If `version` is set and present in the user agent, the version follows it instead.
+type uaRule struct {
+	token   string
+	family  string
+	version string
+}
+
+// familyRules are checked in order, so more specific tokens go before the generic ones:
+// many browsers mention Chrome and Safari, and Internet Explorer is mentioned as "compatible".
+var familyRules = []uaRule{
+	{token: "Edge/", family: "Edge"},
+	{token: "OPR/", family: "Opera"},
+	{token: "Opera Mini/", family: "Opera Mini"},
+	{token: "Opera/", family: "Opera", version: "Version/"},
+	{token: "Opera ", family: "Opera"},
+	{token: "IEMobile ", family: "IE Mobile"},
+	{token: "Vivaldi/", family: "Vivaldi"},
+	{token: "Maxthon/", family: "Maxthon"},
+	{token: "Maxthon ", family: "Maxthon"},
+	{token: "UBrowser/", family: "UC Browser"},
+	{token: "UCWEB/", family: "UC Browser"},
+	{token: "Puffin/", family: "Puffin"},
+	{token: "SeaMonkey/", family: "SeaMonkey"},
+	{token: "Fennec/", family: "Firefox Mobile"},
+	{token: "Konqueror/", family: "Konqueror"},
+	{token: "Midori/", family: "Midori"},
+	{token: "Arora/", family: "Arora"},
+	{token: "OmniWeb/v", family: "OmniWeb"},
+	{token: "NokiaBrowser/", family: "Nokia Browser"},
+	{token: "NetFront/", family: "NetFront"},
+	{token: "UP.Browser/", family: "Openwave"},
+	{token: "ELinks", family: "ELinks"},
+	{token: "Links (", family: "Links"},
+	{token: "CriOS/", family: "Chrome Mobile iOS"},
+	{token: "Chrome/", family: "Chrome"},
+	{token: "Firefox/", family: "Firefox"},
+	{token: "Phoenix/", family: "Firefox"},
+	{token: "MSIE ", family: "IE"},
+	{token: "Trident/", family: "IE", version: "rv:"},
+	{token: "Android", family: "Android Browser", version: "Version/"},
+	{token: "Safari/", family: "Safari", version: "Version/"},
+}
+
+// osRules recognise operating systems in the same way as `familyRules`.
+var osRules = []uaRule{
+	{token: "Windows Phone", family: "Windows Phone"},
+	{token: "Windows CE", family: "Windows CE"},
+	{token: "Windows NT ", family: "Windows"},
+	{token: "WinNT", family: "Windows"},
+	{token: "Win", family: "Windows"},
+	{token: "Android", family: "Android"},
+	{token: "iPhone OS ", family: "iOS"},
+	{token: "CPU OS ", family: "iOS"},
+	{token: "iPhone", family: "iOS"},
+	{token: "iPad", family: "iOS"},
+	{token: "iPod", family: "iOS"},
+	{token: "Mac OS X", family: "Mac OS X"},
+	{token: "Macintosh", family: "Mac OS X"},
+	{token: "Mac_PowerPC", family: "Mac OS X"},
+	{token: "CrOS", family: "Chrome OS"},
+	{token: "RIM Tablet OS ", family: "BlackBerry Tablet OS"},
+	{token: "BlackBerry", family: "BlackBerry"},
+	{token: "SymbianOS/", family: "Symbian"},
+	{token: "Symbian/", family: "Symbian"},
+	{token: "Series60/", family: "Symbian"},
+	{token: "Symbian OS", family: "Symbian"},
+	{token: "SymbOS", family: "Symbian"},
+	{token: "MeeGo", family: "MeeGo"},
+	{token: "PalmOS", family: "Palm OS"},
+	{token: "FreeBSD", family: "FreeBSD"},
+	{token: "OpenBSD", family: "OpenBSD"},
+	{token: "NetBSD", family: "NetBSD"},
+	{token: "Ubuntu", family: "Linux"},
+	{token: "Linux", family: "Linux"},
+	{token: "X11", family: "Linux"},
+	{token: "BeOS", family: "BeOS"},
+	{token: "OS/2", family: "OS/2"},
+	{token: "J2ME", family: "J2ME"},
+	{token: "MIDP", family: "J2ME"},
+}
+
+// windowsVersions maps Windows NT versions to the product names.
+var windowsVersions = map[string]string{
+	"10.0": "10",
+	"6.3":  "8.1",
+	"6.2":  "8",
+	"6.1":  "7",
+	"6.0":  "Vista",
+	"5.2":  "XP x64",
+	"5.1":  "XP",
+	"5.0":  "2000",
+	"4.0":  "NT 4.0",
+	"95":   "95",
+	"98":   "98",
+}
+
+// botTokens identify crawlers and other robots. They are matched as is rather than by a "bot" substring
+// which is also a part of other names like the one of "Cubot" phones.
+var botTokens = []string{
+	"Googlebot", "AdsBot-Google", "Mediapartners-Google", "msnbot", "bingbot", "Slurp", "DuckDuckBot",
+	"Baiduspider", "YandexBot", "Sogou web spider", "Exabot", "Facebot", "facebookexternalhit", "Twitterbot",
+	"LinkedInBot", "Applebot", "AhrefsBot", "SemrushBot", "MJ12bot", "PetalBot", "ia_archiver",
+	"Gaisbot", "Gulper Web Bot", "SuperBot/", "FAST-WebCrawler", "everyfeed-spider", "grub-client",
+}
+
+// desktopOS are the operating systems of desktop computers.
+var desktopOS = map[string]bool{
+	"Windows": true, "Mac OS X": true, "Chrome OS": true, "Linux": true,
+	"FreeBSD": true, "OpenBSD": true, "NetBSD": true, "BeOS": true, "OS/2": true,
+}
+
+// mobileOS are the operating systems of phones.
+var mobileOS = map[string]bool{
+	"iOS": true, "Android": true, "Windows Phone": true, "Windows CE": true, "BlackBerry": true,
+	"Symbian": true, "MeeGo": true, "Palm OS": true, "J2ME": true,
+}
+
+// ParseUserAgent extracts the browser family and version, the OS and the device class from the user agent.
+// Versions are cut to major and minor numbers, unknown properties are `Other` and empty versions.
+func ParseUserAgent(ua string) UserAgent {
+	res := UserAgent{Family: Other, OS: Other}
+	if isBot(ua) {
+		res.Family, res.Device = "Bot", DeviceBot
+	} else {
+		res.Family, res.Version = match(ua, familyRules)
+	}
+	res.OS, res.OSVersion = match(ua, osRules)
+	if res.OS == "Windows" {
+		res.OSVersion = windowsVersions[res.OSVersion]
+	}
+
+	switch {
+	case res.Device != "":
+	case strings.Contains(ua, "iPad") || strings.Contains(ua, "Tablet") || strings.Contains(ua, "PlayBook") ||
+		(res.OS == "Android" && !strings.Contains(ua, "Mobile")):
+		res.Device = DeviceTablet
+	case strings.Contains(ua, "Mobi") || strings.Contains(ua, "Mini/") || strings.Contains(ua, "MMP/") || mobileOS[res.OS]:
+		res.Device = DeviceMobile
+	case desktopOS[res.OS]:
+		res.Device = DeviceDesktop
+	default:
+		res.Device = DeviceOther
+	}
+	return res
+}
+
+// isBot reports whether the user agent contains one of `botTokens`.
+func isBot(ua string) bool {
+	for _, token := range botTokens {
+		if strings.Contains(ua, token) {
+			return true
+		}
+	}
+	return false
+}
+
+// match returns the family and the version of the first matching rule or `Other`.
+func match(ua string, rules []uaRule) (string, string) {
+	for _, rule := range rules {
+		i := strings.Index(ua, rule.token)
+		if i < 0 {
+			continue
+		}
+		rest := ua[i+len(rule.token):]
+		if j := strings.Index(ua, rule.version); rule.version != "" && j >= 0 {
+			rest = ua[j+len(rule.version):]
+		}
+		return rule.family, version(rest)
+	}
+	return Other, ""
+}
+
+// version returns up to two leading dot-separated numbers of the string, underscores are treated as dots.
+func version(s string) string {
+	s = strings.TrimLeft(s, " /")
+	end, dots := 0, 0
+	for end < len(s) {
+		c := s[end]
+		if c == '.' || c == '_' {
+			if dots == 1 || end+1 == len(s) || s[end+1] < '0' || s[end+1] > '9' {
+				break
+			}
+			dots++
+		} else if c < '0' || c > '9' {
+			break
+		}
+		end++
+	}
+	return strings.Replace(s[:end], "_", ".", -1)
+}
@@ -0,0 +1,84 @@
+package main
+
+import "testing"
+
+func TestParseUserAgent(t *testing.T) {
+	cases := []struct {
+		UA       string
+		Expected UserAgent
+	}{
+		{
+			UA:       "Mozilla/5.0 (X11; Linux x86_64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/41.0.2227.0 Safari/537.36",
+			Expected: UserAgent{Family: "Chrome", Version: "41.0", OS: "Linux", Device: DeviceDesktop},
+		},
+		{
+			UA:       "Mozilla/4.0 (compatible; MSIE 7.0; Windows NT 6.0; Trident/5.0)",
+			Expected: UserAgent{Family: "IE", Version: "7.0", OS: "Windows", OSVersion: "Vista", Device: DeviceDesktop},
+		},
+		{
+			UA:       "Mozilla/5.0 (Windows NT 6.2; ARM; Trident/7.0; Touch; rv:11.0; WPDesktop; NOKIA; Lumia 920) like Geckoo",
+			Expected: UserAgent{Family: "IE", Version: "11.0", OS: "Windows", OSVersion: "8", Device: DeviceDesktop},
+		},
+		{
+			UA:       "Mozilla/5.0 (Linux; U; Android 1.5; en-gb; T-Mobile_G2_Touch Build/CUPCAKE) AppleWebKit/528.5  (KHTML, like Gecko) Version/3.1.2 Mobile Safari/525.20.1",
+			Expected: UserAgent{Family: "Android Browser", Version: "3.1", OS: "Android", OSVersion: "1.5", Device: DeviceMobile},
+		},
+		{
+			UA:       "Mozilla/5.0 (Linux; Android 4.4.2; LG-V410 Build/KOT49I.V41010d) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/30.0.1599.103 Safari/537.36",
+			Expected: UserAgent{Family: "Chrome", Version: "30.0", OS: "Android", OSVersion: "4.4", Device: DeviceTablet},
+		},
+		{
+			UA:       "Mozilla/5.0 (iPad; U; CPU OS 4_3 like Mac OS X; en-us) AppleWebKit/533.17.9 (KHTML, like Gecko) Version/5.0.2 Mobile/8F190 Safari/6533.18.5",
+			Expected: UserAgent{Family: "Safari", Version: "5.0", OS: "iOS", OSVersion: "4.3", Device: DeviceTablet},
+		},
+		{
+			UA:       "Mozilla/5.0 (iPhone; CPU iPhone OS 7_1_2 like Mac OS X) AppleWebKit/537.51.2 (KHTML like Gecko) Version/7.0 Mobile/11D257 Safari/9537.53",
+			Expected: UserAgent{Family: "Safari", Version: "7.0", OS: "iOS", OSVersion: "7.1", Device: DeviceMobile},
+		},
+		{
+			UA:       "Mozilla/5.0 (Macintosh; Intel Mac OS X 10_10_3) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/41.0.2272.105 Safari/537.36 Vivaldi/1.0.162.9",
+			Expected: UserAgent{Family: "Vivaldi", Version: "1.0", OS: "Mac OS X", OSVersion: "10.10", Device: DeviceDesktop},
+		},
+		{
+			UA:       "Opera/9.80 (J2ME/MIDP; Opera Mini/8.0.35626/37.8918; U; en) Presto/2.12.423 Version/12.16",
+			Expected: UserAgent{Family: "Opera Mini", Version: "8.0", OS: "J2ME", Device: DeviceMobile},
+		},
+		{
+			UA:       "Opera/9.80 (X11; Linux i686) Presto/2.12.388 Version/12.16",
+			Expected: UserAgent{Family: "Opera", Version: "12.16", OS: "Linux", Device: DeviceDesktop},
+		},
+		{
+			UA:       "Mozilla/5.0 (Windows Phone 10.0; Android 4.2.1; DEVICE INFO) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/39.0.2171.71 Mobile Safari/537.36 Edge/12.0",
+			Expected: UserAgent{Family: "Edge", Version: "12.0", OS: "Windows Phone", OSVersion: "10.0", Device: DeviceMobile},
+		},
+		{
+			UA:       "Mozilla/5.0 (compatible; Googlebot/2.1;  http://www.google.com/bot.html)",
+			Expected: UserAgent{Family: "Bot", OS: Other, Device: DeviceBot},
+		},
+		{
+			UA:       "Mozilla/5.0 (compatible; bingbot/2.0  http://www.bing.com/bingbot.htm)",
+			Expected: UserAgent{Family: "Bot", OS: Other, Device: DeviceBot},
+		},
+		{
+			UA:       "Mozilla/5.0 (Linux; Android 9; CUBOT_X19) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/74.0.3729.136 Mobile Safari/537.36",
+			Expected: UserAgent{Family: "Chrome", Version: "74.0", OS: "Android", OSVersion: "9", Device: DeviceMobile},
+		},
+		{
+			UA:       "WebZIP/3.5 (http://www.spidersoft.com)",
+			Expected: UserAgent{Family: Other, OS: Other, Device: DeviceOther},
+		},
+		{
+			UA:       "Mozilla/3.01Gold (Win95; I)",
+			Expected: UserAgent{Family: Other, OS: "Windows", OSVersion: "95", Device: DeviceDesktop},
+		},
+		{
+			UA:       "Web Downloader/6.9",
+			Expected: UserAgent{Family: Other, OS: Other, Device: DeviceOther},
+		},
+	}
+	for _, tc := range cases {
+		if got := ParseUserAgent(tc.UA); got != tc.Expected {
+			t.Errorf("%s\nGot: %+v\nExpected: %+v", tc.UA, got, tc.Expected)
+		}
+	}
+}
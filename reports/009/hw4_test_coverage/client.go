@@ -1,6 +1,7 @@
 package main
 
 import (
+	"context"
 	"encoding/json"
 	"errors"
 	"fmt"
@@ -19,9 +20,11 @@ const (
 
 var (
 	errTest = errors.New("testing")
-	client  = &http.Client{Timeout: time.Second}
 )
 
+// DefaultTimeout ограничивает время запроса, если у `SearchClient` не задан `Timeout`
+const DefaultTimeout = time.Second
+
 type User struct {
 	Id     int
 	Name   string
@@ -52,7 +55,7 @@ type SearchRequest struct {
 	Offset     int    // Можно учесть после сортировки
 	Query      string // подстрока в 1 из полей
 	OrderField string
-	// -1 по убыванию, 0 как встретилось, 1 по возрастанию
+	// -1 по возрастанию (`OrderByAsc`), 0 как встретилось, 1 по убыванию (`OrderByDesc`)
 	OrderBy int
 }
 
@@ -61,21 +64,59 @@ type SearchClient struct {
 	AccessToken string
 	// урл внешней системы, куда идти
 	URL string
+	// HTTPClient отправляет запросы, если не задан - используется клиент с транспортом `Transport`
+	HTTPClient *http.Client
+	// Transport используется клиентом по умолчанию, если не задан - `http.DefaultTransport`
+	Transport http.RoundTripper
+	// Timeout ограничивает время каждого запроса, по умолчанию `DefaultTimeout`, отрицательный - без ограничения
+	Timeout time.Duration
+	// Header добавляется к каждому запросу, AccessToken задаётся отдельно и имеет приоритет
+	Header http.Header
+	// Retry задаёт повтор запросов после временных ошибок, если не задан - запрос не повторяется
+	Retry *RetryPolicy
+	// Breaker прекращает запросы после череды ошибок, может быть общим для нескольких клиентов
+	Breaker *CircuitBreaker
 }
 
 // FindUsers отправляет запрос во внешнюю систему, которая непосредственно ищет пользоваталей
+// Ошибки различаются через `errors.Is` и `errors.As`, см. `ErrUnauthorized`, `*OrderFieldError`, `*TimeoutError`, `*ServerError`, `*DecodeError`
 func (srv *SearchClient) FindUsers(req SearchRequest) (*SearchResponse, error) {
+	return srv.FindUsersContext(context.Background(), req)
+}
+
+// httpClient возвращает клиент для отправки запросов
+func (srv *SearchClient) httpClient() *http.Client {
+	if srv.HTTPClient != nil {
+		return srv.HTTPClient
+	}
+	return &http.Client{Transport: srv.Transport}
+}
+
+// requestError приводит ошибку отправки запроса или чтения ответа к ошибке клиента
+func requestError(ctx context.Context, err error, params url.Values) error {
+	// отмена или истечение контекста вызывающего - не таймаут поиска
+	if ctx.Err() != nil {
+		return ctx.Err()
+	}
+	if netErr, ok := err.(net.Error); ok && netErr.Timeout() {
+		return &TimeoutError{Params: params.Encode(), Err: err}
+	}
+	return &transportError{err}
+}
+
+// FindUsersContext как `FindUsers`, но запрос отменяется вместе с контекстом
+func (srv *SearchClient) FindUsersContext(ctx context.Context, req SearchRequest) (*SearchResponse, error) {
 
 	searcherParams := url.Values{}
 
 	if req.Limit < 0 {
-		return nil, fmt.Errorf("limit must be > 0")
+		return nil, ErrInvalidLimit
 	}
 	if req.Limit > 25 {
 		req.Limit = 25
 	}
 	if req.Offset < 0 {
-		return nil, fmt.Errorf("offset must be > 0")
+		return nil, ErrInvalidOffset
 	}
 
 	//нужно для получения следующей записи, на основе которой мы скажем - можно показать переключатель следующей страницы или нет
@@ -88,39 +129,86 @@ func (srv *SearchClient) FindUsers(req SearchRequest) (*SearchResponse, error) {
 	searcherParams.Add("order_by", strconv.Itoa(req.OrderBy))
 
 	searcherReq, err := http.NewRequest("GET", srv.URL+"?"+searcherParams.Encode(), nil)
-	searcherReq.Header.Add("AccessToken", srv.AccessToken)
-
-	resp, err := client.Do(searcherReq)
 	if err != nil {
-		if err, ok := err.(net.Error); ok && err.Timeout() {
-			return nil, fmt.Errorf("timeout for %s", searcherParams.Encode())
+		return nil, fmt.Errorf("cant create request: %w", err)
+	}
+	for key, values := range srv.Header {
+		for _, value := range values {
+			searcherReq.Header.Add(key, value)
+		}
+	}
+	searcherReq.Header.Set("AccessToken", srv.AccessToken)
+
+	// запрос на поиск идемпотентный, поэтому его можно безопасно повторять
+	for attempt := 1; ; attempt++ {
+		probe, err := srv.Breaker.allow()
+		if err != nil {
+			return nil, err
+		}
+		result, err := srv.send(ctx, searcherReq, req, searcherParams)
+		srv.Breaker.record(ctx, probe, err)
+		if err == nil {
+			return result, nil
+		}
+		delay, ok := srv.Retry.backoff(attempt, err)
+		if !ok || ctx.Err() != nil {
+			return nil, err
 		}
-		return nil, fmt.Errorf("unknown error %s", err)
+		timer := time.NewTimer(delay)
+		select {
+		case <-timer.C:
+		case <-ctx.Done():
+			timer.Stop()
+			return nil, ctx.Err()
+		}
+	}
+}
+
+// send выполняет одну попытку запроса с таймаутом клиента
+func (srv *SearchClient) send(ctx context.Context, searcherReq *http.Request, req SearchRequest, searcherParams url.Values) (*SearchResponse, error) {
+	timeout := srv.Timeout
+	if timeout == 0 {
+		timeout = DefaultTimeout
+	}
+	reqCtx := ctx
+	if timeout > 0 {
+		var cancel context.CancelFunc
+		reqCtx, cancel = context.WithTimeout(ctx, timeout)
+		defer cancel()
+	}
+
+	resp, err := srv.httpClient().Do(searcherReq.WithContext(reqCtx))
+	if err != nil {
+		return nil, requestError(ctx, err, searcherParams)
 	}
 	defer resp.Body.Close()
 	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return nil, requestError(ctx, err, searcherParams)
+	}
 
 	switch resp.StatusCode {
+	case http.StatusOK:
 	case http.StatusUnauthorized:
-		return nil, fmt.Errorf("Bad AccessToken")
-	case http.StatusInternalServerError:
-		return nil, fmt.Errorf("SearchServer fatal error")
+		return nil, ErrUnauthorized
 	case http.StatusBadRequest:
 		errResp := SearchErrorResponse{}
 		err = json.Unmarshal(body, &errResp)
 		if err != nil {
-			return nil, fmt.Errorf("cant unpack error json: %s", err)
+			return nil, &DecodeError{What: "error", StatusCode: resp.StatusCode, Body: string(body), Err: err}
 		}
-		if errResp.Error == "ErrorBadOrderField" {
-			return nil, fmt.Errorf("OrderFeld %s invalid", req.OrderField)
+		if errResp.Error == errorBadOrderField {
+			return nil, &OrderFieldError{Field: req.OrderField}
 		}
-		return nil, fmt.Errorf("unknown bad request error: %s", errResp.Error)
+		return nil, &ServerError{StatusCode: resp.StatusCode, Body: string(body)}
+	default:
+		return nil, &ServerError{StatusCode: resp.StatusCode, Body: string(body), RetryAfter: retryAfter(resp.Header)}
 	}
 
 	data := []User{}
 	err = json.Unmarshal(body, &data)
 	if err != nil {
-		return nil, fmt.Errorf("cant unpack result json: %s", err)
+		return nil, &DecodeError{What: "result", StatusCode: resp.StatusCode, Body: string(body), Err: err}
 	}
 
 	result := SearchResponse{}
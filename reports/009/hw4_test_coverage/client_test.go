@@ -1,21 +1,30 @@
 package main
 
 import (
+	"context"
 	"encoding/json"
+	"errors"
+	"io/ioutil"
 	"net/http"
 	"net/http/httptest"
+	"net/url"
 	"strconv"
+	"strings"
 	"testing"
 	"time"
 )
 
-// SearchServer implements fake external service.
-func SearchServer(w http.ResponseWriter, r *http.Request) {
+// fakeSearchServer implements fake external service.
+func fakeSearchServer(w http.ResponseWriter, r *http.Request) {
 	defer r.Body.Close()
 	accessToken := r.Header.Get("AccessToken")
 	switch accessToken {
 	case "Timeout":
-		time.Sleep(5 * time.Second)
+		// клиент отключается по таймауту раньше, тогда ждать дальше незачем
+		select {
+		case <-time.After(5 * time.Second):
+		case <-r.Context().Done():
+		}
 		return
 	case "InternalServerError":
 		w.WriteHeader(http.StatusInternalServerError)
@@ -34,6 +43,9 @@ func SearchServer(w http.ResponseWriter, r *http.Request) {
 		res, _ := json.Marshal(&SearchErrorResponse{"ErrorBadOrderField"})
 		w.Write(res)
 		return
+	case "NotFound":
+		http.NotFound(w, r)
+		return
 	case "InvalidUser":
 		w.Write([]byte(`{,,",`))
 		return
@@ -57,7 +69,7 @@ func SearchServer(w http.ResponseWriter, r *http.Request) {
 
 // TestFindUsers runs the tests for FindUsers function of SearchClient struct.
 func TestFindUsers(t *testing.T) {
-	ts := httptest.NewServer(http.HandlerFunc(SearchServer))
+	ts := httptest.NewServer(http.HandlerFunc(fakeSearchServer))
 	cases := []struct {
 		Name        string
 		AccessToken string
@@ -65,6 +77,8 @@ func TestFindUsers(t *testing.T) {
 		Request     SearchRequest
 		Response    *SearchResponse
 		IsError     bool
+		// Is - ожидаемая ошибка для errors.Is
+		Is error
 	}{
 		{
 			Name: "limit must be > 0",
@@ -74,6 +88,7 @@ func TestFindUsers(t *testing.T) {
 			},
 			Response: nil,
 			IsError:  true,
+			Is:       ErrInvalidLimit,
 		},
 		{
 			Name: "offset must be > 0",
@@ -83,6 +98,7 @@ func TestFindUsers(t *testing.T) {
 			},
 			Response: nil,
 			IsError:  true,
+			Is:       ErrInvalidOffset,
 		},
 		{
 			Name:     "empty",
@@ -95,6 +111,7 @@ func TestFindUsers(t *testing.T) {
 			URL:         ts.URL,
 			Response:    nil,
 			IsError:     true,
+			Is:          ErrUnauthorized,
 		},
 		{
 			Name:        "internal server error",
@@ -123,6 +140,7 @@ func TestFindUsers(t *testing.T) {
 			URL:         ts.URL,
 			Response:    nil,
 			IsError:     true,
+			Is:          ErrBadOrderField,
 		},
 		{
 			Name:        "invalid user",
@@ -163,6 +181,7 @@ func TestFindUsers(t *testing.T) {
 			URL:         ts.URL,
 			Response:    nil,
 			IsError:     true,
+			Is:          ErrTimeout,
 		},
 	}
 	for _, tc := range cases {
@@ -178,6 +197,9 @@ func TestFindUsers(t *testing.T) {
 			if err == nil && tc.IsError {
 				t.Errorf("Error expected but not occured\n")
 			}
+			if tc.Is != nil && !errors.Is(err, tc.Is) {
+				t.Errorf("Expected:\n%v\nGot:\n%v\n", tc.Is, err)
+			}
 			tcJson, _ := json.Marshal(tc.Response)
 			resJson, _ := json.Marshal(res)
 			tcStr, resStr := string(tcJson), string(resJson)
@@ -188,3 +210,219 @@ func TestFindUsers(t *testing.T) {
 	}
 	ts.Close()
 }
+
+// roundTripFunc позволяет подменить транспорт функцией.
+type roundTripFunc func(r *http.Request) (*http.Response, error)
+
+func (f roundTripFunc) RoundTrip(r *http.Request) (*http.Response, error) {
+	return f(r)
+}
+
+// TestFindUsersContext checks that the search is canceled with the context of the caller.
+func TestFindUsersContext(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(fakeSearchServer))
+	defer ts.Close()
+	c := &SearchClient{URL: ts.URL, AccessToken: "Timeout", Timeout: -1}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	_, err := c.FindUsersContext(ctx, SearchRequest{})
+	if err != context.DeadlineExceeded {
+		t.Errorf("Expected:\n%v\nGot:\n%v\n", context.DeadlineExceeded, err)
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("search was not canceled in %s", elapsed)
+	}
+
+	ctx, cancel = context.WithCancel(context.Background())
+	cancel()
+	if _, err = c.FindUsersContext(ctx, SearchRequest{}); err != context.Canceled {
+		t.Errorf("Expected:\n%v\nGot:\n%v\n", context.Canceled, err)
+	}
+}
+
+// TestSearchClientTimeout checks the timeout configured on the client.
+func TestSearchClientTimeout(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(fakeSearchServer))
+	defer ts.Close()
+	c := &SearchClient{URL: ts.URL, AccessToken: "Timeout", Timeout: 50 * time.Millisecond}
+	start := time.Now()
+	_, err := c.FindUsers(SearchRequest{})
+	var timeoutErr *TimeoutError
+	if !errors.As(err, &timeoutErr) || timeoutErr.Params != "limit=1&offset=0&order_by=0&order_field=&query=" || !strings.HasPrefix(err.Error(), "timeout for ") {
+		t.Errorf("Expected:\n*TimeoutError\nGot:\n%#v\n", err)
+	}
+	if elapsed := time.Since(start); elapsed > time.Second/2 {
+		t.Errorf("timeout took %s", elapsed)
+	}
+}
+
+// TestSearchClientTransport checks the injected transport and headers.
+func TestSearchClientTransport(t *testing.T) {
+	var got *http.Request
+	transport := roundTripFunc(func(r *http.Request) (*http.Response, error) {
+		got = r
+		return &http.Response{
+			StatusCode: http.StatusOK,
+			Body:       ioutil.NopCloser(strings.NewReader(`[{"Id":1}]`)),
+		}, nil
+	})
+	header := http.Header{"X-Request-Id": {"42"}, "Accesstoken": {"overridden"}}
+	for _, c := range []*SearchClient{
+		{URL: "http://search/users", AccessToken: "ValidToken", Transport: transport, Header: header},
+		{URL: "http://search/users", AccessToken: "ValidToken", HTTPClient: &http.Client{Transport: transport}, Header: header},
+	} {
+		res, err := c.FindUsers(SearchRequest{Limit: 1, Query: "a b"})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(res.Users) != 1 || res.Users[0].Id != 1 || res.NextPage {
+			t.Errorf("Got:\n%+v\n", res)
+		}
+		if got.Header.Get("X-Request-Id") != "42" || got.Header.Get("AccessToken") != "ValidToken" {
+			t.Errorf("Got headers:\n%v\n", got.Header)
+		}
+		if expected := "limit=2&offset=0&order_by=0&order_field=&query=a+b"; got.URL.RawQuery != expected {
+			t.Errorf("Expected:\n%s\nGot:\n%s\n", expected, got.URL.RawQuery)
+		}
+	}
+}
+
+// TestFindUsersBadURL checks the URL which can't be parsed.
+func TestFindUsersBadURL(t *testing.T) {
+	c := &SearchClient{URL: "http://search/%zz"}
+	_, err := c.FindUsers(SearchRequest{})
+	var urlErr *url.Error
+	if err == nil || !strings.HasPrefix(err.Error(), "cant create request: ") || !errors.As(err, &urlErr) {
+		t.Errorf("Expected:\ncant create request\nGot:\n%v\n", err)
+	}
+}
+
+// TestFindUsersErrors checks the types and details of the errors returned by the client.
+func TestFindUsersErrors(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(fakeSearchServer))
+	defer ts.Close()
+	cases := []struct {
+		AccessToken string
+		Check       func(t *testing.T, err error)
+	}{
+		{
+			AccessToken: "InternalServerError",
+			Check: func(t *testing.T, err error) {
+				var serverErr *ServerError
+				if !errors.As(err, &serverErr) || serverErr.StatusCode != http.StatusInternalServerError {
+					t.Errorf("Expected:\n*ServerError 500\nGot:\n%#v\n", err)
+				}
+			},
+		},
+		{
+			AccessToken: "StatusBadRequest1",
+			Check: func(t *testing.T, err error) {
+				var serverErr *ServerError
+				if !errors.As(err, &serverErr) || serverErr.StatusCode != http.StatusBadRequest || serverErr.Body != `{"Error":"..."}` {
+					t.Errorf("Expected:\n*ServerError 400\nGot:\n%#v\n", err)
+				}
+				if expected := `SearchServer error: 400 Bad Request: {"Error":"..."}`; err.Error() != expected {
+					t.Errorf("Expected:\n%s\nGot:\n%v\n", expected, err)
+				}
+			},
+		},
+		{
+			AccessToken: "NotFound",
+			Check: func(t *testing.T, err error) {
+				var serverErr *ServerError
+				if !errors.As(err, &serverErr) || serverErr.StatusCode != http.StatusNotFound {
+					t.Errorf("Expected:\n*ServerError 404\nGot:\n%#v\n", err)
+				}
+			},
+		},
+		{
+			AccessToken: "StatusBadRequest2",
+			Check: func(t *testing.T, err error) {
+				var decodeErr *DecodeError
+				var syntaxErr *json.SyntaxError
+				if !errors.As(err, &decodeErr) || decodeErr.What != "error" || !errors.As(err, &syntaxErr) {
+					t.Errorf("Expected:\n*DecodeError of error\nGot:\n%#v\n", err)
+				}
+			},
+		},
+		{
+			AccessToken: "StatusBadRequest3",
+			Check: func(t *testing.T, err error) {
+				var orderErr *OrderFieldError
+				if !errors.As(err, &orderErr) || orderErr.Field != "Weight" {
+					t.Errorf("Expected:\n*OrderFieldError\nGot:\n%#v\n", err)
+				}
+				if expected := "OrderField Weight invalid"; err.Error() != expected {
+					t.Errorf("Expected:\n%s\nGot:\n%v\n", expected, err)
+				}
+			},
+		},
+		{
+			AccessToken: "InvalidUser",
+			Check: func(t *testing.T, err error) {
+				var decodeErr *DecodeError
+				if !errors.As(err, &decodeErr) || decodeErr.What != "result" || decodeErr.StatusCode != http.StatusOK {
+					t.Errorf("Expected:\n*DecodeError of result\nGot:\n%#v\n", err)
+				}
+				if !strings.HasPrefix(err.Error(), "cant unpack result json: ") {
+					t.Errorf("Expected:\ncant unpack result json\nGot:\n%v\n", err)
+				}
+			},
+		},
+		{
+			AccessToken: "_____",
+			Check: func(t *testing.T, err error) {
+				if err != ErrUnauthorized {
+					t.Errorf("Expected:\n%v\nGot:\n%v\n", ErrUnauthorized, err)
+				}
+			},
+		},
+	}
+	for _, tc := range cases {
+		t.Run(tc.AccessToken, func(t *testing.T) {
+			c := &SearchClient{URL: ts.URL, AccessToken: tc.AccessToken}
+			res, err := c.FindUsers(SearchRequest{OrderField: "Weight"})
+			if res != nil {
+				t.Errorf("Got:\n%+v\n", res)
+			}
+			tc.Check(t, err)
+		})
+	}
+}
+
+// failingReader fails every read.
+type failingReader struct {
+	err error
+}
+
+func (r failingReader) Read(p []byte) (int, error) {
+	return 0, r.err
+}
+
+// TestFindUsersTransportErrors checks the errors of the transport and of reading the response.
+func TestFindUsersTransportErrors(t *testing.T) {
+	c := &SearchClient{URL: "http://search/users", Transport: roundTripFunc(func(r *http.Request) (*http.Response, error) {
+		return nil, errTest
+	})}
+	if _, err := c.FindUsers(SearchRequest{}); !errors.Is(err, errTest) || !strings.HasPrefix(err.Error(), "unknown error ") {
+		t.Errorf("Expected:\n%v\nGot:\n%v\n", errTest, err)
+	}
+
+	c.Transport = roundTripFunc(func(r *http.Request) (*http.Response, error) {
+		return &http.Response{StatusCode: http.StatusOK, Body: ioutil.NopCloser(failingReader{errTest})}, nil
+	})
+	if _, err := c.FindUsers(SearchRequest{}); !errors.Is(err, errTest) {
+		t.Errorf("Expected:\n%v\nGot:\n%v\n", errTest, err)
+	}
+
+	c.Transport = roundTripFunc(func(r *http.Request) (*http.Response, error) {
+		return &http.Response{StatusCode: http.StatusOK, Body: ioutil.NopCloser(failingReader{context.DeadlineExceeded})}, nil
+	})
+	_, err := c.FindUsers(SearchRequest{})
+	var timeoutErr *TimeoutError
+	if !errors.As(err, &timeoutErr) || !errors.Is(err, ErrTimeout) || !errors.Is(err, context.DeadlineExceeded) || !timeoutErr.Timeout() {
+		t.Errorf("Expected:\n*TimeoutError\nGot:\n%#v\n", err)
+	}
+}
@@ -0,0 +1,113 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+)
+
+var (
+	// ErrInvalidLimit - отрицательный `Limit`, запрос не отправляется
+	ErrInvalidLimit = errors.New("limit must be > 0")
+	// ErrInvalidOffset - отрицательный `Offset`, запрос не отправляется
+	ErrInvalidOffset = errors.New("offset must be > 0")
+	// ErrUnauthorized - внешняя система не приняла AccessToken
+	ErrUnauthorized = errors.New("Bad AccessToken")
+	// ErrBadOrderField - внешняя система не умеет сортировать по полю, подробности в `*OrderFieldError`
+	ErrBadOrderField = errors.New("bad order field")
+	// ErrTimeout - запрос не уложился в таймаут, подробности в `*TimeoutError`
+	ErrTimeout = errors.New("timeout")
+	// ErrCircuitOpen - `CircuitBreaker` не пропускает запросы после череды ошибок
+	ErrCircuitOpen = errors.New("circuit breaker is open")
+	// ErrDatasetChanged - данные изменились между страницами при обходе `UserIterator`
+	ErrDatasetChanged = errors.New("dataset changed between pages")
+)
+
+// OrderFieldError - внешняя система не умеет сортировать по полю `Field`
+type OrderFieldError struct {
+	Field string
+}
+
+func (e *OrderFieldError) Error() string {
+	return fmt.Sprintf("OrderField %s invalid", e.Field)
+}
+
+// Is позволяет проверять ошибку через `errors.Is(err, ErrBadOrderField)`
+func (e *OrderFieldError) Is(target error) bool {
+	return target == ErrBadOrderField
+}
+
+// TimeoutError - запрос с параметрами `Params` не уложился в таймаут клиента
+type TimeoutError struct {
+	Params string
+	// Err - исходная ошибка транспорта
+	Err error
+}
+
+func (e *TimeoutError) Error() string {
+	return "timeout for " + e.Params
+}
+
+func (e *TimeoutError) Unwrap() error {
+	return e.Err
+}
+
+// Is позволяет проверять ошибку через `errors.Is(err, ErrTimeout)`
+func (e *TimeoutError) Is(target error) bool {
+	return target == ErrTimeout
+}
+
+// Timeout делает ошибку похожей на `net.Error`
+func (e *TimeoutError) Timeout() bool {
+	return true
+}
+
+// ServerError - внешняя система ответила статусом, который клиент не умеет обработать
+type ServerError struct {
+	StatusCode int
+	// Body - тело ответа как есть
+	Body string
+	// RetryAfter - задержка из хедера Retry-After, 0 если не задана
+	RetryAfter time.Duration
+}
+
+func (e *ServerError) Error() string {
+	msg := fmt.Sprintf("SearchServer error: %d %s", e.StatusCode, http.StatusText(e.StatusCode))
+	if body := strings.TrimSpace(e.Body); body != "" {
+		msg += ": " + body
+	}
+	return msg
+}
+
+// DecodeError - не удалось разобрать JSON ответа
+type DecodeError struct {
+	// What - что разбиралось: "error" для `SearchErrorResponse`, "result" для списка пользователей
+	What       string
+	StatusCode int
+	Body       string
+	// Err - ошибка `encoding/json`
+	Err error
+}
+
+func (e *DecodeError) Error() string {
+	return fmt.Sprintf("cant unpack %s json: %s", e.What, e.Err)
+}
+
+func (e *DecodeError) Unwrap() error {
+	return e.Err
+}
+
+// transportError - запрос не удалось отправить или прочитать ответ
+type transportError struct {
+	err error
+}
+
+func (e *transportError) Error() string {
+	return "unknown error " + e.err.Error()
+}
+
+func (e *transportError) Unwrap() error {
+	return e.err
+}
@@ -1,3 +1,3 @@
 module github.com/vadimpiven/vpn-from-scratch/reports/009/hw4_test_coverage
 
-go 1.12
+go 1.13
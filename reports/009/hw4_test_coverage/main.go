@@ -0,0 +1,41 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"log"
+	"net/http"
+	"strings"
+)
+
+// newServer загружает набор данных и создаёт `SearchServer` с токенами через запятую
+func newServer(dataset, tokens string) (*SearchServer, error) {
+	var accepted []string
+	for _, token := range strings.Split(tokens, ",") {
+		if token = strings.TrimSpace(token); token != "" {
+			accepted = append(accepted, token)
+		}
+	}
+	if len(accepted) == 0 {
+		return nil, errors.New("no access tokens")
+	}
+	users, err := LoadDataset(dataset)
+	if err != nil {
+		return nil, err
+	}
+	return NewSearchServer(users, accepted...), nil
+}
+
+func main() {
+	addr := flag.String("addr", ":8080", "address to listen on")
+	dataset := flag.String("dataset", "dataset.xml", "users dataset in XML")
+	tokens := flag.String("tokens", "", "comma separated access tokens")
+	flag.Parse()
+
+	srv, err := newServer(*dataset, *tokens)
+	if err != nil {
+		log.Fatal(err)
+	}
+	log.Printf("serving %s on %s", *dataset, *addr)
+	log.Fatal(http.ListenAndServe(*addr, srv))
+}
@@ -0,0 +1,186 @@
+package main
+
+import (
+	"context"
+)
+
+// maxPageSize - больше пользователей за один запрос `FindUsers` не возвращает
+const maxPageSize = 25
+
+// PageOptions настраивает постраничный обход результатов поиска
+type PageOptions struct {
+	// Max ограничивает общее число пользователей, 0 - без ограничения
+	Max int
+	// Prefetch запрашивает следующую страницу, пока вызывающий обрабатывает текущую
+	Prefetch bool
+	// AllowChanges продолжает обход, если данные изменились между страницами:
+	// повторы по `Id` отбрасываются, но удалённые перед текущей позицией записи сдвигают остальные и часть из них пропускается.
+	// По умолчанию обход завершается ошибкой `ErrDatasetChanged`
+	AllowChanges bool
+}
+
+// UserIterator обходит результаты поиска постранично, запрашивая страницы по мере надобности.
+//
+// Каждая страница, кроме первой, начинается с последнего пользователя предыдущей.
+// Если он не совпал, значит перед ним записи добавились или удалились и смещения страниц уже не верны.
+type UserIterator struct {
+	srv    *SearchClient
+	ctx    context.Context
+	cancel context.CancelFunc
+	req    SearchRequest
+	opts   PageOptions
+
+	// pageSize - сколько новых пользователей запрашивать за раз
+	pageSize int
+	page     []User
+	user     User
+	count    int
+	// offset - смещение первой ещё не полученной записи
+	offset  int
+	last    User
+	hasLast bool
+	seen    map[int]bool
+	done    bool
+	err     error
+	pending chan pageResult
+}
+
+// pageResult - ответ на запрос страницы со смещением `offset`
+type pageResult struct {
+	offset int
+	res    *SearchResponse
+	err    error
+}
+
+// Iterate возвращает итератор по всем результатам поиска начиная с `req.Offset`.
+// `req.Limit` задаёт размер страницы, 0 - наибольший. Итератор нужно закрыть методом `Close`.
+func (srv *SearchClient) Iterate(ctx context.Context, req SearchRequest, opts PageOptions) *UserIterator {
+	it := &UserIterator{srv: srv, req: req, opts: opts, offset: req.Offset, pageSize: req.Limit}
+	it.ctx, it.cancel = context.WithCancel(ctx)
+	if it.pageSize == 0 || it.pageSize > maxPageSize {
+		it.pageSize = maxPageSize
+	}
+	if opts.AllowChanges {
+		it.seen = make(map[int]bool)
+	}
+	return it
+}
+
+// FindAll возвращает всех пользователей, найденных по запросу, см. `Iterate`
+func (srv *SearchClient) FindAll(ctx context.Context, req SearchRequest, opts PageOptions) ([]User, error) {
+	it := srv.Iterate(ctx, req, opts)
+	defer it.Close()
+	users := []User{}
+	for it.Next() {
+		users = append(users, it.User())
+	}
+	return users, it.Err()
+}
+
+// Next переходит к следующему пользователю, false - если их больше нет или произошла ошибка
+func (it *UserIterator) Next() bool {
+	for it.err == nil && (it.opts.Max <= 0 || it.count < it.opts.Max) {
+		if len(it.page) > 0 {
+			it.user, it.page = it.page[0], it.page[1:]
+			it.count++
+			return true
+		}
+		if !it.more() {
+			return false
+		}
+		if it.pending == nil {
+			it.pending = it.fetch()
+		}
+		result := <-it.pending
+		it.pending = nil
+		if result.err != nil {
+			it.err = result.err
+			return false
+		}
+		it.accept(result)
+		if it.opts.Prefetch && it.more() {
+			it.pending = it.fetch()
+		}
+	}
+	return false
+}
+
+// User возвращает текущего пользователя
+func (it *UserIterator) User() User {
+	return it.user
+}
+
+// Err возвращает ошибку, на которой остановился обход
+func (it *UserIterator) Err() error {
+	return it.err
+}
+
+// Close прекращает обход и отменяет запрос следующей страницы
+func (it *UserIterator) Close() error {
+	it.cancel()
+	it.done = true
+	it.page = nil
+	return nil
+}
+
+// more сообщает, нужно ли запрашивать следующую страницу
+func (it *UserIterator) more() bool {
+	return !it.done && it.err == nil && (it.opts.Max <= 0 || it.count+len(it.page) < it.opts.Max)
+}
+
+// fetch запрашивает следующую страницу в фоне
+func (it *UserIterator) fetch() chan pageResult {
+	req := it.req
+	req.Offset = it.offset
+	req.Limit = it.pageSize
+	if it.opts.Max > 0 {
+		if rest := it.opts.Max - it.count - len(it.page); rest < req.Limit {
+			req.Limit = rest
+		}
+	}
+	if it.hasLast {
+		// страница начинается с последнего полученного пользователя, чтобы заметить изменение данных
+		req.Offset--
+		req.Limit++
+		if req.Limit > maxPageSize {
+			req.Limit = maxPageSize
+		}
+	}
+	pending := make(chan pageResult, 1)
+	go func() {
+		res, err := it.srv.FindUsersContext(it.ctx, req)
+		pending <- pageResult{offset: req.Offset, res: res, err: err}
+	}()
+	return pending
+}
+
+// accept проверяет полученную страницу и делает её текущей
+func (it *UserIterator) accept(result pageResult) {
+	users := result.res.Users
+	if it.hasLast {
+		if len(users) > 0 && users[0] == it.last {
+			users = users[1:]
+		} else if !it.opts.AllowChanges {
+			it.err = ErrDatasetChanged
+			return
+		}
+	}
+	end := result.offset + len(result.res.Users)
+	// страница без новых записей означает конец, иначе обход бы не продвигался
+	it.done = !result.res.NextPage || end <= it.offset
+	it.offset = end
+	if len(result.res.Users) > 0 {
+		it.last, it.hasLast = result.res.Users[len(result.res.Users)-1], true
+	}
+	if it.seen != nil {
+		fresh := users[:0:0]
+		for _, user := range users {
+			if !it.seen[user.Id] {
+				it.seen[user.Id] = true
+				fresh = append(fresh, user)
+			}
+		}
+		users = fresh
+	}
+	it.page = users
+}
@@ -0,0 +1,226 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"sync"
+	"testing"
+)
+
+// pagedServer отдаёт пользователей `users` по limit и offset и запоминает запросы.
+// `change` вызывается перед ответом на каждый запрос и может изменить данные.
+type pagedServer struct {
+	mu       sync.Mutex
+	users    []User
+	requests []string
+	change   func(request int, users []User) []User
+}
+
+func newPagedServer(n int) *pagedServer {
+	s := &pagedServer{}
+	for i := 1; i <= n; i++ {
+		s.users = append(s.users, User{Id: i, Name: "user" + strconv.Itoa(i)})
+	}
+	return s
+}
+
+func (s *pagedServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	limit, _ := strconv.Atoi(r.FormValue("limit"))
+	offset, _ := strconv.Atoi(r.FormValue("offset"))
+	s.requests = append(s.requests, fmt.Sprintf("%d+%d", offset, limit))
+	if s.change != nil {
+		s.users = s.change(len(s.requests), s.users)
+	}
+	if r.FormValue("query") == "fail" && len(s.requests) > 1 {
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	if offset > len(s.users) {
+		offset = len(s.users)
+	}
+	end := offset + limit
+	if end > len(s.users) {
+		end = len(s.users)
+	}
+	res, _ := json.Marshal(s.users[offset:end])
+	w.Write(res)
+}
+
+// ids возвращает идентификаторы пользователей
+func ids(users []User) []int {
+	res := []int{}
+	for _, u := range users {
+		res = append(res, u.Id)
+	}
+	return res
+}
+
+// idRange возвращает идентификаторы от `from` до `to` включительно
+func idRange(from, to int) []int {
+	res := []int{}
+	for i := from; i <= to; i++ {
+		res = append(res, i)
+	}
+	return res
+}
+
+// TestFindAll checks walking the pages of the results.
+func TestFindAll(t *testing.T) {
+	cases := []struct {
+		Name     string
+		Users    int
+		Request  SearchRequest
+		Options  PageOptions
+		Expected []int
+		Requests string
+	}{
+		{
+			Name:     "empty",
+			Expected: []int{},
+			Requests: "[0+26]",
+		},
+		{
+			Name:     "single page",
+			Users:    10,
+			Expected: idRange(1, 10),
+			Requests: "[0+26]",
+		},
+		{
+			Name:     "default page size",
+			Users:    60,
+			Expected: idRange(1, 60),
+			Requests: "[0+26 24+26 48+26]",
+		},
+		{
+			Name:     "page size and offset",
+			Users:    20,
+			Request:  SearchRequest{Limit: 7, Offset: 3},
+			Expected: idRange(4, 20),
+			Requests: "[3+8 9+9 16+9]",
+		},
+		{
+			Name:     "max",
+			Users:    60,
+			Request:  SearchRequest{Limit: 10},
+			Options:  PageOptions{Max: 15},
+			Expected: idRange(1, 15),
+			Requests: "[0+11 9+7]",
+		},
+		{
+			Name:     "max with prefetch",
+			Users:    60,
+			Request:  SearchRequest{Limit: 10},
+			Options:  PageOptions{Max: 25, Prefetch: true},
+			Expected: idRange(1, 25),
+			Requests: "[0+11 9+12 19+7]",
+		},
+		{
+			Name:     "prefetch",
+			Users:    60,
+			Options:  PageOptions{Prefetch: true},
+			Expected: idRange(1, 60),
+			Requests: "[0+26 24+26 48+26]",
+		},
+	}
+	for _, tc := range cases {
+		t.Run(tc.Name, func(t *testing.T) {
+			srv := newPagedServer(tc.Users)
+			ts := httptest.NewServer(srv)
+			defer ts.Close()
+			c := &SearchClient{URL: ts.URL}
+			users, err := c.FindAll(context.Background(), tc.Request, tc.Options)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got, expected := fmt.Sprint(ids(users)), fmt.Sprint(tc.Expected); got != expected {
+				t.Errorf("Expected:\n%s\nGot:\n%s\n", expected, got)
+			}
+			if got := fmt.Sprint(srv.requests); got != tc.Requests {
+				t.Errorf("requests\nExpected:\n%s\nGot:\n%s\n", tc.Requests, got)
+			}
+		})
+	}
+}
+
+// TestFindAllChanged checks the dataset changed between the pages.
+func TestFindAllChanged(t *testing.T) {
+	inserted := func(request int, users []User) []User {
+		if request == 2 {
+			users = append([]User{{Id: 100}}, users...)
+		}
+		return users
+	}
+	deleted := func(request int, users []User) []User {
+		if request == 2 {
+			users = users[2:]
+		}
+		return users
+	}
+	cases := []struct {
+		Name     string
+		Change   func(request int, users []User) []User
+		Allow    bool
+		Expected []int
+	}{
+		{Name: "inserted", Change: inserted, Expected: idRange(1, 10)},
+		{Name: "inserted allowed", Change: inserted, Allow: true, Expected: idRange(1, 30)},
+		{Name: "deleted", Change: deleted, Expected: idRange(1, 10)},
+		{Name: "deleted allowed", Change: deleted, Allow: true, Expected: append(idRange(1, 10), idRange(12, 30)...)},
+	}
+	for _, tc := range cases {
+		t.Run(tc.Name, func(t *testing.T) {
+			srv := newPagedServer(30)
+			srv.change = tc.Change
+			ts := httptest.NewServer(srv)
+			defer ts.Close()
+			c := &SearchClient{URL: ts.URL}
+			users, err := c.FindAll(context.Background(), SearchRequest{Limit: 10}, PageOptions{AllowChanges: tc.Allow})
+			if tc.Allow && err != nil {
+				t.Fatal(err)
+			}
+			if !tc.Allow && err != ErrDatasetChanged {
+				t.Errorf("Expected:\n%v\nGot:\n%v\n", ErrDatasetChanged, err)
+			}
+			if got, expected := fmt.Sprint(ids(users)), fmt.Sprint(tc.Expected); got != expected {
+				t.Errorf("Expected:\n%s\nGot:\n%s\n", expected, got)
+			}
+		})
+	}
+}
+
+// TestIterateErrors checks the errors of the pages and closing the iterator.
+func TestIterateErrors(t *testing.T) {
+	srv := newPagedServer(60)
+	ts := httptest.NewServer(srv)
+	defer ts.Close()
+	c := &SearchClient{URL: ts.URL}
+
+	users, err := c.FindAll(context.Background(), SearchRequest{Query: "fail"}, PageOptions{Prefetch: true})
+	var serverErr *ServerError
+	if !errors.As(err, &serverErr) || serverErr.StatusCode != http.StatusInternalServerError {
+		t.Errorf("Expected:\n*ServerError 500\nGot:\n%v\n", err)
+	}
+	if len(users) != 25 {
+		t.Errorf("Expected:\n25 users before the error\nGot:\n%d\n", len(users))
+	}
+
+	if _, err = c.FindAll(context.Background(), SearchRequest{Limit: -1}, PageOptions{}); err != ErrInvalidLimit {
+		t.Errorf("Expected:\n%v\nGot:\n%v\n", ErrInvalidLimit, err)
+	}
+
+	it := c.Iterate(context.Background(), SearchRequest{}, PageOptions{Prefetch: true})
+	if !it.Next() || it.User().Id != 1 {
+		t.Fatalf("Expected:\n1\nGot:\n%+v %v\n", it.User(), it.Err())
+	}
+	it.Close()
+	if it.Next() || it.Err() != nil {
+		t.Errorf("closed iterator\nGot:\n%+v %v\n", it.User(), it.Err())
+	}
+}
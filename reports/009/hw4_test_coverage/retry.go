@@ -0,0 +1,242 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"math/rand"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// RetryPolicy задаёт повтор запросов после временных ошибок: таймаутов, сбоев транспорта,
+// ответов 429 и 5xx. Задержка растёт экспоненциально, Retry-After из ответа 429 и 503 имеет приоритет.
+type RetryPolicy struct {
+	// MaxAttempts - число попыток вместе с первой, 0 и 1 - без повторов
+	MaxAttempts int
+	// BaseDelay - задержка перед первым повтором, удваивается с каждой попыткой
+	BaseDelay time.Duration
+	// MaxDelay ограничивает задержку, 0 - без ограничения.
+	// Если Retry-After больше `MaxDelay`, повторять нет смысла и возвращается ошибка
+	MaxDelay time.Duration
+	// Jitter - доля задержки от 0 до 1, на которую она случайно уменьшается, чтобы клиенты не повторяли запросы одновременно
+	Jitter float64
+}
+
+// DefaultRetryPolicy - разумная политика повторов для большинства клиентов
+var DefaultRetryPolicy = RetryPolicy{
+	MaxAttempts: 3,
+	BaseDelay:   100 * time.Millisecond,
+	MaxDelay:    2 * time.Second,
+	Jitter:      0.5,
+}
+
+// backoff возвращает задержку перед следующей попыткой после неудачной попытки `attempt`,
+// false - если повторять не нужно
+func (p *RetryPolicy) backoff(attempt int, err error) (time.Duration, bool) {
+	if p == nil || attempt >= p.MaxAttempts || !temporary(err) {
+		return 0, false
+	}
+	delay := p.BaseDelay
+	for i := 1; i < attempt && (p.MaxDelay <= 0 || delay < p.MaxDelay); i++ {
+		delay *= 2
+	}
+	if p.MaxDelay > 0 && delay > p.MaxDelay {
+		delay = p.MaxDelay
+	}
+	if p.Jitter > 0 {
+		delay -= time.Duration(rand.Float64() * p.Jitter * float64(delay))
+	}
+	var serverErr *ServerError
+	if errors.As(err, &serverErr) && serverErr.RetryAfter > 0 {
+		if p.MaxDelay > 0 && serverErr.RetryAfter > p.MaxDelay {
+			return 0, false
+		}
+		delay = serverErr.RetryAfter
+	}
+	return delay, true
+}
+
+// temporary сообщает, что ошибка вызвана сбоем внешней системы и запрос стоит повторить
+func temporary(err error) bool {
+	var (
+		serverErr    *ServerError
+		timeoutErr   *TimeoutError
+		transportErr *transportError
+	)
+	switch {
+	case errors.As(err, &serverErr):
+		return serverErr.StatusCode == http.StatusTooManyRequests || serverErr.StatusCode >= http.StatusInternalServerError
+	case errors.As(err, &timeoutErr), errors.As(err, &transportErr):
+		return true
+	}
+	return false
+}
+
+// retryAfter разбирает хедер Retry-After в секундах или в виде даты
+func retryAfter(header http.Header) time.Duration {
+	value := header.Get("Retry-After")
+	if value == "" {
+		return 0
+	}
+	if seconds, err := strconv.Atoi(value); err == nil && seconds > 0 {
+		return time.Duration(seconds) * time.Second
+	}
+	if date, err := http.ParseTime(value); err == nil {
+		if delay := time.Until(date); delay > 0 {
+			return delay
+		}
+	}
+	return 0
+}
+
+// BreakerState - состояние `CircuitBreaker`
+type BreakerState int
+
+// Состояния `CircuitBreaker`
+const (
+	// BreakerClosed - запросы проходят
+	BreakerClosed BreakerState = iota
+	// BreakerOpen - запросы сразу завершаются `ErrCircuitOpen`
+	BreakerOpen
+	// BreakerHalfOpen - после `Cooldown` пропускается один пробный запрос
+	BreakerHalfOpen
+)
+
+func (s BreakerState) String() string {
+	switch s {
+	case BreakerClosed:
+		return "closed"
+	case BreakerOpen:
+		return "open"
+	case BreakerHalfOpen:
+		return "half-open"
+	}
+	return "BreakerState(" + strconv.Itoa(int(s)) + ")"
+}
+
+// DefaultBreakerThreshold - число временных ошибок подряд, открывающее `CircuitBreaker` с нулевым `Threshold`
+const DefaultBreakerThreshold = 5
+
+// CircuitBreaker перестаёт пропускать запросы после `Threshold` временных ошибок подряд.
+// Через `Cooldown` пропускается пробный запрос: успех закрывает его, ошибка снова открывает.
+// Ошибки запроса, например `ErrUnauthorized`, и отмена контекста вызывающего не считаются сбоем.
+type CircuitBreaker struct {
+	// Threshold - число временных ошибок подряд, открывающее `CircuitBreaker`, 0 - `DefaultBreakerThreshold`
+	Threshold int
+	Cooldown  time.Duration
+	// OnStateChange вызывается при смене состояния, например для мониторинга.
+	// Вызывается под блокировкой, поэтому не должен обращаться к `CircuitBreaker`
+	OnStateChange func(from, to BreakerState)
+
+	mu       sync.Mutex
+	state    BreakerState
+	failures int
+	openedAt time.Time
+	probing  bool
+	// now подменяется в тестах
+	now func() time.Time
+}
+
+// NewCircuitBreaker создаёт закрытый `CircuitBreaker`
+func NewCircuitBreaker(threshold int, cooldown time.Duration) *CircuitBreaker {
+	return &CircuitBreaker{Threshold: threshold, Cooldown: cooldown}
+}
+
+// State возвращает текущее состояние
+func (b *CircuitBreaker) State() BreakerState {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.state == BreakerOpen && b.cooledDown() {
+		return BreakerHalfOpen
+	}
+	return b.state
+}
+
+// Failures возвращает число временных ошибок подряд
+func (b *CircuitBreaker) Failures() int {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.failures
+}
+
+func (b *CircuitBreaker) clock() time.Time {
+	if b.now != nil {
+		return b.now()
+	}
+	return time.Now()
+}
+
+func (b *CircuitBreaker) threshold() int {
+	if b.Threshold <= 0 {
+		return DefaultBreakerThreshold
+	}
+	return b.Threshold
+}
+
+func (b *CircuitBreaker) cooledDown() bool {
+	return b.clock().Sub(b.openedAt) >= b.Cooldown
+}
+
+// setState меняет состояние, вызывается под `mu`
+func (b *CircuitBreaker) setState(state BreakerState) {
+	if b.state == state {
+		return
+	}
+	from := b.state
+	b.state = state
+	if state == BreakerOpen {
+		b.openedAt = b.clock()
+	}
+	if b.OnStateChange != nil {
+		b.OnStateChange(from, state)
+	}
+}
+
+// allow проверяет, можно ли отправить запрос, и сообщает, что запрос - пробный.
+// Результат запроса передаётся в `record` вместе с этим признаком
+func (b *CircuitBreaker) allow() (probe bool, err error) {
+	if b == nil {
+		return false, nil
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.state == BreakerOpen && b.cooledDown() {
+		b.setState(BreakerHalfOpen)
+	}
+	switch {
+	case b.state == BreakerOpen, b.state == BreakerHalfOpen && b.probing:
+		return false, ErrCircuitOpen
+	case b.state == BreakerHalfOpen:
+		b.probing = true
+		return true, nil
+	}
+	return false, nil
+}
+
+// record учитывает результат запроса, пропущенного `allow`, `probe` - признак, возвращённый `allow`
+func (b *CircuitBreaker) record(ctx context.Context, probe bool, err error) {
+	if b == nil {
+		return
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if probe {
+		b.probing = false
+	}
+	switch {
+	case err != nil && ctx.Err() != nil:
+		// запрос отменил вызывающий, о внешней системе ничего не известно, пробу повторит следующий запрос
+	case !probe && b.state != BreakerClosed:
+		// запрос пропущен до открытия, решение о закрытии принимает только проба
+	case temporary(err):
+		b.failures++
+		if probe || b.failures >= b.threshold() {
+			b.setState(BreakerOpen)
+		}
+	default:
+		b.failures = 0
+		b.setState(BreakerClosed)
+	}
+}
@@ -0,0 +1,282 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// flakyServer отвечает статусами `statuses` по очереди, после них - одним пользователем.
+func flakyServer(header http.Header, statuses ...int) (*httptest.Server, *int32) {
+	calls := new(int32)
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		n := int(atomic.AddInt32(calls, 1))
+		if n <= len(statuses) {
+			for key, values := range header {
+				w.Header()[key] = values
+			}
+			w.WriteHeader(statuses[n-1])
+			return
+		}
+		w.Write([]byte(`[{"Id":1}]`))
+	}))
+	return ts, calls
+}
+
+// TestRetry checks the retries of the temporary errors.
+func TestRetry(t *testing.T) {
+	policy := &RetryPolicy{MaxAttempts: 3, BaseDelay: time.Millisecond}
+	cases := []struct {
+		Name     string
+		Statuses []int
+		Header   http.Header
+		Policy   *RetryPolicy
+		Calls    int32
+		Status   int
+	}{
+		{Name: "no policy", Statuses: []int{503}, Calls: 1, Status: 503},
+		{Name: "recovered", Statuses: []int{503, 500}, Policy: policy, Calls: 3},
+		{Name: "too many requests", Statuses: []int{429}, Policy: policy, Calls: 2},
+		{Name: "exhausted", Statuses: []int{502, 500, 504}, Policy: policy, Calls: 3, Status: 504},
+		{Name: "permanent", Statuses: []int{401}, Policy: policy, Calls: 1, Status: 401},
+		{Name: "not found", Statuses: []int{404}, Policy: policy, Calls: 1, Status: 404},
+		{
+			Name:     "retry after exceeds max delay",
+			Statuses: []int{503},
+			Header:   http.Header{"Retry-After": {"120"}},
+			Policy:   &RetryPolicy{MaxAttempts: 3, BaseDelay: time.Millisecond, MaxDelay: time.Second},
+			Calls:    1,
+			Status:   503,
+		},
+	}
+	for _, tc := range cases {
+		t.Run(tc.Name, func(t *testing.T) {
+			ts, calls := flakyServer(tc.Header, tc.Statuses...)
+			defer ts.Close()
+			c := &SearchClient{URL: ts.URL, Retry: tc.Policy}
+			res, err := c.FindUsers(SearchRequest{Limit: 5})
+			if got := atomic.LoadInt32(calls); got != tc.Calls {
+				t.Errorf("calls\nExpected: %d\nGot: %d\n", tc.Calls, got)
+			}
+			var serverErr *ServerError
+			switch {
+			case tc.Status == 0 && (err != nil || len(res.Users) != 1):
+				t.Errorf("Expected:\n1 user\nGot:\n%+v %v\n", res, err)
+			case tc.Status == http.StatusUnauthorized && err != ErrUnauthorized:
+				t.Errorf("Expected:\n%v\nGot:\n%v\n", ErrUnauthorized, err)
+			case tc.Status > 0 && tc.Status != http.StatusUnauthorized && (!errors.As(err, &serverErr) || serverErr.StatusCode != tc.Status):
+				t.Errorf("Expected:\n*ServerError %d\nGot:\n%v\n", tc.Status, err)
+			}
+		})
+	}
+}
+
+// TestRetryContext checks that the wait before the retry is canceled with the context.
+func TestRetryContext(t *testing.T) {
+	ts, calls := flakyServer(nil, 500, 500)
+	defer ts.Close()
+	c := &SearchClient{URL: ts.URL, Retry: &RetryPolicy{MaxAttempts: 3, BaseDelay: time.Hour}}
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	if _, err := c.FindUsersContext(ctx, SearchRequest{}); err != context.DeadlineExceeded {
+		t.Errorf("Expected:\n%v\nGot:\n%v\n", context.DeadlineExceeded, err)
+	}
+	if got := atomic.LoadInt32(calls); got != 1 {
+		t.Errorf("calls\nExpected: 1\nGot: %d\n", got)
+	}
+
+	// отменённый контекст не повторяется
+	ts2 := httptest.NewServer(http.HandlerFunc(fakeSearchServer))
+	defer ts2.Close()
+	c = &SearchClient{URL: ts2.URL, AccessToken: "Timeout", Retry: &DefaultRetryPolicy, Timeout: -1}
+	ctx, cancel = context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	if _, err := c.FindUsersContext(ctx, SearchRequest{}); err != context.DeadlineExceeded {
+		t.Errorf("Expected:\n%v\nGot:\n%v\n", context.DeadlineExceeded, err)
+	}
+}
+
+// TestBackoff checks the delays between the attempts.
+func TestBackoff(t *testing.T) {
+	temporaryErr := &ServerError{StatusCode: http.StatusInternalServerError}
+	p := &RetryPolicy{MaxAttempts: 10, BaseDelay: 10 * time.Millisecond, MaxDelay: 50 * time.Millisecond}
+	for attempt, expected := range []time.Duration{10, 20, 40, 50, 50} {
+		delay, ok := p.backoff(attempt+1, temporaryErr)
+		if !ok || delay != expected*time.Millisecond {
+			t.Errorf("attempt %d\nExpected: %v\nGot: %v %v\n", attempt+1, expected*time.Millisecond, delay, ok)
+		}
+	}
+	if delay, ok := (&RetryPolicy{MaxAttempts: 4, BaseDelay: time.Second}).backoff(3, temporaryErr); !ok || delay != 4*time.Second {
+		t.Errorf("unlimited\nExpected: 4s\nGot: %v %v\n", delay, ok)
+	}
+
+	p.Jitter = 0.5
+	for i := 0; i < 100; i++ {
+		if delay, _ := p.backoff(2, temporaryErr); delay < 10*time.Millisecond || delay > 20*time.Millisecond {
+			t.Fatalf("jitter\nExpected: 10ms..20ms\nGot: %v\n", delay)
+		}
+	}
+
+	retryAfterErr := &ServerError{StatusCode: http.StatusServiceUnavailable, RetryAfter: 30 * time.Millisecond}
+	if delay, ok := p.backoff(1, retryAfterErr); !ok || delay != 30*time.Millisecond {
+		t.Errorf("retry after\nExpected: 30ms\nGot: %v %v\n", delay, ok)
+	}
+
+	for _, err := range []error{
+		&TimeoutError{Err: context.DeadlineExceeded},
+		&transportError{errTest},
+		fmt.Errorf("wrapped: %w", temporaryErr),
+	} {
+		if _, ok := p.backoff(1, err); !ok {
+			t.Errorf("%v is not retried", err)
+		}
+	}
+	for _, err := range []error{ErrUnauthorized, &OrderFieldError{}, &DecodeError{Err: errTest}, &ServerError{StatusCode: 400}} {
+		if _, ok := p.backoff(1, err); ok {
+			t.Errorf("%v is retried", err)
+		}
+	}
+	if _, ok := p.backoff(10, temporaryErr); ok {
+		t.Errorf("retried after the last attempt")
+	}
+}
+
+// TestRetryAfter checks the parsing of the Retry-After header.
+func TestRetryAfter(t *testing.T) {
+	cases := []struct {
+		Value string
+		Min   time.Duration
+		Max   time.Duration
+	}{
+		{Value: "", Min: 0, Max: 0},
+		{Value: "3", Min: 3 * time.Second, Max: 3 * time.Second},
+		{Value: "-3", Min: 0, Max: 0},
+		{Value: "soon", Min: 0, Max: 0},
+		{Value: time.Now().Add(time.Hour).UTC().Format(http.TimeFormat), Min: 59 * time.Minute, Max: time.Hour},
+		{Value: time.Now().Add(-time.Hour).UTC().Format(http.TimeFormat), Min: 0, Max: 0},
+	}
+	for _, tc := range cases {
+		got := retryAfter(http.Header{"Retry-After": {tc.Value}})
+		if got < tc.Min || got > tc.Max {
+			t.Errorf("%q\nExpected: %v..%v\nGot: %v\n", tc.Value, tc.Min, tc.Max, got)
+		}
+	}
+}
+
+// TestCircuitBreaker checks the transitions between the states of the breaker.
+func TestCircuitBreaker(t *testing.T) {
+	now := time.Unix(0, 0)
+	b := NewCircuitBreaker(2, time.Minute)
+	b.now = func() time.Time { return now }
+	var transitions []string
+	b.OnStateChange = func(from, to BreakerState) {
+		transitions = append(transitions, from.String()+">"+to.String())
+	}
+	ctx := context.Background()
+	failure := &ServerError{StatusCode: http.StatusBadGateway}
+
+	// step проверяет состояние и возвращает признак пробы пропущенного запроса
+	step := func(name string, err error, state BreakerState, failures int, probe bool) bool {
+		t.Helper()
+		if got := b.State(); got != state {
+			t.Errorf("%s: state\nExpected: %v\nGot: %v\n", name, state, got)
+		}
+		if got := b.Failures(); got != failures {
+			t.Errorf("%s: failures\nExpected: %d\nGot: %d\n", name, failures, got)
+		}
+		gotProbe, got := b.allow()
+		if got != err || gotProbe != probe {
+			t.Errorf("%s: allow\nExpected: %v %v\nGot: %v %v\n", name, probe, err, gotProbe, got)
+		}
+		return gotProbe
+	}
+
+	step("initial", nil, BreakerClosed, 0, false)
+	b.record(ctx, false, failure)
+	step("one failure", nil, BreakerClosed, 1, false)
+	b.record(ctx, false, ErrUnauthorized)
+	step("permanent error resets", nil, BreakerClosed, 0, false)
+	// запрос пропущен до открытия, а ответ придёт после
+	late, _ := b.allow()
+	b.record(ctx, false, failure)
+	b.record(ctx, false, failure)
+	step("opened", ErrCircuitOpen, BreakerOpen, 2, false)
+	b.record(ctx, late, nil)
+	step("late success keeps open", ErrCircuitOpen, BreakerOpen, 2, false)
+
+	now = now.Add(time.Minute)
+	probe := step("cooled down", nil, BreakerHalfOpen, 2, true)
+	step("probing", ErrCircuitOpen, BreakerHalfOpen, 2, false)
+	// ответ на запрос, пропущенный до открытия, не снимает пробу
+	b.record(ctx, late, failure)
+	step("late failure keeps probing", ErrCircuitOpen, BreakerHalfOpen, 2, false)
+	canceled, cancel := context.WithCancel(ctx)
+	cancel()
+	b.record(canceled, probe, context.Canceled)
+	probe = step("canceled probe", nil, BreakerHalfOpen, 2, true)
+	b.record(ctx, probe, failure)
+	step("failed probe", ErrCircuitOpen, BreakerOpen, 3, false)
+
+	now = now.Add(time.Minute)
+	probe = step("cooled down again", nil, BreakerHalfOpen, 3, true)
+	b.record(ctx, probe, nil)
+	step("closed", nil, BreakerClosed, 0, false)
+
+	expected := "[closed>open open>half-open half-open>open open>half-open half-open>closed]"
+	if got := fmt.Sprint(transitions); got != expected {
+		t.Errorf("transitions\nExpected: %s\nGot: %s\n", expected, got)
+	}
+	if got := BreakerState(7).String(); got != "BreakerState(7)" {
+		t.Errorf("Expected:\nBreakerState(7)\nGot:\n%s\n", got)
+	}
+
+	// нулевой порог заменяется значением по умолчанию
+	b = NewCircuitBreaker(0, time.Minute)
+	for i := 1; i < DefaultBreakerThreshold; i++ {
+		b.record(ctx, false, failure)
+	}
+	if got := b.State(); got != BreakerClosed {
+		t.Errorf("zero threshold\nExpected: %v\nGot: %v\n", BreakerClosed, got)
+	}
+	b.record(ctx, false, failure)
+	if got := b.State(); got != BreakerOpen {
+		t.Errorf("zero threshold\nExpected: %v\nGot: %v\n", BreakerOpen, got)
+	}
+}
+
+// TestSearchClientBreaker checks that the client fails fast while the breaker is open.
+func TestSearchClientBreaker(t *testing.T) {
+	ts, calls := flakyServer(nil, 500, 500, 500)
+	defer ts.Close()
+	b := NewCircuitBreaker(2, time.Minute)
+	c := &SearchClient{URL: ts.URL, Breaker: b, Retry: &RetryPolicy{MaxAttempts: 5, BaseDelay: time.Millisecond}}
+	if _, err := c.FindUsers(SearchRequest{Limit: 5}); err != ErrCircuitOpen {
+		t.Errorf("Expected:\n%v\nGot:\n%v\n", ErrCircuitOpen, err)
+	}
+	if _, err := c.FindUsers(SearchRequest{Limit: 5}); err != ErrCircuitOpen {
+		t.Errorf("Expected:\n%v\nGot:\n%v\n", ErrCircuitOpen, err)
+	}
+	if got := atomic.LoadInt32(calls); got != 2 {
+		t.Errorf("calls\nExpected: 2\nGot: %d\n", got)
+	}
+	if b.State() != BreakerOpen {
+		t.Errorf("Expected:\nopen\nGot:\n%v\n", b.State())
+	}
+
+	// после паузы первая проба получает ошибку, повтор после паузы проходит
+	b.Cooldown = 0
+	if res, err := c.FindUsers(SearchRequest{Limit: 5}); err != nil || len(res.Users) != 1 {
+		t.Errorf("Expected:\n1 user\nGot:\n%+v %v\n", res, err)
+	}
+	if got := atomic.LoadInt32(calls); got != 4 {
+		t.Errorf("calls\nExpected: 4\nGot: %d\n", got)
+	}
+	if b.State() != BreakerClosed {
+		t.Errorf("Expected:\nclosed\nGot:\n%v\n", b.State())
+	}
+}
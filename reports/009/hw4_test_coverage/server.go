@@ -0,0 +1,159 @@
+package main
+
+import (
+	"encoding/json"
+	"encoding/xml"
+	"net/http"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// коды ошибок в `SearchErrorResponse`, которые возвращает `SearchServer`
+const (
+	errorBadOrderField = "ErrorBadOrderField"
+	errorBadOrderBy    = "ErrorBadOrderBy"
+	errorBadLimit      = "ErrorBadLimit"
+	errorBadOffset     = "ErrorBadOffset"
+)
+
+// datasetRow - запись пользователя в dataset.xml, остальные поля не нужны
+type datasetRow struct {
+	Id        int    `xml:"id"`
+	FirstName string `xml:"first_name"`
+	LastName  string `xml:"last_name"`
+	Age       int    `xml:"age"`
+	About     string `xml:"about"`
+	Gender    string `xml:"gender"`
+}
+
+// LoadDataset читает пользователей из файла в формате dataset.xml, `Name` - это имя и фамилия через пробел
+func LoadDataset(path string) ([]User, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	dataset := struct {
+		Rows []datasetRow `xml:"row"`
+	}{}
+	if err = xml.NewDecoder(f).Decode(&dataset); err != nil {
+		return nil, err
+	}
+	users := make([]User, 0, len(dataset.Rows))
+	for _, row := range dataset.Rows {
+		users = append(users, User{
+			Id:     row.Id,
+			Name:   row.FirstName + " " + row.LastName,
+			Age:    row.Age,
+			About:  row.About,
+			Gender: row.Gender,
+		})
+	}
+	return users, nil
+}
+
+// SearchServer - внешняя система, которая ищет пользователей для `SearchClient`.
+//
+// Параметры запроса:
+//   - query - подстрока в `Name` или `About`, пустая - все пользователи
+//   - order_field - `Id`, `Age` или `Name`, пустое - `Name`
+//   - order_by - `OrderByAsc`, `OrderByAsIs` или `OrderByDesc`
+//   - limit и offset - страница после сортировки, пустой limit - без ограничения
+type SearchServer struct {
+	users  []User
+	tokens map[string]bool
+}
+
+// NewSearchServer создаёт сервер, который отвечает только на запросы с одним из токенов `tokens`
+func NewSearchServer(users []User, tokens ...string) *SearchServer {
+	srv := &SearchServer{users: users, tokens: make(map[string]bool, len(tokens))}
+	for _, token := range tokens {
+		srv.tokens[token] = true
+	}
+	return srv
+}
+
+// userLess сравнивает пользователей по полю сортировки
+var userLess = map[string]func(a, b *User) bool{
+	"Id":   func(a, b *User) bool { return a.Id < b.Id },
+	"Age":  func(a, b *User) bool { return a.Age < b.Age },
+	"Name": func(a, b *User) bool { return a.Name < b.Name },
+}
+
+func (srv *SearchServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		w.Header().Set("Allow", http.MethodGet)
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+	if !srv.tokens[r.Header.Get("AccessToken")] {
+		w.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+
+	query := r.FormValue("query")
+	orderField := r.FormValue("order_field")
+	if orderField == "" {
+		orderField = "Name"
+	}
+	less, ok := userLess[orderField]
+	if !ok {
+		badRequest(w, errorBadOrderField)
+		return
+	}
+	orderBy, err := strconv.Atoi(r.FormValue("order_by"))
+	if r.FormValue("order_by") == "" {
+		orderBy, err = OrderByAsIs, nil
+	}
+	if err != nil || orderBy < OrderByAsc || orderBy > OrderByDesc {
+		badRequest(w, errorBadOrderBy)
+		return
+	}
+	limit, err := strconv.Atoi(r.FormValue("limit"))
+	if r.FormValue("limit") == "" {
+		limit, err = len(srv.users), nil
+	}
+	if err != nil || limit < 0 {
+		badRequest(w, errorBadLimit)
+		return
+	}
+	offset, err := strconv.Atoi(r.FormValue("offset"))
+	if r.FormValue("offset") == "" {
+		offset, err = 0, nil
+	}
+	if err != nil || offset < 0 {
+		badRequest(w, errorBadOffset)
+		return
+	}
+
+	found := []User{}
+	for _, user := range srv.users {
+		if strings.Contains(user.Name, query) || strings.Contains(user.About, query) {
+			found = append(found, user)
+		}
+	}
+	switch orderBy {
+	case OrderByAsc:
+		sort.SliceStable(found, func(i, j int) bool { return less(&found[i], &found[j]) })
+	case OrderByDesc:
+		sort.SliceStable(found, func(i, j int) bool { return less(&found[j], &found[i]) })
+	}
+	if offset > len(found) {
+		offset = len(found)
+	}
+	if limit > len(found)-offset {
+		limit = len(found) - offset
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(found[offset : offset+limit])
+}
+
+// badRequest отвечает ошибкой в формате `SearchErrorResponse`
+func badRequest(w http.ResponseWriter, code string) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusBadRequest)
+	json.NewEncoder(w).Encode(SearchErrorResponse{Error: code})
+}
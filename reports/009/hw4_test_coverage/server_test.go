@@ -0,0 +1,243 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+)
+
+// datasetServer запускает `SearchServer` с пользователями из dataset.xml и токеном "token"
+func datasetServer(t *testing.T) (*httptest.Server, []User) {
+	users, err := LoadDataset("dataset.xml")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return httptest.NewServer(NewSearchServer(users, "token")), users
+}
+
+// TestLoadDataset checks reading the users from dataset.xml.
+func TestLoadDataset(t *testing.T) {
+	users, err := LoadDataset("dataset.xml")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(users) != 35 {
+		t.Errorf("Expected:\n35 users\nGot:\n%d\n", len(users))
+	}
+	first := users[0]
+	if first.Id != 0 || first.Name != "Boyd Wolf" || first.Age != 22 || first.Gender != "male" || !strings.HasPrefix(first.About, "Nulla cillum") {
+		t.Errorf("Got:\n%+v\n", first)
+	}
+
+	if _, err = LoadDataset("missing.xml"); !os.IsNotExist(err) {
+		t.Errorf("Expected:\nnot exist\nGot:\n%v\n", err)
+	}
+	dir, err := ioutil.TempDir("", "hw4_dataset")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	broken := filepath.Join(dir, "broken.xml")
+	if err = ioutil.WriteFile(broken, []byte("<root><row><id>x</id></row></root>"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = LoadDataset(broken); err == nil {
+		t.Errorf("broken dataset accepted")
+	}
+}
+
+// TestSearchServer runs the client against the server backed by dataset.xml.
+func TestSearchServer(t *testing.T) {
+	ts, users := datasetServer(t)
+	defer ts.Close()
+	c := &SearchClient{URL: ts.URL, AccessToken: "token"}
+
+	cases := []struct {
+		Name     string
+		Request  SearchRequest
+		Expected string
+		NextPage bool
+	}{
+		{
+			Name:     "query in name",
+			Request:  SearchRequest{Limit: 10, Query: "Dillard"},
+			Expected: "[3 17]",
+		},
+		{
+			Name:     "query in about",
+			Request:  SearchRequest{Limit: 3, Query: "Nulla cillum enim"},
+			Expected: "[0]",
+		},
+		{
+			Name:     "as is",
+			Request:  SearchRequest{Limit: 3, Offset: 2, OrderField: "Age"},
+			Expected: "[2 3 4]",
+			NextPage: true,
+		},
+		{
+			Name:     "name by default",
+			Request:  SearchRequest{Limit: 3, OrderBy: OrderByAsc},
+			Expected: "[15 16 19]",
+			NextPage: true,
+		},
+		// OrderByAsc сортирует по возрастанию, OrderByDesc - по убыванию
+		{
+			Name:     "id ascending",
+			Request:  SearchRequest{Limit: 3, OrderField: "Id", OrderBy: OrderByAsc},
+			Expected: "[0 1 2]",
+			NextPage: true,
+		},
+		{
+			Name:     "id descending",
+			Request:  SearchRequest{Limit: 3, OrderField: "Id", OrderBy: OrderByDesc},
+			Expected: "[34 33 32]",
+			NextPage: true,
+		},
+		{
+			Name:     "name ascending",
+			Request:  SearchRequest{Limit: 3, OrderField: "Name", OrderBy: OrderByAsc},
+			Expected: "[15 16 19]",
+			NextPage: true,
+		},
+		{
+			Name:     "name descending",
+			Request:  SearchRequest{Limit: 3, OrderField: "Name", OrderBy: OrderByDesc},
+			Expected: "[13 33 18]",
+			NextPage: true,
+		},
+		{
+			Name:     "age descending",
+			Request:  SearchRequest{Limit: 4, OrderField: "Age", OrderBy: OrderByDesc},
+			Expected: "[13 32 6 26]",
+			NextPage: true,
+		},
+		{
+			Name:     "id descending last page",
+			Request:  SearchRequest{Limit: 5, Offset: 32, OrderField: "Id", OrderBy: OrderByDesc},
+			Expected: "[2 1 0]",
+		},
+		{
+			Name:     "offset after the end",
+			Request:  SearchRequest{Limit: 5, Offset: 100},
+			Expected: "[]",
+		},
+		{
+			Name:     "nothing found",
+			Request:  SearchRequest{Limit: 5, Query: "nobody"},
+			Expected: "[]",
+		},
+	}
+	for _, tc := range cases {
+		t.Run(tc.Name, func(t *testing.T) {
+			res, err := c.FindUsers(tc.Request)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := fmt.Sprint(ids(res.Users)); got != tc.Expected || res.NextPage != tc.NextPage {
+				t.Errorf("Expected:\n%s %v\nGot:\n%s %v\n", tc.Expected, tc.NextPage, got, res.NextPage)
+			}
+		})
+	}
+
+	t.Run("all pages", func(t *testing.T) {
+		for _, field := range []string{"Id", "Age", "Name"} {
+			for _, order := range []int{OrderByAsc, OrderByAsIs, OrderByDesc} {
+				all, err := c.FindAll(context.Background(), SearchRequest{Limit: 4, OrderField: field, OrderBy: order}, PageOptions{})
+				if err != nil {
+					t.Fatal(err)
+				}
+				expected := append([]User(nil), users...)
+				switch order {
+				case OrderByAsc:
+					sort.SliceStable(expected, func(i, j int) bool { return userLess[field](&expected[i], &expected[j]) })
+				case OrderByDesc:
+					sort.SliceStable(expected, func(i, j int) bool { return userLess[field](&expected[j], &expected[i]) })
+				}
+				if got, exp := fmt.Sprint(all), fmt.Sprint(expected); got != exp {
+					t.Errorf("%s %d\nExpected:\n%s\nGot:\n%s\n", field, order, exp, got)
+				}
+			}
+		}
+	})
+}
+
+// TestSearchServerErrors checks the errors of the server as seen by the client and over plain HTTP.
+func TestSearchServerErrors(t *testing.T) {
+	ts, _ := datasetServer(t)
+	defer ts.Close()
+
+	c := &SearchClient{URL: ts.URL, AccessToken: "token"}
+	_, err := c.FindUsers(SearchRequest{OrderField: "About"})
+	var orderErr *OrderFieldError
+	if !errors.As(err, &orderErr) || orderErr.Field != "About" {
+		t.Errorf("Expected:\n*OrderFieldError\nGot:\n%v\n", err)
+	}
+	_, err = c.FindUsers(SearchRequest{OrderBy: 2})
+	var serverErr *ServerError
+	if !errors.As(err, &serverErr) || serverErr.StatusCode != http.StatusBadRequest || !strings.Contains(serverErr.Body, errorBadOrderBy) {
+		t.Errorf("Expected:\n*ServerError %s\nGot:\n%v\n", errorBadOrderBy, err)
+	}
+	c.AccessToken = "wrong"
+	if _, err = c.FindUsers(SearchRequest{}); err != ErrUnauthorized {
+		t.Errorf("Expected:\n%v\nGot:\n%v\n", ErrUnauthorized, err)
+	}
+
+	cases := []struct {
+		Method string
+		Query  string
+		Status int
+		Body   string
+	}{
+		{Method: "GET", Query: "", Status: http.StatusOK, Body: `"Id":0,`},
+		{Method: "POST", Query: "", Status: http.StatusMethodNotAllowed},
+		{Method: "GET", Query: "order_by=x", Status: http.StatusBadRequest, Body: errorBadOrderBy},
+		{Method: "GET", Query: "limit=-1", Status: http.StatusBadRequest, Body: errorBadLimit},
+		{Method: "GET", Query: "limit=x", Status: http.StatusBadRequest, Body: errorBadLimit},
+		{Method: "GET", Query: "offset=-1", Status: http.StatusBadRequest, Body: errorBadOffset},
+		{Method: "GET", Query: "offset=x", Status: http.StatusBadRequest, Body: errorBadOffset},
+	}
+	for _, tc := range cases {
+		req, err := http.NewRequest(tc.Method, ts.URL+"?"+tc.Query, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		req.Header.Set("AccessToken", "token")
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		body, err := ioutil.ReadAll(resp.Body)
+		resp.Body.Close()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if resp.StatusCode != tc.Status || !strings.Contains(string(body), tc.Body) {
+			t.Errorf("%s %s\nExpected:\n%d %s\nGot:\n%d %s\n", tc.Method, tc.Query, tc.Status, tc.Body, resp.StatusCode, body)
+		}
+	}
+}
+
+// TestNewServer checks the configuration of the server from the flags.
+func TestNewServer(t *testing.T) {
+	srv, err := newServer("dataset.xml", " a, ,b ")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(srv.users) != 35 || fmt.Sprint(srv.tokens) != "map[a:true b:true]" {
+		t.Errorf("Got:\n%d users, tokens %v\n", len(srv.users), srv.tokens)
+	}
+	if _, err = newServer("dataset.xml", " , "); err == nil {
+		t.Errorf("server without tokens created")
+	}
+	if _, err = newServer("missing.xml", "a"); err == nil {
+		t.Errorf("missing dataset accepted")
+	}
+}